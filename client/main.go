@@ -1,12 +1,20 @@
 package main
 
 import (
+	"compress/gzip"
+	"fmt"
+	"mime"
+	"path"
+	"path/filepath"
 	"log"
 	"net/http"
 	"io"
+	"os"
 	"sort"
 	"bytes"
 	"strconv"
+	"strings"
+	"time"
 	"encoding/json"
 	"github.com/maxence-charriere/go-app/v10/pkg/app"
 )
@@ -20,8 +28,47 @@ type calculator struct {
 	currentPack    Pack            // Currently selected pack
 	items          int             // Number of items to pack
 	packQuantities []PackQuantity   // Quantities of each pack size used in the calculation
+	errorMessage   string           // Message shown inline when a request is rejected
+	sortColumn     string           // Result column the table is sorted by, empty for calculation order
+	sortAscending  bool             // Whether the result table is sorted in ascending order
+	adHocPacks     string           // Comma-separated pack sizes to calculate with instead of the catalog
+	lastMutation   *mutation        // Last pack change, kept so it can be undone
+	exactOnly      bool             // Whether orders must be filled exactly, without overshipping
+	unfillable     string           // Message shown when an order can't be filled exactly
+	retry          func(app.Context)   // Request to re-run after a server or network failure
+	client         httpDoer            // Sends requests to the server, http.DefaultClient when nil
+	sleep          func(time.Duration) // Waits before an automatic retry, time.Sleep when nil
+	preview        string              // Estimate of the order shown while it is typed
+	previewSeq     int                 // Number of the latest scheduled preview, so earlier ones are dropped
+	newPackSize    int                 // Size of the pack to add, 0 until a valid size is typed
+	newPackError   string              // Why the typed new pack size is invalid, shown next to its input
 }
 
+// previewDelay is how long typing must pause before the order preview is recomputed.
+const previewDelay = 300 * time.Millisecond
+
+// mutation is a pack change that can be undone, holding the pack as it was before.
+type mutation struct {
+	method string // HTTP method of the change, PUT or DELETE
+	before Pack   // Pack before the change
+}
+
+// inverse returns the request that undoes the mutation: a deleted pack is
+// recreated with its old size and an edited pack is restored to its old size.
+func (m mutation) inverse() (string, Pack) {
+	if m.method == http.MethodDelete {
+		return http.MethodPost, Pack{Size: m.before.Size} // The server assigns the recreated pack a new ID
+	}
+
+	return http.MethodPut, m.before
+}
+
+// Result table columns that can be sorted.
+const (
+	columnPack     = "pack"
+	columnQuantity = "quantity"
+)
+
 // Pack represents a single pack with an ID and size.
 type Pack struct {
 	ID    string `mapstructure:"id" json:"id" validate:"uuid_rfc4122"` // Unique identifier for the pack
@@ -34,38 +81,284 @@ type PackQuantity struct {
 	Quantity int `mapstructure:"quantity" json:"quantity" validate:"uuid_rfc4122"` // Number of packs of this size
 }
 
+// errorResponse is the error envelope returned by the server.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// statusMessage maps a non-2xx server response to a message for the user,
+// preferring a friendly message for known statuses over the server's error text.
+func statusMessage(status int, body []byte) string {
+	if status == http.StatusConflict {
+		return "Pack size already exists"
+	}
+
+	var envelope errorResponse
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != "" {
+		return envelope.Error
+	}
+
+	return http.StatusText(status)
+}
+
+// itemsLabel returns the label for the order input, naming the unit when one is configured.
+func itemsLabel(unit string) string {
+	if unit == "" {
+		return "Items: "
+	}
+
+	return "Items (" + unit + "): "
+}
+
+// defaultMaxItems mirrors the server's default bound on the order size when MAX_ITEMS is unset.
+const defaultMaxItems = 1000000
+
+// maxItems returns the largest order the client calculates, read from the MAX_ITEMS setting.
+func maxItems() int {
+	if max, err := strconv.Atoi(app.Getenv("MAX_ITEMS")); err == nil && max > 0 {
+		return max
+	}
+
+	return defaultMaxItems
+}
+
+// minPackSize is the smallest pack size the inputs offer, as the server rejects sizes below 1.
+const minPackSize = 1
+
+// packSizeStep returns the increment of the pack size steppers, read from the
+// PACK_SIZE_STEP setting and 1 when it is unset or invalid.
+func packSizeStep() int {
+	if step, err := strconv.Atoi(app.Getenv("PACK_SIZE_STEP")); err == nil && step > 0 {
+		return step
+	}
+
+	return 1
+}
+
+// itemsError returns a message when items is outside 0..max, or an empty string when it is in bounds.
+func itemsError(items, max int) string {
+	if items < 0 {
+		return "Items must not be negative"
+	}
+
+	if items > max {
+		return "Items must not exceed " + strconv.Itoa(max)
+	}
+
+	return ""
+}
+
 // OnMount fetches the available packs when the component mounts.
 func (c *calculator) OnMount(ctx app.Context) {
 	c.getPacks(ctx)
 }
 
+// serverURL is the address of the packs API.
+const serverURL = "http://localhost:8080"
+
+// httpDoer sends HTTP requests. *http.Client implements it, and tests supply fakes
+// returning canned responses.
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// failureKind tells how a failed request should be presented to the user.
+type failureKind int
+
+const (
+	failureClient  failureKind = iota // The server rejected the request, retrying won't help
+	failureServer                     // The server failed with a 5xx, a retry may succeed
+	failureNetwork                    // The server couldn't be reached, a retry may succeed
+)
+
+// requestError is a failed request, classified so the UI knows how to react.
+type requestError struct {
+	kind    failureKind
+	status  int    // HTTP status of the response, 0 when there was none
+	message string // Message shown to the user
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// retryable reports whether the request is worth offering to retry.
+func (e *requestError) retryable() bool {
+	return e.kind != failureClient
+}
+
+// classifyResponse returns the failure of a response, or nil when its status is 2xx.
+// 4xx responses carry the server's message, 5xx responses are offered a retry.
+func classifyResponse(status int, body []byte) *requestError {
+	switch {
+	case status < http.StatusMultipleChoices:
+		return nil
+	case status >= http.StatusInternalServerError:
+		return &requestError{kind: failureServer, status: status, message: "The server failed to handle the request (" + statusMessage(status, body) + "), please retry"}
+	default:
+		return &requestError{kind: failureClient, status: status, message: statusMessage(status, body)}
+	}
+}
+
+// classifyNetwork returns the failure of a request that got no response.
+func classifyNetwork(err error) *requestError {
+	return &requestError{kind: failureNetwork, message: "Unable to reach the server (" + err.Error() + "), check your connection and retry"}
+}
+
+// Requests answered with 429 or 503 and a Retry-After header are retried automatically
+// after the wait the server asks for, before the failure is shown.
+const (
+	maxAutoRetries = 3                // Automatic retries of a single request
+	maxRetryAfter  = 30 * time.Second // Longest Retry-After honored, longer waits fail straight away
+)
+
+// retryWait returns how long the server asks the client to wait before retrying a
+// response, from its Retry-After header holding either seconds or an HTTP date. It
+// reports false when the response shouldn't be retried automatically: any status
+// but 429 and 503, a missing or malformed header, or a wait above maxRetryAfter.
+func retryWait(status int, retryAfter string, now time.Time) (time.Duration, bool) {
+	if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable || retryAfter == "" {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(strings.TrimSpace(retryAfter)); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(retryAfter); err == nil {
+		wait = max(date.Sub(now), 0) // A date in the past means retry now
+	} else {
+		return 0, false
+	}
+
+	return wait, wait <= maxRetryAfter
+}
+
+// doRequest sends a request with an optional JSON payload to the server and returns
+// the response body, retrying up to maxAutoRetries times when the server asks for it
+// with Retry-After. Any failure is returned as a *requestError.
+func (c *calculator) doRequest(method, path string, payload interface{}) ([]byte, error) {
+	var encoded []byte
+	if payload != nil {
+		var err error
+		if encoded, err = json.Marshal(payload); err != nil {
+			return nil, &requestError{kind: failureClient, message: err.Error()}
+		}
+	}
+
+	sleep := c.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for retries := 0; ; retries++ {
+		resp, respBody, err := c.send(method, path, encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		if wait, ok := retryWait(resp.StatusCode, resp.Header.Get("Retry-After"), time.Now()); ok && retries < maxAutoRetries {
+			sleep(wait)
+			continue
+		}
+
+		if failure := classifyResponse(resp.StatusCode, respBody); failure != nil {
+			return nil, failure
+		}
+
+		return respBody, nil
+	}
+}
+
+// send makes a single attempt at a request, returning the response and its body.
+func (c *calculator) send(method, path string, payload []byte) (*http.Response, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, serverURL+path, body)
+	if err != nil {
+		return nil, nil, &requestError{kind: failureClient, message: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req) // Send request to server
+	if err != nil {
+		return nil, nil, classifyNetwork(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body) // Read response body
+	if err != nil {
+		return nil, nil, classifyNetwork(err)
+	}
+
+	return resp, respBody, nil
+}
+
+// fail shows a failed request inline. Server and network failures offer a Retry
+// button that runs again.
+func (c *calculator) fail(ctx app.Context, err error, again func(ctx app.Context)) {
+	failure, ok := err.(*requestError)
+	if !ok {
+		failure = &requestError{kind: failureClient, message: err.Error()}
+	}
+
+	ctx.Dispatch(func(ctx app.Context) {
+		c.errorMessage = failure.message
+		c.retry = nil
+		if failure.retryable() {
+			c.retry = again
+		}
+	})
+}
+
+// succeed clears the message of an earlier failed request.
+func (c *calculator) succeed(ctx app.Context) {
+	ctx.Dispatch(func(ctx app.Context) {
+		c.errorMessage = ""
+		c.retry = nil
+	})
+}
+
+// retryRequest re-runs the request that last failed with a server or network error.
+func (c *calculator) retryRequest(ctx app.Context, e app.Event) {
+	again := c.retry
+	c.retry = nil
+	c.errorMessage = ""
+	if again != nil {
+		again(ctx)
+	}
+}
+
 // getPacks retrieves the list of packs from the server.
 func (c *calculator) getPacks(ctx app.Context) {
 	ctx.Async(func() {
-		r, err := http.Get("http://localhost:8080/packs") // Fetch packs from server
+		resp, err := c.doRequest(http.MethodGet, "/packs", nil) // Fetch packs from server
 		if err != nil {
-			app.Log(err)
+			c.fail(ctx, err, c.getPacks)
 			return
 		}
-		defer r.Body.Close()
 
-		resp, err := io.ReadAll(r.Body) // Read response body
+		var packs []Pack
+		err = json.Unmarshal(resp, &packs) // Unmarshal JSON response into packs slice, already sorted largest first by the server
 		if err != nil {
 			app.Log(err)
 			return
 		}
 
-		var packs []Pack
-		err = json.Unmarshal([]byte(resp), &packs) // Unmarshal JSON response into packs slice
-		if err != nil {
-			log.Fatalf("Unable to marshal JSON due to %s", err)
-		}
-
-		sort.Slice(packs, func(i, j int) bool { // Sort packs by size in descending order
-			return packs[i].Size > packs[j].Size
-		})
-
 		ctx.Dispatch(func(ctx app.Context) { // Update component state with fetched packs
+			if !samePackSizes(c.packs, packs) {
+				c.clearResult() // The result was calculated with the old packs
+			}
 			c.packs = packs
 		})
 	})
@@ -74,196 +367,583 @@ func (c *calculator) getPacks(ctx app.Context) {
 // postPack sends a new pack to the server.
 func (c *calculator) postPack(ctx app.Context, pack Pack) {
 	ctx.Async(func() {
-		payload, err := json.Marshal(map[string]interface{}{
+		payload := map[string]interface{}{
 			"size": pack.Size,
-		})
-		if err != nil {
-			log.Fatal(err)
 		}
 
-		client := &http.Client{}
-		url := "http://localhost:8080/packs"
+		if _, err := c.doRequest(http.MethodPost, "/packs", payload); err != nil {
+			c.fail(ctx, err, func(ctx app.Context) { c.postPack(ctx, pack) })
+			return
+		}
 
-		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(payload)) // Create POST request
-		req.Header.Set("Content-Type", "application/json")
-		if err != nil {
-			log.Fatal(err)
+		c.succeed(ctx)
+		c.getPacks(ctx) // Refresh packs after adding new one
+	})
+}
+
+// putPack updates an existing pack on the server.
+func (c *calculator) putPack(ctx app.Context, pack Pack) {
+	ctx.Async(func() {
+		payload := map[string]interface{}{
+			"id":   pack.ID,
+			"size": pack.Size,
 		}
 
-		resp, err := client.Do(req) // Send request to server
-		if err != nil {
-			log.Fatal(err)
+		if _, err := c.doRequest(http.MethodPut, "/packs/"+pack.ID, payload); err != nil {
+			c.fail(ctx, err, func(ctx app.Context) { c.putPack(ctx, pack) })
+			return
 		}
 
-		defer resp.Body.Close()
+		c.succeed(ctx)
+		c.getPacks(ctx) // Refresh packs after updating one
+	})
+}
 
-		_, err = io.ReadAll(resp.Body) // Read response body
+// deletePack removes a pack from the server based on its ID.
+func (c *calculator) deletePack(ctx app.Context, e app.Event) {
+	id := ctx.JSSrc().Get("id").String() // Get ID from event source
+	c.remember(http.MethodDelete, id)
+	c.removePack(ctx, id)
+}
+
+// removePack sends the deletion of the pack with the given ID to the server.
+func (c *calculator) removePack(ctx app.Context, id string) {
+	ctx.Async(func() {
+		if _, err := c.doRequest(http.MethodDelete, "/packs/"+id, nil); err != nil {
+			c.fail(ctx, err, func(ctx app.Context) { c.removePack(ctx, id) })
+			return
+		}
+
+		c.succeed(ctx)
+		c.getPacks(ctx) // Refresh packs after deletion
+	})
+}
+
+// setPack sets the current pack based on user input.
+func (c *calculator) setPack(ctx app.Context, e app.Event) {
+	c.changePackSize(ctx.JSSrc().Get("id").String(), ctx.JSSrc().Get("value").String())
+}
+
+// changePackSize selects the pack with the given ID for an update to the typed size.
+func (c *calculator) changePackSize(id, value string) {
+	size, err := wholeNumber(value, "Pack size")
+	if err != nil {
+		c.errorMessage = err.Error()
+		return
+	}
+
+	c.currentPack.ID = id
+	c.currentPack.Size = size
+}
+
+// setNewPack sets a new pack size based on user input.
+func (c *calculator) setNewPack(ctx app.Context, e app.Event) {
+	c.changeNewPackSize(ctx.JSSrc().Get("value").String())
+}
+
+// changeNewPackSize validates the typed size of the pack to create. Only positive whole
+// numbers are accepted; anything else is explained next to the input and blank input
+// is left unexplained, and in both cases nothing can be added.
+func (c *calculator) changeNewPackSize(value string) {
+	c.newPackSize, c.newPackError = 0, ""
+
+	if strings.TrimSpace(value) == "" {
+		return // Nothing typed yet
+	}
+
+	size, err := wholeNumber(value, "Pack size")
+	if err != nil {
+		c.newPackError = err.Error()
+		return
+	}
+
+	if size < minPackSize {
+		c.newPackError = fmt.Sprintf("Pack size must be at least %d", minPackSize)
+		return
+	}
+
+	c.newPackSize = size
+}
+
+// validationClass returns the Bootstrap class marking an input invalid when it has a
+// validation message, or an empty class when it has none.
+func validationClass(message string) string {
+	if message != "" {
+		return "is-invalid"
+	}
+
+	return ""
+}
+
+// previewItems schedules a preview of the order being typed based on user input.
+func (c *calculator) previewItems(ctx app.Context, e app.Event) {
+	c.schedulePreview(ctx, ctx.JSSrc().Get("value").String())
+}
+
+// schedulePreview recomputes the order preview for the typed value once typing pauses
+// for previewDelay. Only the latest value is previewed, earlier ones are dropped.
+func (c *calculator) schedulePreview(ctx app.Context, value string) {
+	c.previewSeq++
+	seq := c.previewSeq
+
+	ctx.After(previewDelay, func(ctx app.Context) {
+		if seq != c.previewSeq {
+			return // A later keystroke scheduled its own preview
+		}
+
+		items, err := wholeNumber(value, "Items")
 		if err != nil {
-			log.Fatal(err)
+			c.preview = ""
+			return
 		}
 
-        c.getPacks(ctx) // Refresh packs after adding new one
-    })
+		packs, err := c.orderPacks()
+		if err != nil {
+			c.preview = ""
+			return
+		}
+
+		c.preview = orderPreview(packs, items, app.Getenv("UNIT_LABEL"))
+	})
 }
 
-// putPack updates an existing pack on the server.
-func (c *calculator) putPack(ctx app.Context, pack Pack) {
-	ctx.Async(func() {
-        payload, err := json.Marshal(map[string]interface{}{
-            "id":   pack.ID,
-            "size": pack.Size,
-        })
-        if err != nil {
-            log.Fatal(err)
-        }
+// orderPreview estimates what an order of items ships, or returns an empty string
+// when there is nothing to estimate or the order is out of bounds.
+func orderPreview(packs []Pack, items int, unit string) string {
+	if itemsError(items, maxItems()) != "" {
+		return ""
+	}
 
-        client := &http.Client{}
-        url := "http://localhost:8080/packs/" + pack.ID
+	quantities := calculate(packs, items)
+	if len(quantities) == 0 {
+		return ""
+	}
 
-        req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(payload)) // Create PUT request
-        req.Header.Set("Content-Type", "application/json")
-        if err != nil {
-            log.Fatal(err)
-        }
+	total, count := 0, 0
+	for _, pq := range quantities {
+		total += pq.Pack * pq.Quantity
+		count += pq.Quantity
+	}
 
-        resp, err := client.Do(req) // Send request to server
-        if err != nil {
-            log.Fatal(err)
-        }
+	if unit == "" {
+		unit = "items"
+	}
 
-        defer resp.Body.Close()
+	packsLabel := "packs"
+	if count == 1 {
+		packsLabel = "pack"
+	}
 
-        _, err = io.ReadAll(resp.Body) // Read response body
-        if err != nil {
-            log.Fatal(err)
-        }
+	return fmt.Sprintf("Will ship ~%d %s in %d %s", total, unit, count, packsLabel)
+}
 
-        c.getPacks(ctx) // Refresh packs after updating one
-    })
+// setItems sets the number of items based on user input.
+func (c *calculator) setItems(ctx app.Context, e app.Event) {
+	c.changeItems(ctx.JSSrc().Get("value").String())
 }
 
-// deletePack removes a pack from the server based on its ID.
-func (c *calculator) deletePack(ctx app.Context, e app.Event) {
-	id := ctx.JSSrc().Get("id").String() // Get ID from event source
-	ctx.Async(func() {
-        client := &http.Client{}
-        url := "http://localhost:8080/packs/" + id
+// changeItems sets the number of items to the typed number.
+func (c *calculator) changeItems(value string) {
+	items, err := wholeNumber(value, "Items")
+	if err != nil {
+		c.errorMessage = err.Error()
+		return
+	}
 
-        req, err := http.NewRequest(http.MethodDelete, url, nil) // Create DELETE request
-        req.Header.Set("Content-Type", "application/json")
-        if err != nil {
-            log.Fatal(err)
-        }
+	c.items = items
+}
 
-        resp, err := client.Do(req) // Send request to server
-        if err != nil {
-            log.Fatal(err)
-        }
+// wholeNumber parses a number typed into an input, naming the field in the error,
+// so a typo is reported inline instead of stopping the app.
+func wholeNumber(value, field string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number", field)
+	}
 
-        defer resp.Body.Close()
+	return n, nil
+}
 
-        _, err = io.ReadAll(resp.Body) // Read response body
-        if err != nil {
-            log.Fatal(err)
-        }
+// setAdHocPacks sets the ad-hoc pack sizes based on user input.
+func (c *calculator) setAdHocPacks(ctx app.Context, e app.Event) {
+	c.changeAdHocPacks(ctx.JSSrc().Get("value").String())
+}
 
-        c.getPacks(ctx) // Refresh packs after deletion
-    })
+// changeAdHocPacks sets the comma-separated ad-hoc pack sizes, parsed when calculating.
+// A result calculated with other sizes is cleared.
+func (c *calculator) changeAdHocPacks(text string) {
+	if text != c.adHocPacks {
+		c.clearResult()
+	}
+	c.adHocPacks = text
 }
 
-// setPack sets the current pack based on user input.
-func (c *calculator) setPack(ctx app.Context, e app.Event) {
-	id := ctx.JSSrc().Get("id").String() 
-	c.currentPack.ID = id 
-	sizeStr := ctx.JSSrc().Get("value").String() 
-	size, err := strconv.Atoi(sizeStr) 
-	if err != nil { 
-	    log.Fatalf("Unable to convert size to int %s", err)
-    } 
-	c.currentPack.Size = size 
+// clear removes the result of the last calculation based on user input.
+func (c *calculator) clear(ctx app.Context, e app.Event) {
+	c.clearResult()
 }
 
-// setNewPack sets a new pack size based on user input.
-func (c *calculator) setNewPack(ctx app.Context, e app.Event) { 
-	sizeStr := ctx.JSSrc().Get("value").String() 
-	size, err := strconv.Atoi(sizeStr) 
-	if err != nil { 
-	    log.Fatalf("Unable to convert size to int %s", err)
-    } 
-	c.currentPack.Size = size 
+// clearResult removes the result of the last calculation, along with the message
+// shown when it couldn't be filled exactly, so no stale breakdown stays on screen.
+func (c *calculator) clearResult() {
+	c.packQuantities = nil
+	c.unfillable = ""
 }
 
-// setItems sets the number of items based on user input.
-func (c *calculator) setItems(ctx app.Context, e app.Event) { 
-	itemsStr := ctx.JSSrc().Get("value").String() 
-	items, err := strconv.Atoi(itemsStr) 
-	if err != nil { 
-	    log.Fatalf("Unable to convert size to int %s", err)
-    } 
-	c.items = items 
+// samePackSizes reports whether two pack lists, both sorted by size, hold the same sizes.
+func samePackSizes(a, b []Pack) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Size != b[i].Size {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parsePackSizes parses comma-separated pack sizes into packs. Blank entries are
+// skipped, anything that is not a positive whole number is an error.
+func parsePackSizes(text string) ([]Pack, error) {
+	var packs []Pack
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		size, err := strconv.Atoi(field)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("Invalid pack size: %q", field)
+		}
+
+		packs = append(packs, Pack{Size: size})
+	}
+
+	return packs, nil
 }
 
 // calculatePacks calculates how many packs are needed for the given number of items.
+// Ad-hoc pack sizes, when entered, are used instead of the saved catalog.
 func (c *calculator) calculatePacks(ctx app.Context, e app.Event) { 
-	c.packQuantities = nil 
-	sort.Slice(c.packs, func(i, j int) bool { 
-	    return c.packs[i].Size > c.packs[j].Size 
-    })
+	if message := itemsError(c.items, maxItems()); message != "" {
+		c.errorMessage = message // Large orders stall the UI, so they are never calculated
+		return
+	}
+
+	packs, err := c.orderPacks()
+	if err != nil {
+		c.errorMessage = err.Error()
+		return
+	}
+
+	c.errorMessage = ""
+	c.unfillable = ""
+
+	if c.exactOnly {
+		c.calculateExact(ctx, packs, c.items)
+		return
+	}
+
+	c.packQuantities = calculate(packs, c.items)
+}
+
+// orderPacks returns the packs to calculate with: the ad-hoc sizes when entered,
+// otherwise the saved catalog.
+func (c *calculator) orderPacks() ([]Pack, error) {
+	if strings.TrimSpace(c.adHocPacks) == "" {
+		return c.packs, nil
+	}
+
+	return parsePackSizes(c.adHocPacks)
+}
+
+// setExactOnly sets whether orders must be filled exactly based on user input.
+func (c *calculator) setExactOnly(ctx app.Context, e app.Event) {
+	c.exactOnly = ctx.JSSrc().Get("checked").Bool()
+}
+
+// calculateExact asks the server to fill the order exactly from the given packs. When
+// it can't, the nearest quantities that can be filled are suggested instead.
+func (c *calculator) calculateExact(ctx app.Context, packs []Pack, items int) {
+	sizes := make([]int, 0, len(packs))
+	for _, pack := range packs {
+		sizes = append(sizes, pack.Size)
+	}
+
+	ctx.Async(func() {
+		payload := map[string]interface{}{
+			"depots": map[string][]int{"catalog": sizes}, // A single depot calculates with exactly these packs
+			"items":  items,
+			"mode":   "exact",
+		}
+
+		body, err := c.doRequest(http.MethodPost, "/calculate/combined", payload)
+		if failure, ok := err.(*requestError); ok && failure.status == http.StatusUnprocessableEntity { // The order can't be filled exactly
+			below, above := nearestFillable(packs, items)
+			ctx.Dispatch(func(ctx app.Context) {
+				c.packQuantities = nil
+				c.unfillable = unfillableMessage(items, below, above)
+			})
+			return
+		}
+		if err != nil {
+			c.fail(ctx, err, func(ctx app.Context) { c.calculateExact(ctx, packs, items) })
+			return
+		}
+
+		var result struct {
+			Packs []PackQuantity `json:"packs"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			app.Log(err)
+			return
+		}
+
+		ctx.Dispatch(func(ctx app.Context) {
+			c.packQuantities = result.Packs
+		})
+	})
+}
 
-	c.calculatePacksRecursive(c.items, 0)
+// nearestFillable returns the closest quantities at or below and at or above items
+// that whole packs fill exactly. Below is 0 when nothing smaller can be filled and
+// above is -1 when there are no packs.
+func nearestFillable(packs []Pack, items int) (below, above int) {
+	largest := 0
+	for _, pack := range packs {
+		largest = max(largest, pack.Size)
+	}
+
+	if items <= 0 || largest == 0 {
+		return 0, -1
+	}
+
+	// Any total at or beyond items+largest could drop a pack and still cover the order.
+	limit := items + largest
+	reachable := make([]bool, limit+1)
+	reachable[0] = true
+
+	for total := 1; total <= limit; total++ {
+		for _, pack := range packs {
+			if pack.Size > 0 && pack.Size <= total && reachable[total-pack.Size] {
+				reachable[total] = true
+				break
+			}
+		}
+	}
+
+	below, above = items, items
+	for !reachable[below] {
+		below-- // reachable[0] is always true, so this stops at an empty order
+	}
+	for !reachable[above] {
+		above++ // The smallest pack repeated always reaches a total within the limit
+	}
+
+	return below, above
+}
+
+// unfillableMessage explains that an order can't be filled exactly and suggests the nearest quantities that can.
+func unfillableMessage(items, below, above int) string {
+	message := strconv.Itoa(items) + " items can't be filled exactly with the available packs."
+	if above < 0 {
+		return message
+	}
+
+	if below > 0 {
+		return message + " Nearest fillable quantities: " + strconv.Itoa(below) + " or " + strconv.Itoa(above) + "."
+	}
+
+	return message + " Nearest fillable quantity: " + strconv.Itoa(above) + "."
+}
+
+// calculate returns the packs to send for an order: whole packs only, as few items
+// as possible and, for that number of items, as few packs as possible.
+//
+// Rather than filling greedily from the largest pack and patching the tail, it finds
+// every total reachable with whole packs. A remainder the smaller packs can't fill
+// is topped up to the smallest reachable total covering the order, and that total
+// is then re-minimized to its fewest packs.
+func calculate(packs []Pack, items int) []PackQuantity {
+	var sizes []int
+	for _, pack := range packs {
+		if pack.Size > 0 {
+			sizes = append(sizes, pack.Size)
+		}
+	}
+
+	if items <= 0 || len(sizes) == 0 {
+		return nil
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+	// Totals at or beyond items+largest could drop a pack and still cover the order.
+	limit := items + sizes[0] - 1
+	counts := make([]int, limit+1) // counts[t] is the fewest packs summing to t, -1 if unreachable
+	last := make([]int, limit+1)   // last[t] is the size of the pack added to reach t
+
+	for total := 1; total <= limit; total++ {
+		counts[total] = -1
+		for _, size := range sizes {
+			if size <= total && counts[total-size] >= 0 && (counts[total] < 0 || counts[total-size]+1 < counts[total]) {
+				counts[total] = counts[total-size] + 1
+				last[total] = size
+			}
+		}
+	}
+
+	total := items
+	for counts[total] < 0 {
+		total++ // Top up to the smallest reachable total
+	}
+
+	quantities := make(map[int]int)
+	for t := total; t > 0; t -= last[t] {
+		quantities[last[t]]++
+	}
+
+	var packQuantities []PackQuantity
+	for _, size := range sizes {
+		if quantities[size] > 0 {
+			packQuantities = append(packQuantities, PackQuantity{Pack: size, Quantity: quantities[size]})
+			delete(quantities, size) // Duplicate sizes are listed once
+		}
+	}
+
+	return packQuantities
 }
 
-// calculatePacksRecursive is a helper function that performs the actual calculation recursively.
-func (c *calculator) calculatePacksRecursive(items int, packIndex int) { 
-	if items <= 0 || packIndex >= len(c.packs) { 
-	    return 
-    }
+// toggleSort sorts the result table by column, flipping the direction when it is
+// already sorted by that column and starting ascending otherwise.
+func (c *calculator) toggleSort(column string) {
+	if c.sortColumn == column {
+		c.sortAscending = !c.sortAscending
+		return
+	}
 
-	pack := c.packs[packIndex]
+	c.sortColumn = column
+	c.sortAscending = true
+}
 
-	packCount := items / pack.Size 
+// sortBy returns an event handler sorting the result table by column.
+func (c *calculator) sortBy(column string) app.EventHandler {
+	return func(ctx app.Context, e app.Event) {
+		c.toggleSort(column)
+	}
+}
 
-	if packIndex == (len(c.packs)-1) && items-pack.Size > 0 { 
-	    pack.Size = c.packs[packIndex-1].Size 
-    }
+// packQuantityLess returns the comparator for sorting results by column in the given direction.
+func packQuantityLess(column string, ascending bool) func(a, b PackQuantity) bool {
+	value := func(pq PackQuantity) int { return pq.Pack }
+	if column == columnQuantity {
+		value = func(pq PackQuantity) int { return pq.Quantity }
+	}
 
-	if packCount > 0 { 
-	    c.packQuantities = append(c.packQuantities, PackQuantity{ 
-	        Pack: pack.Size,
-	        Quantity: packCount,
-	    }) 
+	if ascending {
+		return func(a, b PackQuantity) bool { return value(a) < value(b) }
+	}
 
-	    items -= packCount * pack.Size 
-    }
+	return func(a, b PackQuantity) bool { return value(a) > value(b) }
+}
 
-	if items > 0 { 
-	    if packIndex < len(c.packs)-1 { 
-	        c.calculatePacksRecursive(items, packIndex+1)
-	    } else { 
-	        nextPackSize := c.packs[packIndex].Size 
+// sortIndicator returns the arrow shown next to a sorted column header.
+func (c *calculator) sortIndicator(column string) string {
+	if c.sortColumn != column {
+		return ""
+	}
 
-	        c.packQuantities = append(c.packQuantities, PackQuantity{ 
-	            Pack: nextPackSize,
-	            Quantity: 1,
-	        }) 
+	if c.sortAscending {
+		return " ▲"
+	}
+
+	return " ▼"
+}
+
+// packQuantitiesToText serializes the result as a tab-separated plain-text table
+// with a header row, ready to paste into spreadsheets and other systems.
+func packQuantitiesToText(packQuantities []PackQuantity) string {
+	var b strings.Builder
+
+	b.WriteString("Pack\tQuantity\n")
+	for _, pq := range packQuantities {
+		b.WriteString(strconv.Itoa(pq.Pack) + "\t" + strconv.Itoa(pq.Quantity) + "\n")
+	}
+
+	return b.String()
+}
+
+// copyResult writes the result table to the clipboard.
+func (c *calculator) copyResult(ctx app.Context, e app.Event) {
+	app.Window().Get("navigator").Get("clipboard").Call("writeText", packQuantitiesToText(c.packQuantities))
+}
 
-	        items = 0  
-	    }
-    }
+// ariaSort returns the aria-sort value of a result column header.
+func (c *calculator) ariaSort(column string) string {
+	switch {
+	case c.sortColumn != column:
+		return "none"
+	case c.sortAscending:
+		return "ascending"
+	default:
+		return "descending"
+	}
 }
 
 // updatePack updates the current selected pack.
 func (c *calculator) updatePack(ctx app.Context, e app.Event) { 
+	c.remember(http.MethodPut, c.currentPack.ID)
 	c.putPack(ctx, c.currentPack)
 }
 
+// remember records the pack with the given ID as it is before a change, so the change can be undone.
+func (c *calculator) remember(method, id string) {
+	for _, pack := range c.packs {
+		if pack.ID == id {
+			c.lastMutation = &mutation{method: method, before: pack}
+			return
+		}
+	}
+}
+
+// undo reverts the last pack change by issuing its inverse request.
+func (c *calculator) undo(ctx app.Context, e app.Event) {
+	if c.lastMutation == nil {
+		return
+	}
+
+	method, pack := c.lastMutation.inverse()
+	c.lastMutation = nil
+
+	if method == http.MethodPost {
+		c.postPack(ctx, pack)
+		return
+	}
+	c.putPack(ctx, pack)
+}
+
 // createPack creates a new pack based on current input.
 func (c *calculator) createPack(ctx app.Context, e app.Event) { 
-	c.postPack(ctx, c.currentPack)
+	if c.newPackSize < minPackSize {
+		return // The Add button stays disabled until a valid size is typed
+	}
+
+	c.postPack(ctx, Pack{Size: c.newPackSize})
 }
 
 // Render defines how the component appears in the UI.
 func (c *calculator) Render() app.UI { 
+	if c.sortColumn != "" { // Re-sort the result table by the selected column
+		less := packQuantityLess(c.sortColumn, c.sortAscending)
+		sort.SliceStable(c.packQuantities, func(i, j int) bool {
+			return less(c.packQuantities[i], c.packQuantities[j])
+		})
+	}
+
 	return app.Div().Class("container text-center").Body( 
 	    app.Div().Class("row align-items-start").Body( 
 	        app.Div().Class("col").Body(  
@@ -279,18 +959,29 @@ func (c *calculator) Render() app.UI {
 	                        return app.Tr().Body(  
                                 app.Th().Scope("row").Body(  
                                     app.Div().Class("input-group flex-nowrap").Body(  
-                                        app.Input().Type("number").ID(c.packs[n].ID).Class("form-control").Placeholder(strconv.Itoa(c.packs[n].Size)).OnChange(c.setPack),  
-                                        app.Button().Class("btn btn-primary").Text("Update").OnClick(c.updatePack),  
-                                        app.Button().ID(c.packs[n].ID).Class("btn btn-danger").Text("Delete").OnClick(c.deletePack),  
+                                        app.Input().Type("number").ID(c.packs[n].ID).Class("form-control").Min(minPackSize).Attr("step", packSizeStep()).Placeholder(strconv.Itoa(c.packs[n].Size)).Aria("label", "Pack size "+strconv.Itoa(c.packs[n].Size)).OnChange(c.setPack),  
+                                        app.Button().Class("btn btn-primary").Text("Update").Aria("label", "Update pack size "+strconv.Itoa(c.packs[n].Size)).OnClick(c.updatePack),  
+                                        app.Button().ID(c.packs[n].ID).Class("btn btn-danger").Text("Delete").Aria("label", "Delete pack size "+strconv.Itoa(c.packs[n].Size)).OnClick(c.deletePack),  
                                     ),  
                                 ),  
                             )  
                         }),  
                         app.Th().Scope("row").Body(  
                             app.Div().Class("input-group flex-nowrap").Body(  
-                                app.Input().Type("number").Class("form-control").OnChange(c.setNewPack),  
-                                app.Button().Class("btn btn-success").Text("Add").OnClick(c.createPack),  
+                                app.Label().For("new-pack-size").Class("visually-hidden").Text("New pack size"),  
+                                app.Input().Type("number").ID("new-pack-size").Class("form-control", validationClass(c.newPackError)).Min(minPackSize).Attr("step", packSizeStep()).Placeholder("New pack size").Aria("invalid", c.newPackError != "").Aria("describedby", "new-pack-size-feedback").OnInput(c.setNewPack),  
+                                app.Button().Class("btn btn-success").Text("Add").Aria("label", "Add pack size").Disabled(c.newPackSize == 0).OnClick(c.createPack),  
+                                app.Button().Class("btn btn-outline-secondary").Text("Undo").Aria("label", "Undo last pack change").Disabled(c.lastMutation == nil).OnClick(c.undo),  
                             ),  
+                            app.Div().ID("new-pack-size-feedback").Class("invalid-feedback d-block text-start").Text(c.newPackError),
+                            app.If(c.errorMessage != "", func() app.UI {
+                                return app.Div().Class("alert alert-danger mt-2").Role("alert").Body(
+                                    app.Span().Text(c.errorMessage),
+                                    app.If(c.retry != nil, func() app.UI {
+                                        return app.Button().Class("btn btn-sm btn-outline-danger ms-2").Text("Retry").Aria("label", "Retry the failed request").OnClick(c.retryRequest)
+                                    }),
+                                )
+                            }),
                         ),  
                     ),  
                 ),  
@@ -298,15 +989,35 @@ func (c *calculator) Render() app.UI {
             app.Div().Class("col").Body(  
                 app.H1().Class("w-auto p-3").Text("Calculate packs for order"),  
                 app.Div().Class("input-group flex-nowrap").Body(  
-                    app.Span().Class("input-group-text").Text("Items: "),  
-                    app.Input().Type("number").Class("form-control").OnChange(c.setItems),  
-                    app.Button().Class("btn btn-success").Text("Calculate").OnClick(c.calculatePacks),  
+                    app.Label().For("order-items").Class("input-group-text").Text(itemsLabel(app.Getenv("UNIT_LABEL"))),  
+                    app.Input().Type("number").ID("order-items").Class("form-control").Min(0).Max(maxItems()).OnChange(c.setItems).OnInput(c.previewItems),  
+                    app.Button().Class("btn btn-success").Text("Calculate").Aria("label", "Calculate packs for order").OnClick(c.calculatePacks),  
+                    app.Button().Class("btn btn-outline-secondary").Text("Copy").Aria("label", "Copy result to clipboard").Disabled(len(c.packQuantities) == 0).OnClick(c.copyResult),  
+                    app.Button().Class("btn btn-outline-secondary").Text("Clear").Aria("label", "Clear result").Disabled(len(c.packQuantities) == 0 && c.unfillable == "").OnClick(c.clear),  
+                ),  
+                app.If(c.preview != "", func() app.UI {  
+                    return app.Div().ID("order-preview").Class("form-text text-start").Aria("live", "polite").Text(c.preview)  
+                }),  
+                app.Div().Class("form-check mt-2").Body(  
+                    app.Input().Type("checkbox").ID("exact-only").Class("form-check-input").Checked(c.exactOnly).OnChange(c.setExactOnly),  
+                    app.Label().For("exact-only").Class("form-check-label").Text("Exact quantities only"),  
+                ),  
+                app.If(c.unfillable != "", func() app.UI {  
+                    return app.Div().Class("alert alert-warning mt-2").Role("status").Text(c.unfillable)  
+                }),  
+                app.Div().Class("mt-2").Body(  
+                    app.Label().For("ad-hoc-packs").Class("form-label").Text("Ad-hoc pack sizes (optional): "),  
+                    app.Textarea().ID("ad-hoc-packs").Class("form-control").Rows(2).Placeholder("e.g. 23, 31, 53").Text(c.adHocPacks).OnChange(c.setAdHocPacks),  
                 ),  
-                app.Table().Class("table").Body(  
+                app.Table().Class("table").Aria("label", "Packs for order").Aria("live", "polite").Body(  
                     app.THead().Body(  
                         app.Tr().Body(  
-                            app.Th().Class("text-start").Scope("col").Text("Pack"),  
-                            app.Th().Class("text-start").Scope("col").Text("Quantity"),  
+                            app.Th().Class("text-start").Scope("col").Aria("sort", c.ariaSort(columnPack)).Body(  
+                                app.Button().Class("btn btn-link p-0 text-reset text-decoration-none").Text("Pack"+c.sortIndicator(columnPack)).OnClick(c.sortBy(columnPack)),  
+                            ),  
+                            app.Th().Class("text-start").Scope("col").Aria("sort", c.ariaSort(columnQuantity)).Body(  
+                                app.Button().Class("btn btn-link p-0 text-reset text-decoration-none").Text("Quantity"+c.sortIndicator(columnQuantity)).OnClick(c.sortBy(columnQuantity)),  
+                            ),  
                         ),  
                     ),   
                     app.TBody().Body(   
@@ -314,12 +1025,12 @@ func (c *calculator) Render() app.UI {
                             return app.Tr().Body(   
                                 app.Th().Scope("row").Body(   
                                     app.Div().Class("input-group flex-nowrap").Body(   
-                                        app.Input().Type("number").Class("form-control").Placeholder(strconv.Itoa(c.packQuantities[n].Pack)),   
+                                        app.Input().Type("number").Class("form-control").ReadOnly(true).TabIndex(-1).Aria("label", "Pack").Placeholder(strconv.Itoa(c.packQuantities[n].Pack)),   
                                     ),   
                                 ),   
                                 app.Th().Scope("row").Body(   
                                     app.Div().Class("input-group flex-nowrap").Body(   
-                                        app.Input().Type("number").Class("form-control").Placeholder(strconv.Itoa(c.packQuantities[n].Quantity)),   
+                                        app.Input().Type("number").Class("form-control").ReadOnly(true).TabIndex(-1).Aria("label", "Quantity").Placeholder(strconv.Itoa(c.packQuantities[n].Quantity)),   
                                     ),   
                                 ),   
                             )   
@@ -331,6 +1042,54 @@ func (c *calculator) Render() app.UI {
     )   
 } 
 
+// gzipResponseWriter compresses everything written to the response.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writer *gzip.Writer
+}
+
+// WriteHeader drops the length set for the uncompressed body before sending the headers.
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write compresses b into the response.
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	return w.writer.Write(b)
+}
+
+// compress serves gzip encoded responses to browsers that accept them. A precompressed
+// copy of a static asset under dir, e.g. web/app.wasm.gz, is served as is and anything
+// else is compressed on the fly.
+func compress(dir string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+
+		precompressed := filepath.Join(dir, filepath.FromSlash(path.Clean(r.URL.Path))+".gz")
+		if info, err := os.Stat(precompressed); err == nil && !info.IsDir() {
+			if contentType := mime.TypeByExtension(path.Ext(r.URL.Path)); contentType != "" {
+				w.Header().Set("Content-Type", contentType) // Keep the type of the asset rather than gzip
+			}
+			http.ServeFile(w, r, precompressed)
+			return
+		}
+
+		writer := gzip.NewWriter(w)
+		defer writer.Close()
+
+		h.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, writer: writer}, r)
+	})
+}
+
 // The main function is the entry point where the application is configured and started.
 // It is executed in two different environments: a client (the web browser)
 // and a server.
@@ -339,7 +1098,7 @@ func main() {
 
 	app.RunWhenOnBrowser() 
 
-	http.Handle("/", &app.Handler{    
+	http.Handle("/", compress(".", &app.Handler{    
     	Name: "Order Packs Calculator",    
     	Description: "Display packs and calculate packs for orders",    
     	Styles: []string{    
@@ -348,7 +1107,12 @@ func main() {
     	Scripts: []string{    
         	"https://cdn.jsdelivr.net/npm/bootstrap@5.3.3/dist/js/bootstrap.bundle.min.js",    
     	},    
-    })    
+    	Env: map[string]string{
+    		"UNIT_LABEL": os.Getenv("UNIT_LABEL"), // Label of the items being packed, e.g. cans
+    		"MAX_ITEMS":  os.Getenv("MAX_ITEMS"),  // Largest order calculated, matching the server
+    		"PACK_SIZE_STEP": os.Getenv("PACK_SIZE_STEP"), // Increment of the pack size steppers
+    	},
+    }))    
 
 	if err := http.ListenAndServe(":5000", nil); err != nil {    
     	log.Fatal(err)    
@@ -0,0 +1,943 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxence-charriere/go-app/v10/pkg/app"
+)
+
+func TestStatusMessage(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		expected string
+	}{
+		{http.StatusConflict, `{"error": "pack size already exists"}`, "Pack size already exists"},
+		{http.StatusBadRequest, `{"error": "Invalid sort: oldest"}`, "Invalid sort: oldest"},
+		{http.StatusInternalServerError, `not json`, "Internal Server Error"},
+		{http.StatusNotFound, `{}`, "Not Found"},
+	}
+
+	for _, test := range tests {
+		if got := statusMessage(test.status, []byte(test.body)); got != test.expected {
+			t.Errorf("statusMessage(%d): expected %q, got %q", test.status, test.expected, got)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	packs := []Pack{{Size: 250}, {Size: 500}, {Size: 1000}, {Size: 2000}, {Size: 5000}}
+
+	tests := []struct {
+		packs    []Pack
+		items    int
+		expected []PackQuantity
+	}{
+		{packs, 1, []PackQuantity{{Pack: 250, Quantity: 1}}},
+		{packs, 251, []PackQuantity{{Pack: 500, Quantity: 1}}},
+		{packs, 501, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}},
+		{packs, 12001, []PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}}},
+		// Regression: the old tail top-up sent two 500s instead of a single 1000
+		{packs, 760, []PackQuantity{{Pack: 1000, Quantity: 1}}},
+		// Regression: the old tail top-up sent 5000 and two 500s instead of 5000 and 1000
+		{packs, 5760, []PackQuantity{{Pack: 5000, Quantity: 1}, {Pack: 1000, Quantity: 1}}},
+		// Regression: a single pack size indexed the pack before the first and panicked
+		{[]Pack{{Size: 250}}, 300, []PackQuantity{{Pack: 250, Quantity: 2}}},
+		// Greedy filling overships here, 23+31 fills 54 exactly
+		{[]Pack{{Size: 23}, {Size: 31}, {Size: 53}}, 54, []PackQuantity{{Pack: 31, Quantity: 1}, {Pack: 23, Quantity: 1}}},
+		{packs, 0, nil},
+		{nil, 10, nil},
+	}
+
+	for _, test := range tests {
+		if got := calculate(test.packs, test.items); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("calculate(%v, %d): expected %v, got %v", test.packs, test.items, test.expected, got)
+		}
+	}
+}
+
+func TestToggleSort(t *testing.T) {
+	c := &calculator{}
+
+	steps := []struct {
+		column    string
+		ascending bool
+	}{
+		{columnPack, true},      // A new column starts ascending
+		{columnPack, false},     // Clicking it again flips the direction
+		{columnQuantity, true},  // Switching columns starts ascending again
+		{columnQuantity, false},
+		{columnQuantity, true},
+	}
+
+	for i, step := range steps {
+		c.toggleSort(step.column)
+
+		if c.sortColumn != step.column || c.sortAscending != step.ascending {
+			t.Errorf("Step %d: expected %s ascending=%v, got %s ascending=%v", i, step.column, step.ascending, c.sortColumn, c.sortAscending)
+		}
+	}
+}
+
+func TestPackQuantityLess(t *testing.T) {
+	results := []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 3}, {Pack: 1000, Quantity: 2}}
+
+	tests := []struct {
+		column    string
+		ascending bool
+		expected  []int // Pack sizes in the expected order
+	}{
+		{columnPack, true, []int{250, 500, 1000}},
+		{columnPack, false, []int{1000, 500, 250}},
+		{columnQuantity, true, []int{500, 1000, 250}},
+		{columnQuantity, false, []int{250, 1000, 500}},
+	}
+
+	for _, test := range tests {
+		sorted := append([]PackQuantity(nil), results...)
+		less := packQuantityLess(test.column, test.ascending)
+		sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+
+		var sizes []int
+		for _, pq := range sorted {
+			sizes = append(sizes, pq.Pack)
+		}
+
+		if !reflect.DeepEqual(sizes, test.expected) {
+			t.Errorf("%s ascending=%v: expected %v, got %v", test.column, test.ascending, test.expected, sizes)
+		}
+	}
+}
+
+func TestPackQuantitiesToText(t *testing.T) {
+	tests := []struct {
+		packQuantities []PackQuantity
+		expected       string
+	}{
+		{nil, "Pack\tQuantity\n"},
+		{[]PackQuantity{{Pack: 250, Quantity: 1}}, "Pack\tQuantity\n250\t1\n"},
+		{
+			[]PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}},
+			"Pack\tQuantity\n5000\t2\n2000\t1\n250\t1\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got := packQuantitiesToText(test.packQuantities); got != test.expected {
+			t.Errorf("packQuantitiesToText(%v): expected %q, got %q", test.packQuantities, test.expected, got)
+		}
+	}
+}
+
+func TestRenderAccessibility(t *testing.T) {
+	c := &calculator{
+		packs:          []Pack{{ID: "pack-250", Size: 250}},
+		packQuantities: []PackQuantity{{Pack: 250, Quantity: 1}},
+		sortColumn:     columnPack,
+		sortAscending:  true,
+	}
+
+	html := app.HTMLString(c)
+
+	expected := []string{
+		`aria-label="Pack size 250"`,
+		`aria-label="Update pack size 250"`,
+		`aria-label="Delete pack size 250"`,
+		`for="new-pack-size"`,
+		`id="new-pack-size"`,
+		`for="order-items"`,
+		`id="order-items"`,
+		`aria-label="Calculate packs for order"`,
+		`aria-sort="ascending"`,
+		`aria-sort="none"`,
+		`aria-live="polite"`,
+	}
+
+	for _, attribute := range expected {
+		if !strings.Contains(html, attribute) {
+			t.Errorf("Expected rendered HTML to contain %s", attribute)
+		}
+	}
+}
+
+func TestRenderPackSizeSteppers(t *testing.T) {
+	c := &calculator{packs: []Pack{{ID: "pack-250", Size: 250}}}
+
+	html := app.HTMLString(c)
+	for _, input := range []string{`id="pack-250"`, `id="new-pack-size"`} {
+		start := strings.Index(html, input)
+		if start < 0 {
+			t.Fatalf("Expected an input with %s, got %s", input, html)
+		}
+
+		tag := html[strings.LastIndex(html[:start], "<"):]
+		tag = tag[:strings.Index(tag, ">")]
+		for _, attribute := range []string{`min="1"`, `step="1"`} {
+			if !strings.Contains(tag, attribute) {
+				t.Errorf("Expected %s to carry %s, got %s", input, attribute, tag)
+			}
+		}
+	}
+
+	if got := packSizeStep(); got != 1 {
+		t.Errorf("Expected the step to default to 1, got %d", got)
+	}
+}
+
+func TestParsePackSizes(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []int
+		valid    bool
+	}{
+		{"23, 31, 53", []int{23, 31, 53}, true},
+		{"250,500,,1000, ", []int{250, 500, 1000}, true},
+		{"", nil, true},
+		{"250, abc", nil, false},
+		{"250, 0", nil, false},
+		{"-5", nil, false},
+		{"2.5", nil, false},
+	}
+
+	for _, test := range tests {
+		packs, err := parsePackSizes(test.text)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parsePackSizes(%q): expected an error", test.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePackSizes(%q): unexpected error %v", test.text, err)
+			continue
+		}
+
+		var sizes []int
+		for _, pack := range packs {
+			sizes = append(sizes, pack.Size)
+		}
+		if !reflect.DeepEqual(sizes, test.expected) {
+			t.Errorf("parsePackSizes(%q): expected %v, got %v", test.text, test.expected, sizes)
+		}
+	}
+}
+
+func TestMutationInverse(t *testing.T) {
+	before := Pack{ID: "pack-250", Size: 250}
+
+	tests := []struct {
+		mutation       mutation
+		expectedMethod string
+		expectedPack   Pack
+	}{
+		{mutation{method: http.MethodDelete, before: before}, http.MethodPost, Pack{Size: 250}},
+		{mutation{method: http.MethodPut, before: before}, http.MethodPut, before},
+	}
+
+	for _, test := range tests {
+		method, pack := test.mutation.inverse()
+		if method != test.expectedMethod || pack != test.expectedPack {
+			t.Errorf("inverse of %s: expected %s %+v, got %s %+v", test.mutation.method, test.expectedMethod, test.expectedPack, method, pack)
+		}
+	}
+}
+
+func TestRemember(t *testing.T) {
+	c := &calculator{packs: []Pack{{ID: "pack-250", Size: 250}, {ID: "pack-500", Size: 500}}}
+
+	c.remember(http.MethodPut, "pack-500")
+	if c.lastMutation == nil || c.lastMutation.before != (Pack{ID: "pack-500", Size: 500}) {
+		t.Fatalf("Expected the pack before the change to be remembered, got %+v", c.lastMutation)
+	}
+
+	c.remember(http.MethodDelete, "missing")
+	if c.lastMutation.method != http.MethodPut {
+		t.Errorf("Expected an unknown pack to leave the last mutation unchanged, got %+v", c.lastMutation)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "web"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var precompressed bytes.Buffer
+	writer := gzip.NewWriter(&precompressed)
+	writer.Write([]byte("wasm binary"))
+	writer.Close()
+	if err := os.WriteFile(filepath.Join(dir, "web", "app.wasm.gz"), precompressed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := compress(dir, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4")
+		w.Write([]byte("page"))
+	}))
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		encoding       string
+		contentType    string
+		body           string
+	}{
+		{"/", "gzip, deflate, br", "gzip", "", "page"},
+		{"/", "", "", "", "page"},
+		{"/web/app.wasm", "gzip", "gzip", "application/wasm", "wasm binary"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s with %q: expected Content-Encoding %q, got %q", test.path, test.acceptEncoding, test.encoding, got)
+		}
+		if test.contentType != "" && rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", test.path, test.contentType, rec.Header().Get("Content-Type"))
+		}
+
+		body := rec.Body.Bytes()
+		if test.encoding == "gzip" {
+			reader, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("%s: response is not gzip encoded: %v", test.path, err)
+			}
+			if body, err = io.ReadAll(reader); err != nil {
+				t.Fatalf("%s: failed to decompress response: %v", test.path, err)
+			}
+		}
+		if string(body) != test.body {
+			t.Errorf("%s with %q: expected body %q, got %q", test.path, test.acceptEncoding, test.body, body)
+		}
+	}
+}
+
+func TestItemsError(t *testing.T) {
+	tests := []struct {
+		items    int
+		max      int
+		expected string
+	}{
+		{0, 100, ""},
+		{100, 100, ""},
+		{101, 100, "Items must not exceed 100"},
+		{-1, 100, "Items must not be negative"},
+	}
+
+	for _, test := range tests {
+		if got := itemsError(test.items, test.max); got != test.expected {
+			t.Errorf("itemsError(%d, %d): expected %q, got %q", test.items, test.max, test.expected, got)
+		}
+	}
+
+	if got := maxItems(); got != defaultMaxItems {
+		t.Errorf("Expected maxItems to default to %d, got %d", defaultMaxItems, got)
+	}
+}
+
+func TestNearestFillable(t *testing.T) {
+	tests := []struct {
+		packs []Pack
+		items int
+		below int
+		above int
+	}{
+		{[]Pack{{Size: 3}, {Size: 5}}, 7, 6, 8},
+		{[]Pack{{Size: 3}, {Size: 5}}, 8, 8, 8},
+		{[]Pack{{Size: 250}, {Size: 500}}, 251, 250, 500},
+		{[]Pack{{Size: 250}}, 1, 0, 250},
+		{nil, 10, 0, -1},
+	}
+
+	for _, test := range tests {
+		below, above := nearestFillable(test.packs, test.items)
+		if below != test.below || above != test.above {
+			t.Errorf("nearestFillable(%v, %d): expected %d and %d, got %d and %d", test.packs, test.items, test.below, test.above, below, above)
+		}
+	}
+}
+
+func TestUnfillableMessage(t *testing.T) {
+	tests := []struct {
+		items, below, above int
+		expected            string
+	}{
+		{7, 6, 8, "7 items can't be filled exactly with the available packs. Nearest fillable quantities: 6 or 8."},
+		{1, 0, 250, "1 items can't be filled exactly with the available packs. Nearest fillable quantity: 250."},
+		{10, 0, -1, "10 items can't be filled exactly with the available packs."},
+	}
+
+	for _, test := range tests {
+		if got := unfillableMessage(test.items, test.below, test.above); got != test.expected {
+			t.Errorf("unfillableMessage(%d, %d, %d): expected %q, got %q", test.items, test.below, test.above, test.expected, got)
+		}
+	}
+}
+
+func TestClassifyResponse(t *testing.T) {
+	tests := []struct {
+		status    int
+		body      string
+		kind      failureKind
+		message   string
+		retryable bool
+	}{
+		{http.StatusBadRequest, `{"error": "Invalid pack size"}`, failureClient, "Invalid pack size", false},
+		{http.StatusConflict, `{"error": "pack size already exists"}`, failureClient, "Pack size already exists", false},
+		{http.StatusUnprocessableEntity, ``, failureClient, "Unprocessable Entity", false},
+		{http.StatusInternalServerError, `{"error": "database down"}`, failureServer, "The server failed to handle the request (database down), please retry", true},
+		{http.StatusServiceUnavailable, ``, failureServer, "The server failed to handle the request (Service Unavailable), please retry", true},
+	}
+
+	for _, test := range tests {
+		failure := classifyResponse(test.status, []byte(test.body))
+		if failure == nil {
+			t.Errorf("Status %d: expected a failure", test.status)
+			continue
+		}
+
+		if failure.kind != test.kind || failure.status != test.status || failure.message != test.message || failure.retryable() != test.retryable {
+			t.Errorf("Status %d: expected kind %d %q retryable %t, got %+v", test.status, test.kind, test.message, test.retryable, failure)
+		}
+	}
+
+	for _, status := range []int{http.StatusOK, http.StatusCreated, http.StatusNoContent} {
+		if failure := classifyResponse(status, nil); failure != nil {
+			t.Errorf("Status %d: expected no failure, got %+v", status, failure)
+		}
+	}
+}
+
+func TestClassifyNetwork(t *testing.T) {
+	failure := classifyNetwork(errors.New("connection refused"))
+
+	if failure.kind != failureNetwork || failure.status != 0 || !failure.retryable() {
+		t.Errorf("Expected a retryable network failure without a status, got %+v", failure)
+	}
+
+	if !strings.Contains(failure.Error(), "connection refused") {
+		t.Errorf("Expected the cause in the message, got %q", failure.Error())
+	}
+}
+
+// contextCatcher is a component that keeps the context it is rendered with, so
+// event handlers can be called in tests the way the browser would call them.
+// Outside the browser go-app pre-renders components instead of mounting them.
+type contextCatcher struct {
+	app.Compo
+	ctx     app.Context
+	mounted bool
+}
+
+func (c *contextCatcher) OnPreRender(ctx app.Context) {
+	c.ctx = ctx
+	c.mounted = true
+}
+
+// testContext mounts a contextCatcher on a test engine and returns its context.
+func testContext(t *testing.T) (app.Context, app.TestEngine) {
+	t.Helper()
+
+	engine := app.NewTestEngine()
+	catcher := &contextCatcher{}
+	if err := engine.Load(catcher); err != nil {
+		t.Fatalf("Failed to mount component: %v", err)
+	}
+	engine.ConsumeAll()
+
+	if !catcher.mounted {
+		t.Fatal("Expected the component to be mounted")
+	}
+
+	return catcher.ctx, engine
+}
+
+func TestCalculatorCalculateFlow(t *testing.T) {
+	ctx, engine := testContext(t)
+	c := &calculator{packs: []Pack{{ID: "a", Size: 1000}, {ID: "b", Size: 500}, {ID: "c", Size: 250}}}
+
+	c.changeItems("501")
+	c.calculatePacks(ctx, app.Event{})
+	engine.ConsumeAll()
+
+	expected := []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}
+	if c.items != 501 || !reflect.DeepEqual(c.packQuantities, expected) || c.errorMessage != "" {
+		t.Fatalf("Expected 501 items packed as %+v, got %d %+v %q", expected, c.items, c.packQuantities, c.errorMessage)
+	}
+
+	html := app.HTMLString(c)
+	for _, cell := range []string{`placeholder="500"`, `placeholder="250"`} {
+		if !strings.Contains(html, cell) {
+			t.Errorf("Expected the result table to contain %s", cell)
+		}
+	}
+
+	// Ad-hoc sizes replace the catalog
+	c.changeAdHocPacks("300, 700")
+	c.calculatePacks(ctx, app.Event{})
+
+	if expected := []PackQuantity{{Pack: 300, Quantity: 2}}; !reflect.DeepEqual(c.packQuantities, expected) {
+		t.Errorf("Expected the ad-hoc packs to give %+v, got %+v", expected, c.packQuantities)
+	}
+
+	// Sorting by a column toggles on repeated clicks
+	c.sortBy(columnQuantity)(ctx, app.Event{})
+	c.sortBy(columnQuantity)(ctx, app.Event{})
+	if c.sortColumn != columnQuantity || c.sortAscending {
+		t.Errorf("Expected a descending sort by quantity, got %q ascending %t", c.sortColumn, c.sortAscending)
+	}
+}
+
+func TestCalculatorClearResult(t *testing.T) {
+	ctx, engine := testContext(t)
+
+	packs := `[{"id":"a","size":1000},{"id":"b","size":500}]`
+	client := &fakeDoer{respond: func(req *http.Request) (*http.Response, error) {
+		return cannedResponse(http.StatusOK, packs), nil
+	}}
+	c := &calculator{client: client, packs: []Pack{{ID: "a", Size: 1000}, {ID: "b", Size: 500}}}
+
+	c.changeItems("501")
+	c.calculatePacks(ctx, app.Event{})
+	c.unfillable = "stale"
+
+	// The Clear button removes the result and any message about it
+	c.clear(ctx, app.Event{})
+	if c.packQuantities != nil || c.unfillable != "" {
+		t.Errorf("Expected the result to be cleared, got %+v %q", c.packQuantities, c.unfillable)
+	}
+	if html := app.HTMLString(c); !strings.Contains(html, `aria-label="Clear result" disabled`) {
+		t.Errorf("Expected the Clear button to be disabled without a result, got %s", html)
+	}
+
+	// Refreshing the same packs keeps the result
+	c.calculatePacks(ctx, app.Event{})
+	c.getPacks(ctx)
+	engine.ConsumeAll()
+
+	if len(c.packQuantities) == 0 {
+		t.Error("Expected the result to survive a refresh with unchanged packs")
+	}
+
+	// Packs changing on the server clear it
+	packs = `[{"id":"a","size":1000},{"id":"b","size":500},{"id":"c","size":250}]`
+	c.getPacks(ctx)
+	engine.ConsumeAll()
+
+	if c.packQuantities != nil || len(c.packs) != 3 {
+		t.Errorf("Expected the result to be cleared when the packs change, got %+v with %+v", c.packQuantities, c.packs)
+	}
+
+	// So do edited ad-hoc sizes, but not the same sizes entered again
+	c.changeAdHocPacks("300, 700")
+	c.calculatePacks(ctx, app.Event{})
+	c.changeAdHocPacks("300, 700")
+	if len(c.packQuantities) == 0 {
+		t.Error("Expected unchanged ad-hoc sizes to keep the result")
+	}
+
+	c.changeAdHocPacks("300")
+	if c.packQuantities != nil {
+		t.Errorf("Expected edited ad-hoc sizes to clear the result, got %+v", c.packQuantities)
+	}
+}
+
+func TestOrderPreview(t *testing.T) {
+	packs := []Pack{{Size: 1000}, {Size: 500}, {Size: 250}}
+
+	tests := []struct {
+		packs    []Pack
+		items    int
+		unit     string
+		expected string
+	}{
+		{packs, 501, "", "Will ship ~750 items in 2 packs"},
+		{packs, 250, "cans", "Will ship ~250 cans in 1 pack"},
+		{packs, 12001, "", "Will ship ~12250 items in 13 packs"},
+		{packs, 0, "", ""},
+		{packs, -5, "", ""},
+		{packs, defaultMaxItems + 1, "", ""}, // Too large to calculate
+		{nil, 501, "", ""},
+	}
+
+	for _, test := range tests {
+		if got := orderPreview(test.packs, test.items, test.unit); got != test.expected {
+			t.Errorf("orderPreview(%v, %d, %q): expected %q, got %q", test.packs, test.items, test.unit, test.expected, got)
+		}
+	}
+}
+
+func TestCalculatorPreviewDebounce(t *testing.T) {
+	ctx, engine := testContext(t)
+	c := &calculator{packs: []Pack{{ID: "a", Size: 500}, {ID: "b", Size: 250}}}
+
+	// Only the value typed last is previewed
+	c.schedulePreview(ctx, "5")
+	c.schedulePreview(ctx, "50")
+	c.schedulePreview(ctx, "501")
+	if c.preview != "" {
+		t.Errorf("Expected no preview before typing pauses, got %q", c.preview)
+	}
+
+	engine.ConsumeAll()
+	if c.preview != "Will ship ~750 items in 2 packs" {
+		t.Errorf("Expected the preview of 501 items, got %q", c.preview)
+	}
+	if html := app.HTMLString(c); !strings.Contains(html, "Will ship ~750 items in 2 packs") {
+		t.Errorf("Expected the preview next to the order input, got %s", html)
+	}
+
+	// Ad-hoc sizes are previewed as they are calculated
+	c.changeAdHocPacks("300")
+	c.schedulePreview(ctx, "501")
+	engine.ConsumeAll()
+	if c.preview != "Will ship ~600 items in 2 packs" {
+		t.Errorf("Expected the preview with the ad-hoc sizes, got %q", c.preview)
+	}
+
+	c.schedulePreview(ctx, "lots")
+	engine.ConsumeAll()
+	if c.preview != "" {
+		t.Errorf("Expected no preview for a typo, got %q", c.preview)
+	}
+}
+
+func TestCalculatorErrorPaths(t *testing.T) {
+	ctx, engine := testContext(t)
+
+	tests := []struct {
+		name     string
+		act      func(c *calculator)
+		expected string
+	}{
+		{"typo in items", func(c *calculator) { c.changeItems("5o1") }, "Items must be a whole number"},
+		{"typo in edited pack", func(c *calculator) { c.changePackSize("a", "big") }, "Pack size must be a whole number"},
+		{"negative order", func(c *calculator) {
+			c.changeItems("-1")
+			c.calculatePacks(ctx, app.Event{})
+		}, "Items must not be negative"},
+		{"order too large", func(c *calculator) {
+			c.changeItems(strconv.Itoa(defaultMaxItems + 1))
+			c.calculatePacks(ctx, app.Event{})
+		}, "Items must not exceed " + strconv.Itoa(defaultMaxItems)},
+		{"invalid ad-hoc packs", func(c *calculator) {
+			c.changeItems("10")
+			c.changeAdHocPacks("250, x")
+			c.calculatePacks(ctx, app.Event{})
+		}, `Invalid pack size: "x"`},
+	}
+
+	for _, test := range tests {
+		c := &calculator{packs: []Pack{{ID: "a", Size: 250}}, items: 7}
+		test.act(c)
+		engine.ConsumeAll()
+
+		if c.errorMessage != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, c.errorMessage)
+			continue
+		}
+
+		if !strings.Contains(app.HTMLString(c), `role="alert"`) {
+			t.Errorf("%s: expected the error to be rendered as an alert", test.name)
+		}
+	}
+
+	// A typo leaves the previous value in place
+	c := &calculator{items: 7}
+	c.changeItems("seven")
+	if c.items != 7 {
+		t.Errorf("Expected items to stay 7 after a typo, got %d", c.items)
+	}
+}
+
+func TestCalculatorNewPackValidation(t *testing.T) {
+	ctx, engine := testContext(t)
+
+	client := &fakeDoer{respond: func(req *http.Request) (*http.Response, error) {
+		return cannedResponse(http.StatusOK, `[]`), nil
+	}}
+	c := &calculator{client: client}
+
+	tests := []struct {
+		value    string
+		size     int
+		expected string
+	}{
+		{"", 0, ""},
+		{"1.5", 0, "Pack size must be a whole number"},
+		{"big", 0, "Pack size must be a whole number"},
+		{"0", 0, "Pack size must be at least 1"},
+		{"-250", 0, "Pack size must be at least 1"},
+		{" 250 ", 250, ""},
+		{"", 0, ""}, // Clearing a valid size disables Add again
+	}
+
+	for _, test := range tests {
+		c.changeNewPackSize(test.value)
+
+		if c.newPackSize != test.size || c.newPackError != test.expected {
+			t.Errorf("%q: expected size %d and %q, got %d and %q", test.value, test.size, test.expected, c.newPackSize, c.newPackError)
+		}
+
+		html := app.HTMLString(c)
+		if disabled := buttonDisabled(html, "Add pack size"); disabled != (test.size == 0) {
+			t.Errorf("%q: expected the Add button disabled %t, got %s", test.value, test.size == 0, html)
+		}
+		if invalid := strings.Contains(html, `is-invalid`); invalid != (test.expected != "") {
+			t.Errorf("%q: expected the input marked invalid %t, got %s", test.value, test.expected != "", html)
+		}
+		if test.expected != "" && c.errorMessage != "" {
+			t.Errorf("%q: expected the message inline rather than in the alert, got %q", test.value, c.errorMessage)
+		}
+	}
+
+	// Nothing is sent until a valid size is typed
+	c.changeNewPackSize("1.5")
+	c.createPack(ctx, app.Event{})
+	engine.ConsumeAll()
+
+	if len(client.requests) != 0 {
+		t.Errorf("Expected no request for an invalid size, got %v", client.requests)
+	}
+
+	c.changeNewPackSize("250")
+	c.createPack(ctx, app.Event{})
+	engine.ConsumeAll()
+
+	if len(client.requests) == 0 || client.requests[0] != "POST /packs" {
+		t.Errorf("Expected the valid size to be posted, got %v", client.requests)
+	}
+}
+
+// buttonDisabled reports whether the button labelled label in html is disabled, whatever
+// the order its attributes are rendered in.
+func buttonDisabled(html, label string) bool {
+	for _, tag := range strings.Split(html, "<button")[1:] {
+		tag = tag[:strings.Index(tag, ">")]
+		if strings.Contains(tag, `aria-label="`+label+`"`) {
+			return strings.Contains(tag, " disabled") && !strings.Contains(tag, `disabled="false"`)
+		}
+	}
+
+	return false
+}
+
+func TestCalculatorRetry(t *testing.T) {
+	ctx, engine := testContext(t)
+
+	retried := false
+	c := &calculator{errorMessage: "The server failed to handle the request (Internal Server Error), please retry"}
+	c.retry = func(ctx app.Context) { retried = true }
+
+	if !strings.Contains(app.HTMLString(c), `aria-label="Retry the failed request"`) {
+		t.Error("Expected a Retry button while a retry is offered")
+	}
+
+	c.retryRequest(ctx, app.Event{})
+	engine.ConsumeAll()
+
+	if !retried || c.retry != nil || c.errorMessage != "" {
+		t.Errorf("Expected the request to be retried and the error cleared, got retried %t %q", retried, c.errorMessage)
+	}
+
+	// Undo without a change to revert does nothing
+	c.undo(ctx, app.Event{})
+	if c.lastMutation != nil || c.errorMessage != "" {
+		t.Errorf("Expected undo without a mutation to be a no-op, got %+v %q", c.lastMutation, c.errorMessage)
+	}
+}
+
+// fakeDoer answers requests with canned responses instead of reaching the server,
+// recording each request it receives.
+type fakeDoer struct {
+	mu       sync.Mutex
+	requests []string
+	respond  func(req *http.Request) (*http.Response, error)
+}
+
+func (f *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req.Method+" "+req.URL.Path)
+	f.mu.Unlock()
+
+	return f.respond(req)
+}
+
+// cannedResponse returns a response with the given status and body.
+func cannedResponse(status int, body string) *http.Response {
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestCalculatorRequests(t *testing.T) {
+	ctx, engine := testContext(t)
+
+	packs := `[{"id":"b","size":1000},{"id":"c","size":500},{"id":"a","size":250}]` // The server lists packs largest first
+	client := &fakeDoer{respond: func(req *http.Request) (*http.Response, error) {
+		switch req.Method + " " + req.URL.Path {
+		case "GET /packs":
+			return cannedResponse(http.StatusOK, packs), nil
+		case "POST /packs":
+			return cannedResponse(http.StatusInternalServerError, `{"error":"write failed"}`), nil
+		case "PUT /packs/a":
+			return cannedResponse(http.StatusOK, `{"id":"a","size":300}`), nil
+		case "DELETE /packs/b":
+			return cannedResponse(http.StatusNotFound, `{"error":"Pack not found"}`), nil
+		}
+		return nil, errors.New("connection refused")
+	}}
+	c := &calculator{client: client}
+
+	c.getPacks(ctx)
+	engine.ConsumeAll()
+
+	expected := []Pack{{ID: "b", Size: 1000}, {ID: "c", Size: 500}, {ID: "a", Size: 250}}
+	if !reflect.DeepEqual(c.packs, expected) {
+		t.Fatalf("Expected the packs in the order the server lists them, got %+v", c.packs)
+	}
+
+	// An update refreshes the packs
+	c.putPack(ctx, Pack{ID: "a", Size: 300})
+	engine.ConsumeAll()
+
+	if c.errorMessage != "" || client.requests[len(client.requests)-1] != "GET /packs" {
+		t.Errorf("Expected a successful update followed by a refresh, got %q after %v", c.errorMessage, client.requests)
+	}
+
+	tests := []struct {
+		name      string
+		send      func()
+		expected  string
+		retryable bool
+	}{
+		{"server error", func() { c.postPack(ctx, Pack{Size: 750}) }, "The server failed to handle the request (write failed), please retry", true},
+		{"client error", func() { c.removePack(ctx, "b") }, "Pack not found", false},
+		{"network error", func() { c.removePack(ctx, "missing") }, "Unable to reach the server (connection refused), check your connection and retry", true},
+	}
+
+	for _, test := range tests {
+		c.errorMessage, c.retry = "", nil
+		test.send()
+		engine.ConsumeAll()
+
+		if c.errorMessage != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, c.errorMessage)
+		}
+		if (c.retry != nil) != test.retryable {
+			t.Errorf("%s: expected a retry to be offered %t", test.name, test.retryable)
+		}
+	}
+}
+
+func TestCalculateExactRequest(t *testing.T) {
+	ctx, engine := testContext(t)
+
+	var payload map[string]interface{}
+	status, body := http.StatusOK, `{"packs":[{"pack":500,"quantity":2}]}`
+	c := &calculator{client: &fakeDoer{respond: func(req *http.Request) (*http.Response, error) {
+		json.NewDecoder(req.Body).Decode(&payload)
+		return cannedResponse(status, body), nil
+	}}}
+	packs := []Pack{{Size: 500}, {Size: 250}}
+
+	c.calculateExact(ctx, packs, 1000)
+	engine.ConsumeAll()
+
+	if expected := []PackQuantity{{Pack: 500, Quantity: 2}}; !reflect.DeepEqual(c.packQuantities, expected) {
+		t.Errorf("Expected the server's breakdown %+v, got %+v", expected, c.packQuantities)
+	}
+	if payload["mode"] != "exact" || payload["items"] != float64(1000) {
+		t.Errorf("Expected an exact calculation of 1000 items to be requested, got %v", payload)
+	}
+
+	// An order the packs can't fill suggests the nearest that can be
+	status, body = http.StatusUnprocessableEntity, `{"error":"Order can't be filled exactly"}`
+	c.calculateExact(ctx, packs, 1001)
+	engine.ConsumeAll()
+
+	if c.packQuantities != nil || c.unfillable != unfillableMessage(1001, 1000, 1250) {
+		t.Errorf("Expected the nearest fillable orders to be suggested, got %+v %q", c.packQuantities, c.unfillable)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		status     int
+		retryAfter string
+		wait       time.Duration
+		retry      bool
+	}{
+		{http.StatusServiceUnavailable, "1", time.Second, true},
+		{http.StatusTooManyRequests, " 5 ", 5 * time.Second, true},
+		{http.StatusTooManyRequests, "0", 0, true},
+		{http.StatusServiceUnavailable, "Wed, 01 May 2024 12:00:10 GMT", 10 * time.Second, true}, // HTTP date
+		{http.StatusServiceUnavailable, "Wed, 01 May 2024 11:59:00 GMT", 0, true},                // Date already passed
+		{http.StatusServiceUnavailable, "31", 0, false},                                          // Longer than maxRetryAfter
+		{http.StatusServiceUnavailable, "-1", 0, false},
+		{http.StatusServiceUnavailable, "soon", 0, false},
+		{http.StatusServiceUnavailable, "", 0, false},
+		{http.StatusInternalServerError, "1", 0, false}, // Only 429 and 503 are retried
+	}
+
+	for _, test := range tests {
+		wait, retry := retryWait(test.status, test.retryAfter, now)
+		if retry != test.retry || retry && wait != test.wait {
+			t.Errorf("retryWait(%d, %q): expected %v %t, got %v %t", test.status, test.retryAfter, test.wait, test.retry, wait, retry)
+		}
+	}
+}
+
+func TestDoRequestHonorsRetryAfter(t *testing.T) {
+	var waits []time.Duration
+	busy := 2
+	client := &fakeDoer{respond: func(req *http.Request) (*http.Response, error) {
+		if busy > 0 {
+			busy--
+			resp := cannedResponse(http.StatusServiceUnavailable, `{"error":"Too many calculations in progress, please retry shortly"}`)
+			resp.Header = http.Header{"Retry-After": {"2"}}
+			return resp, nil
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		return cannedResponse(http.StatusOK, string(body)), nil
+	}}
+	c := &calculator{client: client, sleep: func(wait time.Duration) { waits = append(waits, wait) }}
+
+	body, err := c.doRequest(http.MethodPost, "/calculate", map[string]int{"items": 501})
+	if err != nil || string(body) != `{"items":501}` {
+		t.Fatalf("Expected the request to succeed with its payload resent, got %q %v", body, err)
+	}
+	if !reflect.DeepEqual(waits, []time.Duration{2 * time.Second, 2 * time.Second}) {
+		t.Errorf("Expected two waits of 2s, got %v", waits)
+	}
+
+	// The failure is shown once the retries run out
+	waits, busy = nil, maxAutoRetries+1
+	_, err = c.doRequest(http.MethodGet, "/packs", nil)
+	if failure, ok := err.(*requestError); !ok || failure.status != http.StatusServiceUnavailable || !failure.retryable() {
+		t.Errorf("Expected a retryable 503 failure, got %v", err)
+	}
+	if len(waits) != maxAutoRetries || len(client.requests) != 3+maxAutoRetries+1 {
+		t.Errorf("Expected %d retries, got %d waits over %d requests", maxAutoRetries, len(waits), len(client.requests))
+	}
+}
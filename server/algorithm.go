@@ -0,0 +1,117 @@
+package main
+
+import "errors"
+
+// ErrInvalidAlgorithm is returned for an unknown calculation algorithm.
+var ErrInvalidAlgorithm = errors.New("algorithm must be one of dp, bfs or greedy")
+
+// Calculation algorithms trade speed against finding the optimal breakdown.
+const (
+    AlgorithmDP     = "dp"     // Dynamic programming over every total, optimal (default)
+    AlgorithmBFS    = "bfs"    // Breadth-first search over totals by pack count, optimal
+    AlgorithmGreedy = "greedy" // Always take the largest pack that fits, fast but possibly suboptimal
+)
+
+// AlgorithmNames lists every supported algorithm, default first.
+var AlgorithmNames = []string{AlgorithmDP, AlgorithmBFS, AlgorithmGreedy}
+
+// Algorithm builds the tables Calculate picks breakdowns from. For every total up to
+// limit, counts[t] is the number of packs summing exactly to t, or -1 if the algorithm
+// can't reach t, and last[t] is the size of the pack added to reach t. sizes are
+// distinct and in descending order.
+type Algorithm interface {
+    Tables(sizes []int, limit int) (counts []int, last []int)
+}
+
+// algorithms maps the Algorithm constants to their implementations.
+var algorithms = map[string]Algorithm{
+    AlgorithmDP:     dpAlgorithm{},
+    AlgorithmBFS:    bfsAlgorithm{},
+    AlgorithmGreedy: greedyAlgorithm{},
+}
+
+// ValidAlgorithm reports whether algorithm is empty or one of the Algorithm constants.
+func ValidAlgorithm(algorithm string) bool {
+    _, ok := algorithms[algorithm]
+    return algorithm == "" || ok
+}
+
+// algorithmFor returns the implementation of algorithm, dp when it is empty.
+func algorithmFor(algorithm string) Algorithm {
+    if impl, ok := algorithms[algorithm]; ok {
+        return impl
+    }
+
+    return dpAlgorithm{}
+}
+
+// dpAlgorithm fills the tables total by total with fewestPacks.
+type dpAlgorithm struct{}
+
+func (dpAlgorithm) Tables(sizes []int, limit int) ([]int, []int) {
+    return fewestPacks(sizes, limit)
+}
+
+// bfsAlgorithm explores totals level by level, one more pack per level, so each total
+// is first reached with the fewest packs. Among the packs reaching a total from the
+// previous level it keeps the largest, the same tie-break as dpAlgorithm.
+type bfsAlgorithm struct{}
+
+func (bfsAlgorithm) Tables(sizes []int, limit int) ([]int, []int) {
+    counts := make([]int, limit+1)
+    last := make([]int, limit+1)
+    for total := 1; total <= limit; total++ {
+        counts[total] = -1
+    }
+
+    level := []int{0}
+    for len(level) > 0 {
+        var next []int
+        for _, from := range level {
+            for _, size := range sizes {
+                total := from + size
+                if total > limit {
+                    continue
+                }
+
+                switch {
+                case counts[total] < 0:
+                    counts[total] = counts[from] + 1
+                    last[total] = size
+                    next = append(next, total)
+                case counts[total] == counts[from]+1 && size > last[total]:
+                    last[total] = size
+                }
+            }
+        }
+        level = next
+    }
+
+    return counts, last
+}
+
+// greedyAlgorithm reaches each total by taking the largest pack that fits and then
+// the largest that fits what remains. Totals the remainder can't be packed into
+// exactly are unreachable, even where another combination would fill them.
+type greedyAlgorithm struct{}
+
+func (greedyAlgorithm) Tables(sizes []int, limit int) ([]int, []int) {
+    counts := make([]int, limit+1)
+    last := make([]int, limit+1)
+
+    for total := 1; total <= limit; total++ {
+        counts[total] = -1
+
+        for _, size := range sizes {
+            if size <= total {
+                if counts[total-size] >= 0 {
+                    counts[total] = counts[total-size] + 1
+                    last[total] = size
+                }
+                break // Only the largest pack that fits is ever tried
+            }
+        }
+    }
+
+    return counts, last
+}
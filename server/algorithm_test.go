@@ -0,0 +1,83 @@
+package main
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestAlgorithmsAgreeOnOptimalTables(t *testing.T) {
+    catalogs := [][]int{
+        {250, 500, 1000, 2000, 5000},
+        {53, 31, 23},
+        {6, 4, 3},
+        {10, 7, 1},
+        {9},
+    }
+
+    for _, sizes := range catalogs {
+        dpCounts, dpLast := dpAlgorithm{}.Tables(sizes, 600)
+        bfsCounts, bfsLast := bfsAlgorithm{}.Tables(sizes, 600)
+
+        if !reflect.DeepEqual(dpCounts, bfsCounts) || !reflect.DeepEqual(dpLast, bfsLast) {
+            t.Errorf("%v: expected bfs to build the same tables as dp", sizes)
+        }
+    }
+}
+
+func TestCalculateAlgorithm(t *testing.T) {
+    packs := []Pack{{Size: 3}, {Size: 4}}
+
+    tests := []struct {
+        algorithm string
+        expected  Result
+    }{
+        {"", Result{Packs: []PackQuantity{{Pack: 3, Quantity: 2}}, TotalItems: 6, TotalPacks: 2}},
+        {AlgorithmDP, Result{Packs: []PackQuantity{{Pack: 3, Quantity: 2}}, TotalItems: 6, TotalPacks: 2}},
+        {AlgorithmBFS, Result{Packs: []PackQuantity{{Pack: 3, Quantity: 2}}, TotalItems: 6, TotalPacks: 2}},
+        // Taking a 4 first leaves 2, which no pack fills, so greedy overships
+        {AlgorithmGreedy, Result{Packs: []PackQuantity{{Pack: 4, Quantity: 1}, {Pack: 3, Quantity: 1}}, TotalItems: 7, TotalPacks: 2}},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate(packs, 6, CalculateOptions{Algorithm: test.algorithm})
+        if err != nil || !reflect.DeepEqual(result, test.expected) {
+            t.Errorf("Algorithm %q: expected %+v, got %+v %v", test.algorithm, test.expected, result, err)
+        }
+    }
+
+    // Greedy misses exact breakdowns that dp finds
+    if _, err := Calculate(packs, 6, CalculateOptions{Mode: ModeExact, Algorithm: AlgorithmGreedy}); !errors.Is(err, ErrUnfillable) {
+        t.Errorf("Expected greedy to find 6 unfillable exactly, got %v", err)
+    }
+
+    if _, err := Calculate(packs, 6, CalculateOptions{Algorithm: "simplex"}); !errors.Is(err, ErrInvalidAlgorithm) {
+        t.Errorf("Expected ErrInvalidAlgorithm, got %v", err)
+    }
+}
+
+func TestCalculateAlgorithmsAgree(t *testing.T) {
+    catalogs := [][]Pack{
+        {{Size: 250}, {Size: 500}, {Size: 1000}, {Size: 2000}, {Size: 5000}},
+        {{Size: 23}, {Size: 31}, {Size: 53}},
+        {{Size: 3}, {Size: 4}, {Size: 6}},
+    }
+
+    for _, packs := range catalogs {
+        for _, mode := range []string{ModeOvership, ModeExact, ModePartial} {
+            for _, strategy := range Strategies {
+                for items := 0; items <= 1200; items += 7 {
+                    opts := CalculateOptions{Mode: mode, Strategy: strategy}
+                    dp, dpErr := Calculate(packs, items, opts)
+
+                    opts.Algorithm = AlgorithmBFS
+                    bfs, bfsErr := Calculate(packs, items, opts)
+
+                    if !reflect.DeepEqual(dp, bfs) || !errors.Is(bfsErr, dpErr) {
+                        t.Fatalf("%v %d items, %s %s: dp %+v %v, bfs %+v %v", packs, items, mode, strategy, dp, dpErr, bfs, bfsErr)
+                    }
+                }
+            }
+        }
+    }
+}
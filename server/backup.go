@@ -0,0 +1,117 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// backupVersion is the version of the Backup format written by GET /backup. POST
+// /restore rejects backups of any other version.
+const backupVersion = 1
+
+// Backup is the state exported by GET /backup for disaster recovery.
+type Backup struct {
+    Version   int         `json:"version"`   // Version of the backup format
+    CreatedAt time.Time   `json:"createdAt"` // Time the backup was taken
+    Packs     []Pack      `json:"packs"`     // Every pack in the catalog, with its ID and timestamps
+    Config    DebugConfig `json:"config"`    // Configuration the server ran with, secrets masked
+}
+
+// RestoreRequest is the body accepted by POST /restore: a Backup as exported. Its
+// config is informational, since the server is configured through its environment.
+type RestoreRequest struct {
+    Version int           `json:"version" binding:"required"`    // Version of the backup format
+    Packs   []RestorePack `json:"packs" binding:"required,dive"` // Catalog to restore, may be empty
+}
+
+// RestorePack is a pack of a backup, held to the same rules as packs created through
+// POST /packs, along with the ID and creation time it is restored with.
+type RestorePack struct {
+    PackRequest
+    ID        string    `json:"id"`        // ID of the pack, a new one is generated when empty
+    CreatedAt time.Time `json:"createdAt"` // Time the pack was created, now when unset
+}
+
+// Pack converts the backup entry into a Pack model.
+func (r RestorePack) Pack() Pack {
+    pack := r.PackRequest.Pack()
+    pack.ID = r.ID
+    pack.CreatedAt = r.CreatedAt
+    return pack
+}
+
+// backup handles GET requests to export every pack and the effective configuration.
+func backup(ctx *gin.Context) {
+    packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+    if err != nil {
+        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return  // Return internal server error status if retrieval fails
+    }
+
+    if packs == nil {
+        packs = []Pack{} // Always return a list so an empty catalog can be restored
+    }
+
+    ctx.Header("Content-Disposition", `attachment; filename="packs-backup.json"`)
+    ctx.JSON(http.StatusOK, Backup{
+        Version:   backupVersion,
+        CreatedAt: time.Now().UTC(),
+        Packs:     packs,
+        Config:    effectiveConfig(),
+    })  // Return the backup with OK status
+}
+
+// restore handles POST requests to replace the catalog with the packs of a backup in
+// one transaction. Packs keep the IDs and creation times recorded in the backup.
+func restore(ctx *gin.Context) {
+    var req RestoreRequest
+
+    if err := ctx.ShouldBindJSON(&req); err != nil {
+        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return  // Return bad request status if JSON binding fails
+    }
+
+    if req.Version != backupVersion {
+        ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported backup version: " + strconv.Itoa(req.Version)})
+        return  // Return bad request status for backups this server can't read
+    }
+
+    packs := make([]Pack, len(req.Packs))
+    ids := make(map[string]bool, len(req.Packs))
+    for i, entry := range req.Packs {
+        pack := entry.Pack()
+        packs[i] = pack
+
+        if err := checkPackSize(pack.Size); err != nil {
+            ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return  // Return bad request status for oversized packs, leaving the catalog alone
+        }
+
+        if pack.ID != "" && idSchemeFor(idScheme).Validate(pack.ID) != nil {
+            ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pack ID: " + pack.ID + " doesn't follow the ID_SCHEME " + idScheme})
+            return  // Return bad request status for IDs the :id routes would reject
+        }
+
+        if pack.ID != "" && ids[pack.ID] {
+            ctx.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate pack ID: " + pack.ID})
+            return  // Return bad request status for backups reusing an ID
+        }
+        ids[pack.ID] = true
+    }
+
+    summary, err := tracedStore(ctx).ReplacePacks(packs)
+    if errors.Is(err, ErrInvalidPackSize) {
+        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return  // Return bad request status for invalid sizes
+    }
+    if err != nil {
+        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return  // Return internal server error status if the restore fails
+    }
+
+    ctx.JSON(http.StatusOK, summary)  // Return the changes applied with OK status
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// performKeyedRequest sends a request with a JSON body and an X-API-Key header through the router.
+func performKeyedRequest(router http.Handler, method, path, body, key string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("X-API-Key", key)
+    rec := httptest.NewRecorder()
+
+    router.ServeHTTP(rec, req)
+
+    return rec
+}
+
+func TestBackupRestore(t *testing.T) {
+    t.Setenv("API_KEY", "k3y")
+
+    router, cleanup := newTestServer(t)
+    for _, body := range []string{`{"size": 250, "tags": ["fragile"]}`, `{"size": 500, "weight": 4.8}`, `{"size": 1000, "cost": 9.5, "priority": 2}`} {
+        performRequest(router, http.MethodPost, "/packs", body)
+    }
+
+    var original []Pack
+    json.Unmarshal(performRequest(router, http.MethodGet, "/packs", "").Body.Bytes(), &original)
+
+    if rec := performKeyedRequest(router, http.MethodGet, "/backup", "", "wrong"); rec.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status 401 for a wrong key, got %d", rec.Code)
+    }
+
+    rec := performKeyedRequest(router, http.MethodGet, "/backup", "", "k3y")
+    cleanup()
+
+    var exported Backup
+    json.Unmarshal(rec.Body.Bytes(), &exported)
+
+    if rec.Code != http.StatusOK || exported.Version != backupVersion || len(exported.Packs) != 3 || exported.Config.APIKey != maskedSecret {
+        t.Fatalf("Expected a backup of 3 packs with masked config, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    // Restore into a fresh store
+    router, cleanup = newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 42}`) // Dropped by the restore
+
+    if rec := performRequest(router, http.MethodPost, "/restore", rec.Body.String()); rec.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status 401 without a key, got %d", rec.Code)
+    }
+
+    rec = performKeyedRequest(router, http.MethodPost, "/restore", rec.Body.String(), "k3y")
+
+    var summary ReplaceSummary
+    json.Unmarshal(rec.Body.Bytes(), &summary)
+
+    if rec.Code != http.StatusOK || !reflect.DeepEqual(summary.Added, []int{1000, 500, 250}) || !reflect.DeepEqual(summary.Removed, []int{42}) {
+        t.Fatalf("Expected the backup to replace the catalog, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    var restored []Pack
+    json.Unmarshal(performRequest(router, http.MethodGet, "/packs", "").Body.Bytes(), &restored)
+
+    byID := make(map[string]Pack, len(restored))
+    for _, pack := range restored {
+        byID[pack.ID] = pack
+    }
+
+    if len(restored) != len(original) {
+        t.Fatalf("Expected %d restored packs, got %+v", len(original), restored)
+    }
+    for _, before := range original {
+        pack := byID[before.ID]
+        if pack.Size != before.Size || !pack.CreatedAt.Equal(before.CreatedAt) || !samePackDetails(pack, before) {
+            t.Errorf("Expected %+v to be restored, got %+v", before, pack)
+        }
+    }
+}
+
+func TestRestoreAfterResize(t *testing.T) {
+    t.Setenv("API_KEY", "k3y")
+
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    var small, large Pack
+    json.Unmarshal(performRequest(router, http.MethodPost, "/packs", `{"size": 250}`).Body.Bytes(), &small)
+    json.Unmarshal(performRequest(router, http.MethodPost, "/packs", `{"size": 500}`).Body.Bytes(), &large)
+
+    backup := performKeyedRequest(router, http.MethodGet, "/backup", "", "k3y").Body.String()
+
+    // After the backup, the 500 is deleted and the 250 resized to take its place
+    performRequest(router, http.MethodDelete, "/packs/"+large.ID, "")
+    if rec := performRequest(router, http.MethodPut, "/packs/"+small.ID, `{"size": 500}`); rec.Code != http.StatusOK {
+        t.Fatalf("Expected the resize to succeed, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    rec := performKeyedRequest(router, http.MethodPost, "/restore", backup, "k3y")
+    var summary ReplaceSummary
+    json.Unmarshal(rec.Body.Bytes(), &summary)
+
+    expected := ReplaceSummary{Added: []int{500, 250}, Removed: []int{500}, Updated: []int{}}
+    if rec.Code != http.StatusOK || !reflect.DeepEqual(summary, expected) {
+        t.Fatalf("Expected %+v, got %d %s", expected, rec.Code, rec.Body.String())
+    }
+
+    // Both packs are back under the IDs of the backup
+    var packs []Pack
+    json.Unmarshal(performRequest(router, http.MethodGet, "/packs", "").Body.Bytes(), &packs)
+
+    ids := map[int]string{}
+    for _, pack := range packs {
+        ids[pack.Size] = pack.ID
+    }
+    if len(packs) != 2 || ids[250] != small.ID || ids[500] != large.ID {
+        t.Errorf("Expected 250 as %s and 500 as %s, got %+v", small.ID, large.ID, packs)
+    }
+}
+
+func TestRestoreRejects(t *testing.T) {
+    t.Setenv("API_KEY", "k3y")
+
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    for _, body := range []string{
+        `{}`,
+        `{"version": 1}`,
+        `{"version": 2, "packs": [{"size": 500}]}`,
+        `{"version": 1, "packs": [{"size": 0}]}`,
+        `{"version": 1, "packs": [{"size": 2000000}]}`,
+        `{"version": 1, "packs": [{"size": 500, "weight": -1}]}`,
+        `{"version": 1, "packs": [{"size": 500, "cost": -2.5}]}`,
+        `{"version": 1, "packs": [{"size": 500, "stock": -1}]}`,
+        `{"version": 1, "packs": [{"id": "a", "size": 500}]}`,
+        `{"version": 1, "packs": [{"id": "6f1c2a43-0d7e-4b8a-9d55-1c2b3a4d5e6f", "size": 500}, {"id": "6f1c2a43-0d7e-4b8a-9d55-1c2b3a4d5e6f", "size": 1000}]}`,
+    } {
+        if rec := performKeyedRequest(router, http.MethodPost, "/restore", body, "k3y"); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+
+    var packs []Pack
+    json.Unmarshal(performRequest(router, http.MethodGet, "/packs", "").Body.Bytes(), &packs)
+
+    if len(packs) != 1 || packs[0].Size != 250 {
+        t.Errorf("Expected rejected restores to leave the catalog alone, got %+v", packs)
+    }
+
+    // A backup of an empty catalog empties it
+    if rec := performKeyedRequest(router, http.MethodPost, "/restore", `{"version": 1, "packs": []}`, "k3y"); rec.Code != http.StatusOK {
+        t.Errorf("Expected an empty backup to restore, got %d %s", rec.Code, rec.Body.String())
+    }
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "time"
+)
+
+// defaultCalculationTimeout is how long a calculation may run when CALCULATION_TIMEOUT is unset.
+const defaultCalculationTimeout = 10 * time.Second
+
+// ErrCalculationTimeout is returned when a calculation runs out of time and no greedy
+// approximation can stand in for it.
+var ErrCalculationTimeout = errors.New("calculation did not finish within the time budget")
+
+// ErrCalculationFailed is returned when a calculation panics. It runs on its own
+// goroutine, out of reach of the router's recovery, so the panic is turned into this.
+var ErrCalculationFailed = errors.New("calculation failed")
+
+// exactCalculate runs the calculation calculateWithin waits for. Tests replace it to
+// simulate calculations that are too slow.
+var exactCalculate = func(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+    return calculationCache.Calculate(packs, items, opts)
+}
+
+// calculationTimeout returns how long a calculation may run before its greedy
+// approximation is returned instead, read from CALCULATION_TIMEOUT. 0 disables the limit.
+func calculationTimeout() time.Duration {
+    if d, err := time.ParseDuration(os.Getenv("CALCULATION_TIMEOUT")); err == nil && d >= 0 {
+        return d
+    }
+
+    return defaultCalculationTimeout
+}
+
+// calculateWithin calculates the order, giving up on the optimal breakdown once ctx is
+// done or CALCULATION_TIMEOUT passes. It then returns the breakdown of the greedy
+// algorithm, flagged approximate, rather than keeping the client waiting on a
+// pathological catalog. The abandoned calculation still runs to completion in the
+// background and is cached, so a retry gets the optimal breakdown. It holds on to the
+// request's calculation slot until then, so MAX_CONCURRENT_CALCULATIONS still bounds
+// the calculations running; without that limit, abandoned calculations pile up
+// unbounded while clients retry.
+func calculateWithin(ctx context.Context, packs []Pack, items int, opts CalculateOptions) (Result, error) {
+    if timeout := calculationTimeout(); timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+
+    // The caller's context is done already, as when the client went away or the shared
+    // budget of a waste comparison ran out, so skip straight to the fallback
+    if ctx.Err() != nil {
+        return approximateCalculation(packs, items, opts)
+    }
+
+    type outcome struct {
+        result Result
+        err    error
+    }
+
+    calculate := exactCalculate // Read once, since the calculation may outlive the request
+    done := make(chan outcome, 1) // Buffered so an abandoned calculation can always finish
+
+    slot := requestSlot(ctx)
+    slot.hold()
+    go func() {
+        defer slot.release()
+        defer func() {
+            if r := recover(); r != nil {
+                done <- outcome{err: fmt.Errorf("%w: %v", ErrCalculationFailed, r)} // Report rather than crash the server
+            }
+        }()
+
+        result, err := calculate(packs, items, opts)
+        done <- outcome{result, err}
+    }()
+
+    select {
+    case exact := <-done:
+        return exact.result, exact.err
+    case <-ctx.Done():
+    }
+
+    return approximateCalculation(packs, items, opts)
+}
+
+// approximateCalculation calculates the order with the greedy algorithm for
+// calculateWithin, flagging the result approximate.
+func approximateCalculation(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+    // Stock limits always need the bounded DP, so there is nothing quicker to fall back on.
+    if opts.LimitStock {
+        return Result{}, ErrCalculationTimeout
+    }
+
+    opts.Algorithm = AlgorithmGreedy // opts is a copy, so the abandoned calculation is unaffected
+    result, err := Calculate(packs, items, opts)
+    if errors.Is(err, ErrUnfillable) || errors.Is(err, ErrOvershipExceeded) {
+        return Result{}, ErrCalculationTimeout // Greedy misses breakdowns the optimal algorithms would find
+    }
+    if err != nil {
+        return Result{}, err
+    }
+
+    result.Approximate = true
+    return result, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestCalculateTimeoutApproximates(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []int{23, 31, 53} {
+        performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size))
+    }
+
+    // Simulate a pathological catalog: the optimal calculation doesn't return until the test ends
+    release := make(chan struct{})
+    defer close(release)
+
+    previous := exactCalculate
+    defer func() { exactCalculate = previous }()
+    exactCalculate = func(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+        <-release
+        return Result{}, nil
+    }
+
+    t.Setenv("CALCULATION_TIMEOUT", "20ms")
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 500}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if rec.Code != http.StatusOK || !result.Approximate || result.TotalItems < 500 {
+        t.Errorf("Expected an approximate breakdown of 500, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    greedy, _ := Calculate([]Pack{{Size: 23}, {Size: 31}, {Size: 53}}, 500, CalculateOptions{Algorithm: AlgorithmGreedy})
+    if result.TotalItems != greedy.TotalItems || result.TotalPacks != greedy.TotalPacks {
+        t.Errorf("Expected the greedy breakdown %+v, got %+v", greedy, result)
+    }
+
+    if rec := performRequest(router, http.MethodGet, "/calculate?items=500", ""); rec.Code != http.StatusOK {
+        t.Errorf("Expected status 200 from the query form, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    // Stock limits have no greedy fallback
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 500, "limitStock": true}`); rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status 503 without a fallback, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestCalculateWithinBudget(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if rec.Code != http.StatusOK || result.Approximate || result.TotalItems != 500 {
+        t.Errorf("Expected an exact breakdown of 500, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestCalculatePanicFails(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    previous := exactCalculate
+    defer func() { exactCalculate = previous }()
+    exactCalculate = func(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+        panic("table out of range")
+    }
+
+    if _, err := calculateWithin(context.Background(), []Pack{{Size: 250}}, 251, CalculateOptions{}); !errors.Is(err, ErrCalculationFailed) {
+        t.Errorf("Expected ErrCalculationFailed from a panicking calculation, got %v", err)
+    }
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`); rec.Code != http.StatusInternalServerError {
+        t.Errorf("Expected status 500 from a panicking calculation, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestCalculateTimeoutKeepsSlot(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    previousLimiter := calculationLimiter
+    defer func() { calculationLimiter = previousLimiter }()
+    calculationLimiter = NewCalculationLimiter(1, 0)
+
+    release := make(chan struct{})
+    previous := exactCalculate
+    defer func() { exactCalculate = previous }()
+    exactCalculate = func(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+        <-release
+        return Calculate(packs, items, opts)
+    }
+
+    t.Setenv("CALCULATION_TIMEOUT", "20ms")
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`); rec.Code != http.StatusOK {
+        t.Fatalf("Expected the approximate breakdown, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    // The abandoned calculation still runs, so it keeps the only slot
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`); rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status 503 while the abandoned calculation runs, got %d", rec.Code)
+    }
+
+    close(release)
+    for deadline := time.Now().Add(time.Second); len(calculationLimiter.slots) > 0 && time.Now().Before(deadline); {
+        time.Sleep(time.Millisecond)
+    }
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`); rec.Code != http.StatusOK {
+        t.Errorf("Expected status 200 once the abandoned calculation ended, got %d %s", rec.Code, rec.Body.String())
+    }
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+    "container/list"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "sync"
+    "time"
+
+    "golang.org/x/sync/singleflight"
+)
+
+// Defaults for the calculation cache when CACHE_SIZE and CACHE_TTL are unset.
+const (
+    defaultCacheSize = 1000
+    defaultCacheTTL  = 5 * time.Minute
+)
+
+// calculationCache holds recent /calculate results, configured from CACHE_SIZE and CACHE_TTL in main.
+var calculationCache = NewCalculationCache(defaultCacheSize, defaultCacheTTL)
+
+// CacheStats reports how well the calculation cache is doing.
+type CacheStats struct {
+    Hits     uint64  `json:"hits"`     // Lookups answered from the cache
+    Misses   uint64  `json:"misses"`   // Lookups that had to calculate
+    HitRatio float64 `json:"hitRatio"` // Hits as a fraction of all lookups, 0 before the first
+    Entries  int     `json:"entries"`  // Results currently cached
+    Size     int     `json:"size"`     // Most results kept at once
+    TTL      string  `json:"ttl"`      // How long a result is kept
+}
+
+// cacheEntry is a cached result and when it stops being served.
+type cacheEntry struct {
+    key     string
+    result  Result
+    expires time.Time
+}
+
+// CalculationCache is a size-bounded, least recently used cache of calculation results
+// that expire after a TTL. Results are keyed by the pack sizes as well as the order, so
+// catalog changes never serve stale breakdowns. Only successful calculations are cached.
+// Concurrent misses for the same key share a single calculation, so a burst of identical
+// requests is computed once even while caching is disabled.
+type CalculationCache struct {
+    mu        sync.Mutex
+    size      int
+    ttl       time.Duration
+    entries   map[string]*list.Element
+    recent    *list.List // Most recently used entry first
+    hits      uint64
+    misses    uint64
+    now       func() time.Time
+    inflight  singleflight.Group                                  // Calculations running for a key
+    calculate func([]Pack, int, CalculateOptions) (Result, error) // Runs a calculation on a miss, Calculate outside tests
+}
+
+// NewCalculationCache returns a cache keeping at most size results for ttl each.
+// A size of zero disables caching.
+func NewCalculationCache(size int, ttl time.Duration) *CalculationCache {
+    return &CalculationCache{
+        size:    size,
+        ttl:     ttl,
+        entries: make(map[string]*list.Element),
+        recent:    list.New(),
+        now:       time.Now,
+        calculate: Calculate,
+    }
+}
+
+// loadCalculationCache builds the calculation cache from CACHE_SIZE and CACHE_TTL.
+func loadCalculationCache() (*CalculationCache, error) {
+    size := defaultCacheSize
+    if value := os.Getenv("CACHE_SIZE"); value != "" {
+        n, err := strconv.Atoi(value)
+        if err != nil || n < 0 {
+            return nil, fmt.Errorf("invalid CACHE_SIZE %q: must be a non-negative integer", value)
+        }
+        size = n
+    }
+
+    ttl := defaultCacheTTL
+    if value := os.Getenv("CACHE_TTL"); value != "" {
+        d, err := time.ParseDuration(value)
+        if err != nil || d <= 0 {
+            return nil, fmt.Errorf("invalid CACHE_TTL %q: must be a positive duration, e.g. 5m", value)
+        }
+        ttl = d
+    }
+
+    return NewCalculationCache(size, ttl), nil
+}
+
+// Calculate returns the cached result for the calculation, running Calculate on a miss.
+func (c *CalculationCache) Calculate(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+    key := cacheKey(packs, items, opts)
+
+    c.mu.Lock()
+    if element, ok := c.entries[key]; ok {
+        entry := element.Value.(*cacheEntry)
+        if c.now().Before(entry.expires) {
+            c.hits++
+            c.recent.MoveToFront(element)
+            c.mu.Unlock()
+            return entry.result, nil
+        }
+
+        c.recent.Remove(element) // Expired entries are dropped and recalculated
+        delete(c.entries, key)
+    }
+    c.misses++
+    c.mu.Unlock()
+
+    shared, err, _ := c.inflight.Do(key, func() (interface{}, error) {
+        result, err := c.calculate(packs, items, opts)
+        if err == nil && c.size > 0 {
+            c.store(key, result) // Stored before the call ends, so later misses find it
+        }
+        return result, err
+    })
+
+    return shared.(Result), err
+}
+
+// store caches result under key, evicting the least recently used results beyond the size.
+func (c *CalculationCache) store(key string, result Result) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if element, ok := c.entries[key]; ok {
+        c.recent.Remove(element) // A concurrent miss stored it first
+    }
+
+    c.entries[key] = c.recent.PushFront(&cacheEntry{key: key, result: result, expires: c.now().Add(c.ttl)})
+
+    for c.recent.Len() > c.size {
+        oldest := c.recent.Back()
+        c.recent.Remove(oldest)
+        delete(c.entries, oldest.Value.(*cacheEntry).key)
+    }
+}
+
+// Stats returns the hit and miss counts and the current occupancy of the cache.
+func (c *CalculationCache) Stats() CacheStats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    stats := CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.recent.Len(), Size: c.size, TTL: c.ttl.String()}
+    if lookups := c.hits + c.misses; lookups > 0 {
+        stats.HitRatio = float64(c.hits) / float64(lookups)
+    }
+
+    return stats
+}
+
+// cacheKey identifies a calculation by its sorted pack sizes, order and options. Pack
+// weights are part of the key only when a weight limit makes them matter, pack stock
+// only when the stock is limited, and pack priorities only when they are set.
+func cacheKey(packs []Pack, items int, opts CalculateOptions) string {
+    sizes := make([]string, len(packs))
+    for i, pack := range packs {
+        sizes[i] = strconv.Itoa(pack.Size)
+        if opts.MaxWeight != nil {
+            sizes[i] += ":" + strconv.FormatFloat(pack.Weight, 'g', -1, 64)
+        }
+        if opts.LimitStock {
+            sizes[i] += "#" + strconv.Itoa(pack.Stock)
+        }
+        if pack.Priority != 0 {
+            sizes[i] += "^" + strconv.Itoa(pack.Priority)
+        }
+    }
+    sort.Strings(sizes)
+
+    return fmt.Sprintf("%v|%d|%s|%s|%s|%s|%d|%t|%s|%d|%t", sizes, items, opts.Mode, opts.Strategy,
+        formatLimit(opts.MaxOvershipPercent), formatLimit(opts.MaxWeight), opts.MinOrder, opts.RejectBelowMinOrder, opts.Algorithm, opts.MinDistinctSizes, opts.LimitStock)
+}
+
+// formatLimit formats an optional limit for a cache key.
+func formatLimit(limit *float64) string {
+    if limit == nil {
+        return "none"
+    }
+
+    return strconv.FormatFloat(*limit, 'g', -1, 64)
+}
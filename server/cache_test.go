@@ -0,0 +1,90 @@
+package main
+
+import (
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestCalculationCacheEviction(t *testing.T) {
+    cache := NewCalculationCache(2, time.Minute)
+    now := time.Now()
+    cache.now = func() time.Time { return now }
+
+    for _, items := range []int{1, 251, 501, 1} {
+        if _, err := cache.Calculate(defaultPacks, items, CalculateOptions{}); err != nil {
+            t.Fatalf("Calculate(%d) failed: %v", items, err)
+        }
+    }
+
+    // The order of 1 was evicted as least recently used before it was asked for again
+    if stats := cache.Stats(); stats.Hits != 0 || stats.Misses != 4 || stats.Entries != 2 {
+        t.Errorf("Expected 4 misses and 2 entries, got %+v", stats)
+    }
+
+    cache.Calculate(defaultPacks, 1, CalculateOptions{})
+    now = now.Add(2 * time.Minute)
+    cache.Calculate(defaultPacks, 1, CalculateOptions{})
+
+    if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 5 {
+        t.Errorf("Expected an expired entry to miss, got %+v", stats)
+    }
+
+    // Errors are never cached
+    cache.Calculate(nil, 1, CalculateOptions{})
+    cache.Calculate(nil, 1, CalculateOptions{})
+    if stats := cache.Stats(); stats.Misses != 7 {
+        t.Errorf("Expected failed calculations to miss every time, got %+v", stats)
+    }
+}
+
+// TestCalculationCacheSharesConcurrentMisses fires identical requests at once. Run with
+// -race to detect unsynchronized access to the shared result.
+func TestCalculationCacheSharesConcurrentMisses(t *testing.T) {
+    for _, size := range []int{defaultCacheSize, 0} {
+        router, cleanup := newTestServer(t)
+        performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+        var calculations atomic.Int32
+        cache := NewCalculationCache(size, time.Minute)
+        cache.calculate = func(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+            calculations.Add(1)
+            time.Sleep(100 * time.Millisecond) // Slow enough for every request to arrive while it runs
+            return Calculate(packs, items, opts)
+        }
+
+        previous := calculationCache
+        calculationCache = cache
+
+        const requests = 50
+        var wg sync.WaitGroup
+        bodies := make([]string, requests)
+        for i := range bodies {
+            wg.Add(1)
+            go func(i int) {
+                defer wg.Done()
+                rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`)
+                if rec.Code != http.StatusOK {
+                    t.Errorf("Cache size %d: expected status 200, got %d %s", size, rec.Code, rec.Body.String())
+                }
+                bodies[i] = rec.Body.String()
+            }(i)
+        }
+        wg.Wait()
+
+        calculationCache = previous
+        cleanup()
+
+        if n := calculations.Load(); n != 1 {
+            t.Errorf("Cache size %d: expected a single calculation for %d identical requests, got %d", size, requests, n)
+        }
+        for _, body := range bodies {
+            if body != bodies[0] {
+                t.Errorf("Cache size %d: expected every request to get %s, got %s", size, bodies[0], body)
+                break
+            }
+        }
+    }
+}
@@ -0,0 +1,1055 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "slices"
+    "sort"
+)
+
+var (
+    // ErrNoPacks is returned when there are no pack sizes to calculate with.
+    ErrNoPacks = errors.New("no packs available")
+    // ErrInvalidItems is returned for a negative number of items.
+    ErrInvalidItems = errors.New("items must not be negative")
+    // ErrInvalidPackSize is returned when a pack size is zero or negative.
+    ErrInvalidPackSize = errors.New("pack sizes must be positive")
+    // ErrInvalidMode is returned for an unknown calculation mode.
+    ErrInvalidMode = errors.New("mode must be one of overship, exact, partial or prefer_exact")
+    // ErrUnfillable is returned in exact mode when no combination of packs matches the order.
+    ErrUnfillable = errors.New("order cannot be filled exactly with the available packs")
+    // ErrOvershipExceeded is returned when every breakdown overships by more than the tolerance.
+    ErrOvershipExceeded = errors.New("no breakdown within the overshipment tolerance")
+    // ErrInvalidTolerance is returned for a negative overshipment tolerance.
+    ErrInvalidTolerance = errors.New("maxOvershipPercent must not be negative")
+    // ErrInvalidStrategy is returned for an unknown calculation strategy.
+    ErrInvalidStrategy = errors.New("strategy must be one of balanced or fewest_packs")
+    // ErrInvalidWeight is returned for a negative weight limit.
+    ErrInvalidWeight = errors.New("maxWeight must not be negative")
+    // ErrWeightExceeded is returned when every breakdown weighs more than the weight limit.
+    ErrWeightExceeded = errors.New("no breakdown within the weight limit")
+    // ErrInvalidMinOrder is returned for a negative minimum order quantity.
+    ErrInvalidMinOrder = errors.New("minOrder must not be negative")
+    // ErrInvalidTargetWeight is returned for a target weight that isn't positive or is too large to calculate.
+    ErrInvalidTargetWeight = errors.New("weight must be positive and at most 10000")
+    // ErrNoWeights is returned when no pack has a weight to reach a target weight with.
+    ErrNoWeights = errors.New("no packs with a weight available")
+    // ErrBelowMinOrder is returned for orders below the minimum order quantity when they are rejected rather than raised.
+    ErrBelowMinOrder = errors.New("order is below the minimum order quantity")
+    // ErrInvalidDistinctSizes is returned for a negative minimum number of distinct pack sizes.
+    ErrInvalidDistinctSizes = errors.New("minDistinctSizes must not be negative")
+)
+
+// Calculation modes decide what happens when the order can't be matched exactly.
+const (
+    ModeOvership    = "overship"     // Send the fewest extra items needed to cover the order (default)
+    ModeExact       = "exact"        // Only accept a breakdown that matches the order exactly
+    ModePartial     = "partial"      // Never overship, send the largest fillable quantity below the order
+    ModePreferExact = "prefer_exact" // Match the order exactly when possible, otherwise overship and flag the result approximate
+)
+
+// Modes lists every supported mode, default first.
+var Modes = []string{ModeOvership, ModeExact, ModePartial, ModePreferExact}
+
+// ValidMode reports whether mode is empty or one of the Mode constants.
+func ValidMode(mode string) bool {
+    return mode == "" || slices.Contains(Modes, mode)
+}
+
+// Calculation strategies decide how overshipment is traded against the number of packs.
+const (
+    StrategyBalanced    = "balanced"     // Ship the fewest items, then use the fewest packs (default)
+    StrategyFewestPacks = "fewest_packs" // Use the fewest packs, then ship the fewest items
+)
+
+// Strategies lists every supported strategy, default first.
+var Strategies = []string{StrategyBalanced, StrategyFewestPacks}
+
+// ValidStrategy reports whether strategy is empty or one of the Strategy constants.
+func ValidStrategy(strategy string) bool {
+    if strategy == "" {
+        return true
+    }
+
+    for _, supported := range Strategies {
+        if strategy == supported {
+            return true
+        }
+    }
+
+    return false
+}
+
+// CalculateOptions tunes how Calculate builds the breakdown.
+type CalculateOptions struct {
+    Mode                string            // One of the Mode constants, empty means ModeOvership
+    Strategy            string            // One of the Strategy constants, empty means StrategyBalanced. Only overship mode is affected
+    MaxOvershipPercent  *float64          // Largest accepted overshipment as a percentage of the order, nil for no limit
+    MaxWeight           *float64          // Largest accepted total weight of the packs, nil for no limit
+    MinOrder            int               // Minimum order quantity: smaller orders are raised to it, 0 for none
+    RejectBelowMinOrder bool              // Fail orders below MinOrder with ErrBelowMinOrder instead of raising them
+    Algorithm           string            // One of the Algorithm constants, empty means AlgorithmDP
+    MinDistinctSizes    int               // Fewest distinct pack sizes the breakdown should use, ignored when none can. 0 or 1 for no constraint
+    LimitStock          bool              // Never use more packs of a size than its packs have in Stock. Sizes without stock are unlimited
+    Trace               *CalculationTrace // Records the steps taken when set, nil to skip tracing. Not part of the cache key
+}
+
+// PackQuantity holds the quantity of a specific pack size in a calculation result.
+type PackQuantity struct {
+    Pack     int     `json:"pack"`             // Size of the pack
+    Quantity int     `json:"quantity"`         // Number of packs of this size
+    Depot    string  `json:"depot,omitempty"`  // Depot supplying the pack in combined calculations
+    Items    int     `json:"items,omitempty"`  // Items in the packs of this line, set when subtotals are requested
+    Cost     Cost    `json:"cost,omitempty"`   // Price of the packs of this line, set when subtotals are requested
+    Weight   float64 `json:"weight,omitempty"` // Weight of the packs of this line, set when subtotals are requested
+}
+
+// Result is the pack breakdown for an order.
+type Result struct {
+    Packs       []PackQuantity `json:"packs"`                 // Packs to send, largest size first
+    TotalItems  int            `json:"totalItems"`            // Items shipped across all packs
+    TotalPacks  int            `json:"totalPacks"`            // Number of packs shipped
+    Shortfall   int            `json:"shortfall,omitempty"`   // Items left unshipped in partial mode
+    Approximate bool           `json:"approximate,omitempty"` // Set in prefer_exact mode when the order couldn't be matched exactly
+    Unit        string         `json:"unit,omitempty"`        // Label of the items being packed, e.g. cans
+    TotalWeight float64        `json:"totalWeight,omitempty"` // Weight of all packs, set when a weight limit applies
+    TotalCost   Cost           `json:"totalCost,omitempty"`   // Price of all packs, set when the catalog has costs
+    Utilization float64        `json:"utilization,omitempty"` // Share of the shipped items that were ordered, omitted for an empty order
+    Display     *DisplayTotals `json:"display,omitempty"`     // Totals in display units, set when a display unit is requested
+    Solutions   []Result       `json:"solutions,omitempty"`   // Every co-optimal breakdown when all solutions are requested
+}
+
+// Calculate returns the pack breakdown for an order of items following the rules:
+// only whole packs are sent, no more items than necessary are sent, and within
+// that as few packs as possible are sent. The mode in opts decides whether the
+// order may be overshipped, must be matched exactly, or may be partially filled,
+// and the strategy whether fewer packs take precedence over fewer items. Orders
+// below the minimum order quantity are raised to it, or rejected if opts asks to.
+//
+// When several breakdowns tie on both items and packs, Calculate deterministically
+// returns the one whose packs, listed largest first, compare lexicographically
+// greatest: it uses the largest pack it can, then the largest pack it can for what
+// remains, and so on. The order of the packs slice never affects the result. Packs
+// given a Priority are preferred over lower priorities before size breaks the tie,
+// except under a weight limit, where the lightest breakdown is chosen instead.
+//
+// Calculate is safe for concurrent use. It is a pure function: it allocates its
+// working tables per call and never modifies the packs slice it is given. The only
+// state it shares between calls is remainderCache, which never changes a result.
+func Calculate(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+    if items < 0 {
+        return Result{}, ErrInvalidItems
+    }
+
+    if !ValidStrategy(opts.Strategy) {
+        return Result{}, ErrInvalidStrategy
+    }
+
+    if !ValidAlgorithm(opts.Algorithm) {
+        return Result{}, ErrInvalidAlgorithm
+    }
+
+    if !ValidMode(opts.Mode) {
+        return Result{}, ErrInvalidMode
+    }
+
+    if opts.MaxOvershipPercent != nil && *opts.MaxOvershipPercent < 0 {
+        return Result{}, ErrInvalidTolerance
+    }
+
+    if opts.MaxWeight != nil && *opts.MaxWeight < 0 {
+        return Result{}, ErrInvalidWeight
+    }
+
+    if opts.MinOrder < 0 {
+        return Result{}, ErrInvalidMinOrder
+    }
+
+    if opts.MinDistinctSizes < 0 {
+        return Result{}, ErrInvalidDistinctSizes
+    }
+
+    if opts.LimitStock && (opts.MaxWeight != nil || opts.MinDistinctSizes > 1) {
+        return Result{}, ErrStockConstraints
+    }
+
+    opts.Trace.add("calculating %d items in %s mode with the %s strategy and %s algorithm",
+        items, orDefault(opts.Mode, ModeOvership), orDefault(opts.Strategy, StrategyBalanced), orDefault(opts.Algorithm, AlgorithmDP))
+
+    if opts.Mode == ModePreferExact {
+        return preferExact(packs, items, opts)
+    }
+
+    // Orders below the minimum order quantity are packed as if the minimum was ordered.
+    if items > 0 && items < opts.MinOrder {
+        if opts.RejectBelowMinOrder {
+            opts.Trace.add("rejected: below the minimum order of %d", opts.MinOrder)
+            return Result{}, ErrBelowMinOrder
+        }
+        opts.Trace.add("raised to the minimum order of %d", opts.MinOrder)
+        items = opts.MinOrder
+    }
+
+    // An empty order needs no packs, whatever the catalog holds.
+    if items == 0 {
+        opts.Trace.add("empty order, no packs needed")
+        return Result{Packs: []PackQuantity{}}, nil
+    }
+
+    sizes, err := packSizes(packs)
+    if err != nil {
+        opts.Trace.add("rejected the catalog: %s", err)
+        return Result{}, err
+    }
+    opts.Trace.add("pack sizes %v", sizes)
+
+    var weight *weightLimit
+    if opts.MaxWeight != nil {
+        weight = newWeightLimit(packs, *opts.MaxWeight)
+    }
+
+    // An order matching a pack size is always a single pack of that size in every
+    // mode and strategy: it ships no extra items and no breakdown has fewer packs.
+    // Under a weight limit that holds only while the pack itself is light enough, and
+    // it never uses more than one distinct size.
+    for _, size := range sizes {
+        if size == items && opts.MinDistinctSizes <= 1 && (weight == nil || approxAtMost(weight.weights[size], weight.max)) {
+            opts.Trace.add("the order matches the %d pack, shipping it alone", size)
+            return weight.weigh(Result{Packs: []PackQuantity{{Pack: size, Quantity: 1}}, TotalItems: size, TotalPacks: 1}), nil
+        }
+    }
+
+    // Orders no combination of packs can fill are rejected in exact mode before building
+    // tables as large as the order.
+    if opts.Mode == ModeExact && !remainderCache.For(sizes).Fillable(items) {
+        opts.Trace.add("no combination of the sizes sums to %d, skipping the tables", items)
+        return Result{}, ErrUnfillable
+    }
+
+    limit := items
+    if opts.Mode != ModeExact && opts.Mode != ModePartial {
+        // Any total at or beyond items+largest could drop a pack and still cover the order,
+        // so the optimal total is always below that limit. Dropping a pack never adds
+        // weight either, so this holds under a weight limit too.
+        limit = items + sizes[0] - 1
+
+        // Spread across distinct sizes, the optimal total is below items plus one pack of
+        // each of the largest sizes it needs: anything beyond that could drop a pack too.
+        if spread := opts.MinDistinctSizes; spread > 1 && spread <= len(sizes) {
+            limit = items - 1
+            for _, size := range sizes[:spread] {
+                limit += size
+            }
+        }
+
+        // The overshipment tolerance caps the totals considered, excluding anything above it.
+        // It is compared in float64, since a huge percentage would overflow an int.
+        if opts.MaxOvershipPercent != nil {
+            if tolerated := float64(items) + float64(items)**opts.MaxOvershipPercent/100; tolerated < float64(limit) {
+                limit = int(tolerated)
+            }
+        }
+    }
+
+    // Stock limits need a bounded DP, which always finds the optimal breakdown whatever
+    // the algorithm. Pack priorities don't apply to it, size alone breaks ties.
+    opts.Trace.add("considering totals up to %d", limit)
+
+    if stock := packStock(packs); opts.LimitStock && stock != nil {
+        opts.Trace.add("limiting sizes to their stock %v with the bounded DP", stock)
+        result, err := calculateStock(sizes, stock, items, limit, opts)
+        if err == nil {
+            opts.Trace.add("picked %d items in %d packs within stock", result.TotalItems, result.TotalPacks)
+        }
+        return result, err
+    }
+
+    counts, last := algorithmFor(opts.Algorithm).Tables(sizes, limit)
+    opts.Trace.add("built the %s tables", orDefault(opts.Algorithm, AlgorithmDP))
+    if weight != nil {
+        weight.plan(sizes, counts, last)
+        opts.Trace.add("restricted the tables to breakdowns weighing at most %g", weight.max)
+    }
+
+    plan := planner{sizes: sizes, counts: counts, last: last, weight: weight, priority: packPriorities(packs)}
+
+    if opts.MinDistinctSizes > 1 {
+        if result, ok := plan.spread(items, limit, opts); ok {
+            opts.Trace.add("picked %d items in %d packs across at least %d sizes", result.TotalItems, result.TotalPacks, opts.MinDistinctSizes)
+            return result, nil
+        }
+        opts.Trace.add("no breakdown uses %d distinct sizes", opts.MinDistinctSizes)
+        // No breakdown uses enough distinct sizes, so the order is packed as usual.
+    }
+
+    switch opts.Mode {
+    case ModeExact:
+        if plan.packs(items) < 0 {
+            if counts[items] >= 0 {
+                opts.Trace.add("every exact breakdown is too heavy")
+                return Result{}, ErrWeightExceeded // Fillable, but every breakdown is too heavy
+            }
+            opts.Trace.add("no exact breakdown")
+            return Result{}, ErrUnfillable
+        }
+
+        opts.Trace.add("picked the exact breakdown in %d packs", plan.packs(items))
+        return plan.breakdown(items), nil
+    case ModePartial:
+        total := items
+        for plan.packs(total) < 0 {
+            total-- // The empty breakdown always qualifies, so this stops at 0
+        }
+
+        result := plan.breakdown(total)
+        result.Shortfall = items - total
+        opts.Trace.add("picked %d items in %d packs, %d short", total, result.TotalPacks, result.Shortfall)
+
+        return result, nil
+    }
+
+    best, heavy := -1, false
+    for total := items; total <= limit; total++ {
+        n := plan.packs(total)
+        if n < 0 {
+            heavy = heavy || counts[total] >= 0
+            continue
+        }
+
+        if opts.Strategy != StrategyFewestPacks {
+            opts.Trace.add("picked %d items, the smallest qualifying total, in %d packs", total, n)
+            return plan.breakdown(total), nil // The first qualifying total ships the fewest items
+        }
+
+        if best < 0 || n < plan.packs(best) {
+            best = total // Keep the smallest total among those with the fewest packs
+        }
+    }
+
+    if best >= 0 {
+        opts.Trace.add("picked %d items in %d packs, the fewest of any qualifying total", best, plan.packs(best))
+        return plan.breakdown(best), nil
+    }
+
+    if heavy {
+        opts.Trace.add("every breakdown within the limit is too heavy")
+        return Result{}, ErrWeightExceeded
+    }
+
+    opts.Trace.add("no breakdown within the overshipment tolerance")
+    // Without a tolerance the largest pack repeated always reaches a total within the limit.
+    return Result{}, ErrOvershipExceeded
+}
+
+// preferExact calculates the order in exact mode, falling back to overship mode, with the
+// result flagged approximate, when no breakdown matches the order exactly within the
+// constraints. The feasibility check of exact mode keeps the fallback cheap.
+func preferExact(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+    opts.Mode = ModeExact
+    result, err := Calculate(packs, items, opts)
+    if !errors.Is(err, ErrUnfillable) && !errors.Is(err, ErrWeightExceeded) && !errors.Is(err, ErrStockExceeded) {
+        return result, err
+    }
+
+    opts.Trace.add("no exact breakdown, falling back to overship mode")
+    opts.Mode = ModeOvership
+    result, err = Calculate(packs, items, opts)
+    if err != nil {
+        return Result{}, err
+    }
+
+    result.Approximate = true
+    return result, nil
+}
+
+// planner picks breakdowns from the fewestPacks tables, honouring the weight limit when there is one.
+type planner struct {
+    sizes  []int
+    counts []int
+    last   []int
+    weight   *weightLimit // nil without a weight limit
+    priority map[int]int  // Highest priority of each pack size, nil when no pack has one
+}
+
+// packs returns the number of packs in the breakdown of total, or -1 when total
+// can't be reached within the weight limit.
+func (p planner) packs(total int) int {
+    switch {
+    case p.counts[total] < 0:
+        return -1
+    case p.weight == nil || approxAtMost(p.weight.fewest[total], p.weight.max):
+        return p.counts[total]
+    case approxAtMost(p.weight.lightest[total], p.weight.max):
+        return p.weight.lightCounts[total]
+    }
+
+    return -1
+}
+
+// breakdown returns the breakdown of total: the fewest packs when they are light
+// enough, otherwise the lightest packs.
+func (p planner) breakdown(total int) Result {
+    if p.weight == nil && p.priority != nil {
+        return p.prioritized(total)
+    }
+
+    if p.weight == nil {
+        return breakdown(total, p.last, p.sizes)
+    }
+
+    if approxAtMost(p.weight.fewest[total], p.weight.max) {
+        return p.weight.weigh(breakdown(total, p.last, p.sizes))
+    }
+
+    return p.weight.weigh(breakdown(total, p.weight.light, p.sizes))
+}
+
+// spread returns the breakdown of items that uses at least opts.MinDistinctSizes
+// distinct pack sizes, choosing among totals by the mode and strategy as Calculate
+// does. It reports false when no total up to limit has such a breakdown.
+//
+// A breakdown with at least k distinct sizes holds one pack of each of some k sizes
+// plus any packs on top, so the fewest packs reaching a total that way is k plus the
+// fewest packs for what the k sizes leave over.
+func (p planner) spread(items, limit int, opts CalculateOptions) (Result, bool) {
+    if opts.MinDistinctSizes > len(p.sizes) {
+        return Result{}, false
+    }
+
+    subsets := distinctSubsets(p.sizes, opts.MinDistinctSizes)
+
+    first, last, step := items, limit, 1
+    switch opts.Mode {
+    case ModeExact:
+        last = items
+    case ModePartial:
+        last, step = 1, -1 // Never overship, fill as much of the order as possible
+    }
+
+    best, fewest := Result{}, -1
+    for total := first; total*step <= last*step; total += step {
+        result, n := p.spreadTotal(total, subsets)
+        if n < 0 {
+            continue
+        }
+
+        result.Shortfall = max(items-total, 0)
+        if opts.Mode == ModeExact || opts.Mode == ModePartial || opts.Strategy != StrategyFewestPacks {
+            return result, true // The first qualifying total ships the fewest items
+        }
+
+        if fewest < 0 || n < fewest {
+            best, fewest = result, n // Keep the smallest total among those with the fewest packs
+        }
+    }
+
+    return best, fewest >= 0
+}
+
+// spreadTotal returns the breakdown of total with the fewest packs that starts with one
+// pack of each size in one of the subsets, and its number of packs, or -1 when there
+// is none within the weight limit.
+func (p planner) spreadTotal(total int, subsets [][]int) (Result, int) {
+    best, fewest := Result{}, -1
+
+    for _, subset := range subsets {
+        rest := total
+        for _, size := range subset {
+            rest -= size
+        }
+
+        if rest < 0 {
+            continue
+        }
+
+        n := p.packs(rest)
+        if n < 0 || fewest >= 0 && n+len(subset) >= fewest {
+            continue
+        }
+
+        result := p.breakdown(rest)
+        result = mergeBreakdown(result, subset, p.sizes)
+        if p.weight != nil {
+            if result = p.weight.weigh(result); !approxAtMost(result.TotalWeight, p.weight.max) {
+                continue
+            }
+        }
+
+        best, fewest = result, n+len(subset)
+    }
+
+    return best, fewest
+}
+
+// distinctSubsets returns every choice of k of the sizes, keeping only the first choice
+// for each sum since those leave the same total over. sizes are in descending order,
+// so larger sizes are chosen first.
+func distinctSubsets(sizes []int, k int) [][]int {
+    var subsets [][]int
+    sums := make(map[int]bool)
+
+    var choose func(start int, chosen []int, sum int)
+    choose = func(start int, chosen []int, sum int) {
+        if len(chosen) == k {
+            if !sums[sum] {
+                sums[sum] = true
+                subsets = append(subsets, append([]int(nil), chosen...))
+            }
+            return
+        }
+
+        for i := start; i <= len(sizes)-(k-len(chosen)); i++ {
+            choose(i+1, append(chosen, sizes[i]), sum+sizes[i])
+        }
+    }
+    choose(0, nil, 0)
+
+    return subsets
+}
+
+// mergeBreakdown adds one pack of each of the extra sizes to a breakdown, keeping its
+// packs in the descending order of sizes.
+func mergeBreakdown(result Result, extra []int, sizes []int) Result {
+    quantities := make(map[int]int, len(sizes))
+    for _, line := range result.Packs {
+        quantities[line.Pack] = line.Quantity
+    }
+    for _, size := range extra {
+        quantities[size]++
+        result.TotalItems += size
+        result.TotalPacks++
+    }
+
+    result.Packs = make([]PackQuantity, 0, len(quantities))
+    for _, size := range sizes {
+        if quantities[size] > 0 {
+            result.Packs = append(result.Packs, PackQuantity{Pack: size, Quantity: quantities[size]})
+        }
+    }
+
+    return result
+}
+
+// prioritized walks the counts table back from total like breakdown does, but of the
+// packs that keep the breakdown at the fewest packs it takes the one with the highest
+// priority, the largest among equal priorities.
+func (p planner) prioritized(total int) Result {
+    quantities := make(map[int]int, len(p.sizes))
+    result := Result{Packs: []PackQuantity{}, TotalItems: total}
+
+    for t := total; t > 0; {
+        pick := 0
+        for _, size := range p.sizes {
+            if size > t || p.counts[t-size] != p.counts[t]-1 {
+                continue
+            }
+
+            if pick == 0 || p.priority[size] > p.priority[pick] {
+                pick = size // Sizes are descending, so equal priorities keep the larger
+            }
+        }
+
+        quantities[pick]++
+        result.TotalPacks++
+        t -= pick
+    }
+
+    for _, size := range p.sizes {
+        if quantities[size] > 0 {
+            result.Packs = append(result.Packs, PackQuantity{Pack: size, Quantity: quantities[size]})
+        }
+    }
+
+    return result
+}
+
+// packPriorities returns the highest priority given to each pack size, or nil when no
+// pack has a priority and the size alone breaks ties.
+func packPriorities(packs []Pack) map[int]int {
+    var priorities map[int]int
+
+    for _, pack := range packs {
+        if pack.Priority != 0 {
+            priorities = make(map[int]int, len(packs))
+            break
+        }
+    }
+
+    if priorities == nil {
+        return nil
+    }
+
+    for _, pack := range packs {
+        if priority, ok := priorities[pack.Size]; !ok || pack.Priority > priority {
+            priorities[pack.Size] = pack.Priority
+        }
+    }
+
+    return priorities
+}
+
+// weightLimit caps the total weight of a breakdown.
+type weightLimit struct {
+    max         float64
+    weights     map[int]float64 // Weight of each pack size, the lightest when several packs share a size
+    fewest      []float64       // fewest[t] is the weight of the fewest-packs breakdown of t
+    lightest    []float64       // lightest[t] is the lowest weight of any breakdown of t, -1 if unreachable
+    light       []int           // light[t] is the size of the pack added to reach t most lightly
+    lightCounts []int           // lightCounts[t] is the number of packs in the lightest breakdown of t
+}
+
+// newWeightLimit returns a limit of max on the total weight of the packs.
+func newWeightLimit(packs []Pack, max float64) *weightLimit {
+    weights := make(map[int]float64, len(packs))
+    for _, pack := range packs {
+        if weight, ok := weights[pack.Size]; !ok || approxLess(pack.Weight, weight) {
+            weights[pack.Size] = pack.Weight
+        }
+    }
+
+    return &weightLimit{max: max, weights: weights}
+}
+
+// plan weighs the fewest-packs breakdown of every total and finds the lightest breakdown
+// of every total, preferring fewer packs among equally light ones. sizes must be in
+// descending order, as for fewestPacks.
+func (w *weightLimit) plan(sizes []int, counts []int, last []int) {
+    limit := len(counts) - 1
+
+    w.fewest = make([]float64, limit+1)
+    w.lightest = make([]float64, limit+1)
+    w.light = make([]int, limit+1)
+    w.lightCounts = make([]int, limit+1)
+
+    for total := 1; total <= limit; total++ {
+        if counts[total] >= 0 {
+            w.fewest[total] = w.fewest[total-last[total]] + w.weights[last[total]]
+        }
+
+        w.lightest[total] = -1
+
+        for _, size := range sizes {
+            if size > total || w.lightest[total-size] < 0 {
+                continue
+            }
+
+            weight := w.lightest[total-size] + w.weights[size]
+            if w.lightest[total] < 0 || approxLess(weight, w.lightest[total]) || approxEqual(weight, w.lightest[total]) && w.lightCounts[total-size]+1 < w.lightCounts[total] {
+                w.lightest[total] = weight
+                w.light[total] = size
+                w.lightCounts[total] = w.lightCounts[total-size] + 1
+            }
+        }
+    }
+}
+
+// weigh sets the total weight of the result. It is a no-op on a nil limit.
+func (w *weightLimit) weigh(result Result) Result {
+    if w == nil {
+        return result
+    }
+
+    result.TotalWeight = 0
+    for _, line := range result.Packs {
+        result.TotalWeight += float64(line.Quantity) * w.weights[line.Pack]
+    }
+
+    return result
+}
+
+// Solutions returns every breakdown that ties with the one Calculate picks on both
+// items shipped and packs used, at most max of them. The breakdown Calculate picks
+// always comes first, followed by the others in descending order of their packs.
+func Solutions(packs []Pack, items int, opts CalculateOptions, max int) ([]Result, error) {
+    best, err := Calculate(packs, items, opts)
+    if err != nil {
+        return nil, err
+    }
+
+    // Under a weight or stock limit or spread across distinct sizes the picked breakdown
+    // may not have the fewest packs for its total, so only it is returned.
+    if best.TotalPacks == 0 || max <= 1 || opts.MaxWeight != nil || opts.MinDistinctSizes > 1 || opts.LimitStock {
+        return []Result{best}, nil
+    }
+
+    sizes, err := packSizes(packs)
+    if err != nil {
+        return nil, err
+    }
+
+    counts, _ := fewestPacks(sizes, best.TotalItems)
+    quantities := make([]int, len(sizes))
+    solutions := []Result{best}
+
+    // Sizes are picked in descending order so each multiset of packs is visited once.
+    // A size can only be part of a tying breakdown if what remains after it needs
+    // exactly one pack fewer, which counts already knows.
+    var walk func(total, remaining, from int)
+    walk = func(total, remaining, from int) {
+        if len(solutions) >= max {
+            return
+        }
+
+        if total == 0 {
+            result := Result{Packs: []PackQuantity{}, TotalItems: best.TotalItems, TotalPacks: best.TotalPacks, Shortfall: best.Shortfall, Approximate: best.Approximate}
+            for i, size := range sizes {
+                if quantities[i] > 0 {
+                    result.Packs = append(result.Packs, PackQuantity{Pack: size, Quantity: quantities[i]})
+                }
+            }
+            if !samePacks(result.Packs, best.Packs) { // The picked breakdown is already first
+                solutions = append(solutions, result)
+            }
+            return
+        }
+
+        for i := from; i < len(sizes); i++ {
+            if sizes[i] > total || counts[total-sizes[i]] != remaining-1 {
+                continue
+            }
+
+            quantities[i]++
+            walk(total-sizes[i], remaining-1, i)
+            quantities[i]--
+        }
+    }
+    walk(best.TotalItems, best.TotalPacks, 0)
+
+    return solutions, nil
+}
+
+// samePacks reports whether two breakdowns hold the same packs in the same order.
+func samePacks(a, b []PackQuantity) bool {
+    if len(a) != len(b) {
+        return false
+    }
+
+    for i := range a {
+        if a[i].Pack != b[i].Pack || a[i].Quantity != b[i].Quantity {
+            return false
+        }
+    }
+
+    return true
+}
+
+// Nearest returns the breakdowns of the closest quantities at or below and at or above
+// items that whole packs fill exactly, each with as few packs as possible. Both are the
+// order itself when it can be filled exactly, and below is empty when nothing up to
+// items can be filled.
+func Nearest(packs []Pack, items int) (below Result, above Result, err error) {
+    if items < 0 {
+        return Result{}, Result{}, ErrInvalidItems
+    }
+
+    sizes, err := packSizes(packs)
+    if err != nil {
+        return Result{}, Result{}, err
+    }
+
+    // Any total at or beyond items+largest could drop a pack and still cover the order.
+    counts, last := fewestPacks(sizes, items+sizes[0]-1)
+
+    low := items
+    for counts[low] < 0 {
+        low-- // counts[0] is always 0, so this stops at an empty breakdown
+    }
+
+    high := items
+    for counts[high] < 0 {
+        high++ // The largest pack repeated always reaches a total within the limit
+    }
+
+    return breakdown(low, last, sizes), breakdown(high, last, sizes), nil
+}
+
+// weightScale is the number of weight units per unit of weight, so weights are
+// compared to three decimal places.
+const weightScale = 1000
+
+// maxTargetWeight bounds the target weight of CalculateByWeight, since the calculation
+// allocates memory proportional to it.
+const maxTargetWeight = 10000
+
+// CalculateByWeight returns the packs whose total weight reaches target with the least
+// overshoot, and with as few packs as possible for that weight. Packs without a weight
+// are left out, and among packs of equal weight the largest is used.
+func CalculateByWeight(packs []Pack, target float64) (Result, error) {
+    if target <= 0 || target > maxTargetWeight {
+        return Result{}, ErrInvalidTargetWeight
+    }
+
+    // The DP works on whole weight units, so each weight stands in for a pack size.
+    sizes := make(map[int]int) // Largest pack size of each weight in units
+    for _, pack := range packs {
+        units := int(math.Round(pack.Weight * weightScale))
+        if units > 0 && pack.Size > sizes[units] {
+            sizes[units] = pack.Size
+        }
+    }
+
+    if len(sizes) == 0 {
+        return Result{}, ErrNoWeights
+    }
+
+    weights := make([]int, 0, len(sizes))
+    for units := range sizes {
+        weights = append(weights, units)
+    }
+    sort.Sort(sort.Reverse(sort.IntSlice(weights)))
+
+    targetUnits := int(approxCeil(target * weightScale))
+
+    // As with items, a weight at or beyond target+heaviest could drop a pack and still reach the target.
+    counts, last := fewestPacks(weights, targetUnits+weights[0]-1)
+
+    total := targetUnits
+    for counts[total] < 0 {
+        total++ // The heaviest pack repeated always reaches a weight within the limit
+    }
+
+    quantities := make(map[int]int, len(weights))
+    for units := total; units > 0; units -= last[units] {
+        quantities[sizes[last[units]]]++
+    }
+
+    result := Result{Packs: []PackQuantity{}, TotalWeight: float64(total) / weightScale}
+
+    bySize := make([]int, 0, len(quantities))
+    for size := range quantities {
+        bySize = append(bySize, size)
+    }
+    sort.Sort(sort.Reverse(sort.IntSlice(bySize)))
+
+    for _, size := range bySize {
+        result.Packs = append(result.Packs, PackQuantity{Pack: size, Quantity: quantities[size]})
+        result.TotalItems += size * quantities[size]
+        result.TotalPacks += quantities[size]
+    }
+
+    return result, nil
+}
+
+// CalculateCombined fills an order from several named pack catalogs at once and
+// annotates each line of the breakdown with the depot supplying it. When more
+// than one depot stocks a size, the depot whose name sorts first supplies it.
+func CalculateCombined(depots map[string][]Pack, items int, opts CalculateOptions) (Result, error) {
+    names := make([]string, 0, len(depots))
+    for name := range depots {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var packs []Pack
+    sources := make(map[int]string)
+
+    for _, name := range names {
+        for _, pack := range depots[name] {
+            if _, ok := sources[pack.Size]; !ok {
+                sources[pack.Size] = name
+            }
+            packs = append(packs, pack)
+        }
+    }
+
+    result, err := Calculate(packs, items, opts)
+    if err != nil {
+        return Result{}, err
+    }
+
+    for i := range result.Packs {
+        result.Packs[i].Depot = sources[result.Packs[i].Pack]
+    }
+
+    return result, nil
+}
+
+// SKUOrder is the order for one product, packed from its own catalog.
+type SKUOrder struct {
+    Packs []Pack // Catalog of the product
+    Items int    // Number of items ordered
+}
+
+// MultiResult is the breakdown of an order spanning several products.
+type MultiResult struct {
+    SKUs       map[string]Result `json:"skus"`       // Breakdown of each product
+    TotalItems int               `json:"totalItems"` // Items shipped across all products
+    TotalPacks int               `json:"totalPacks"` // Packs shipped across all products
+}
+
+// CalculateMulti packs an order of several products, each from its own catalog, and
+// totals the breakdowns. It fails on the first product, by name, that can't be packed.
+func CalculateMulti(orders map[string]SKUOrder, opts CalculateOptions) (MultiResult, error) {
+    names := make([]string, 0, len(orders))
+    for name := range orders {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    multi := MultiResult{SKUs: make(map[string]Result, len(orders))}
+
+    for _, name := range names {
+        result, err := Calculate(orders[name].Packs, orders[name].Items, opts)
+        if err != nil {
+            return MultiResult{}, fmt.Errorf("sku %s: %w", name, err)
+        }
+
+        multi.SKUs[name] = result
+        multi.TotalItems += result.TotalItems
+        multi.TotalPacks += result.TotalPacks
+    }
+
+    return multi, nil
+}
+
+// PackDelta is the change in quantity of one pack size between two breakdowns.
+type PackDelta struct {
+    Pack   int `json:"pack"`   // Size of the pack
+    Before int `json:"before"` // Quantity in the first breakdown
+    After  int `json:"after"`  // Quantity in the second breakdown
+}
+
+// coalescePacks merges the lines of a breakdown that share a pack size and depot,
+// drops empty lines and sorts the rest by pack size descending, then by depot.
+// Responses pass through it so clients see the same shape whatever built the breakdown.
+func coalescePacks(lines []PackQuantity) []PackQuantity {
+    type line struct {
+        pack  int
+        depot string
+    }
+
+    quantities := make(map[line]int, len(lines))
+    for _, l := range lines {
+        quantities[line{l.Pack, l.Depot}] += l.Quantity
+    }
+
+    coalesced := make([]PackQuantity, 0, len(quantities))
+    for l, quantity := range quantities {
+        if quantity > 0 {
+            coalesced = append(coalesced, PackQuantity{Pack: l.pack, Quantity: quantity, Depot: l.depot})
+        }
+    }
+
+    sort.Slice(coalesced, func(i, j int) bool {
+        if coalesced[i].Pack != coalesced[j].Pack {
+            return coalesced[i].Pack > coalesced[j].Pack
+        }
+        return coalesced[i].Depot < coalesced[j].Depot
+    })
+
+    return coalesced
+}
+
+// utilization returns the share of the shipped items that were ordered, 1 when nothing
+// beyond the order ships, as for a partial fill. It is 0 for an empty order, which has
+// nothing to utilize, so responses omit it.
+func utilization(requested, shipped int) float64 {
+    if requested == 0 {
+        return 0
+    }
+
+    if shipped <= requested {
+        return 1
+    }
+
+    return float64(requested) / float64(shipped)
+}
+
+// DiffBreakdowns lists every pack size whose quantity differs between two breakdowns,
+// largest size first.
+func DiffBreakdowns(before, after []PackQuantity) []PackDelta {
+    quantities := make(map[int]*PackDelta)
+
+    for _, line := range before {
+        quantities[line.Pack] = &PackDelta{Pack: line.Pack, Before: line.Quantity}
+    }
+
+    for _, line := range after {
+        if delta, ok := quantities[line.Pack]; ok {
+            delta.After = line.Quantity
+        } else {
+            quantities[line.Pack] = &PackDelta{Pack: line.Pack, After: line.Quantity}
+        }
+    }
+
+    deltas := []PackDelta{}
+    for _, delta := range quantities {
+        if delta.Before != delta.After {
+            deltas = append(deltas, *delta)
+        }
+    }
+
+    sort.Slice(deltas, func(i, j int) bool { return deltas[i].Pack > deltas[j].Pack })
+
+    return deltas
+}
+
+// fewestPacks computes, for every total up to limit, the fewest packs summing exactly to it.
+// counts[t] is that number or -1 if t is unreachable, and last[t] the size of the pack added to reach t.
+// sizes must be in descending order: on ties last[t] keeps the first, and so largest, size.
+func fewestPacks(sizes []int, limit int) (counts []int, last []int) {
+    counts = make([]int, limit+1)
+    last = make([]int, limit+1)
+
+    for total := 1; total <= limit; total++ {
+        counts[total] = -1
+
+        for _, size := range sizes {
+            if size > total || counts[total-size] < 0 {
+                continue
+            }
+
+            if counts[total] < 0 || counts[total-size]+1 < counts[total] {
+                counts[total] = counts[total-size] + 1
+                last[total] = size
+            }
+        }
+    }
+
+    return counts, last
+}
+
+// packSizes returns the distinct pack sizes sorted in descending order.
+func packSizes(packs []Pack) ([]int, error) {
+    seen := make(map[int]bool, len(packs))
+    sizes := make([]int, 0, len(packs))
+
+    for _, pack := range packs {
+        if pack.Size <= 0 {
+            return nil, ErrInvalidPackSize
+        }
+
+        if !seen[pack.Size] {
+            seen[pack.Size] = true
+            sizes = append(sizes, pack.Size)
+        }
+    }
+
+    if len(sizes) == 0 {
+        return nil, ErrNoPacks
+    }
+
+    sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+    return sizes, nil
+}
+
+// breakdown walks the last table back from total and groups the packs by size.
+func breakdown(total int, last []int, sizes []int) Result {
+    quantities := make(map[int]int, len(sizes))
+    result := Result{Packs: []PackQuantity{}, TotalItems: total}
+
+    for t := total; t > 0; t -= last[t] {
+        quantities[last[t]]++
+        result.TotalPacks++
+    }
+
+    for _, size := range sizes {
+        if quantities[size] > 0 {
+            result.Packs = append(result.Packs, PackQuantity{Pack: size, Quantity: quantities[size]})
+        }
+    }
+
+    return result
+}
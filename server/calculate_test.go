@@ -0,0 +1,716 @@
+package main
+
+import (
+    "errors"
+    "math"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// defaultPacks is the reference catalog used across calculation tests.
+var defaultPacks = []Pack{{Size: 250}, {Size: 500}, {Size: 1000}, {Size: 2000}, {Size: 5000}}
+
+func TestCalculate(t *testing.T) {
+    tests := []struct {
+        items    int
+        expected []PackQuantity
+    }{
+        {1, []PackQuantity{{Pack: 250, Quantity: 1}}},
+        {250, []PackQuantity{{Pack: 250, Quantity: 1}}},
+        {251, []PackQuantity{{Pack: 500, Quantity: 1}}},
+        {501, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}},
+        {12001, []PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}}},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate(defaultPacks, test.items, CalculateOptions{})
+        if err != nil {
+            t.Fatalf("Calculate(%d) failed: %v", test.items, err)
+        }
+
+        if !reflect.DeepEqual(result.Packs, test.expected) {
+            t.Errorf("Calculate(%d): expected %v, got %v", test.items, test.expected, result.Packs)
+        }
+    }
+}
+
+func TestCalculateErrors(t *testing.T) {
+    if _, err := Calculate(nil, 10, CalculateOptions{}); err != ErrNoPacks {
+        t.Errorf("Expected ErrNoPacks, got %v", err)
+    }
+
+    if _, err := Calculate(defaultPacks, -1, CalculateOptions{}); err != ErrInvalidItems {
+        t.Errorf("Expected ErrInvalidItems, got %v", err)
+    }
+
+    if _, err := Calculate([]Pack{{Size: 0}}, 10, CalculateOptions{}); err != ErrInvalidPackSize {
+        t.Errorf("Expected ErrInvalidPackSize, got %v", err)
+    }
+
+    if _, err := Calculate(defaultPacks, 10, CalculateOptions{Mode: "cheapest"}); err != ErrInvalidMode {
+        t.Errorf("Expected ErrInvalidMode, got %v", err)
+    }
+}
+
+// TestCalculateConcurrent runs many calculations in parallel and checks each
+// matches its sequential result. Run with -race to detect shared state.
+func TestCalculateConcurrent(t *testing.T) {
+    catalogs := [][]Pack{
+        defaultPacks,
+        {{Size: 23}, {Size: 31}, {Size: 53}},
+        {{Size: 3}, {Size: 5}},
+    }
+
+    expected := make(map[[2]int]Result)
+    for c, packs := range catalogs {
+        for items := 0; items < 200; items += 7 {
+            result, err := Calculate(packs, items, CalculateOptions{})
+            if err != nil {
+                t.Fatalf("Calculate(%d) failed: %v", items, err)
+            }
+            expected[[2]int{c, items}] = result
+        }
+    }
+
+    var wg sync.WaitGroup
+    for key, want := range expected {
+        for i := 0; i < 5; i++ {
+            wg.Add(1)
+            go func(key [2]int, want Result) {
+                defer wg.Done()
+
+                got, err := Calculate(catalogs[key[0]], key[1], CalculateOptions{})
+                if err != nil || !reflect.DeepEqual(got, want) {
+                    t.Errorf("Catalog %d, items %d: expected %v, got %v (%v)", key[0], key[1], want, got, err)
+                }
+            }(key, want)
+        }
+    }
+    wg.Wait()
+}
+
+func TestCalculateExactMode(t *testing.T) {
+    packs := []Pack{{Size: 3}, {Size: 5}}
+
+    result, err := Calculate(packs, 11, CalculateOptions{Mode: ModeExact})
+    if err != nil {
+        t.Fatalf("Calculate(11) failed: %v", err)
+    }
+
+    expected := []PackQuantity{{Pack: 5, Quantity: 1}, {Pack: 3, Quantity: 2}}
+    if !reflect.DeepEqual(result.Packs, expected) {
+        t.Errorf("Expected %v, got %v", expected, result.Packs)
+    }
+
+    if _, err := Calculate(packs, 7, CalculateOptions{Mode: ModeExact}); err != ErrUnfillable {
+        t.Errorf("Expected ErrUnfillable for 7, got %v", err)
+    }
+}
+
+func TestCalculatePartialMode(t *testing.T) {
+    tests := []struct {
+        items     int
+        shipped   int
+        shortfall int
+        expected  []PackQuantity
+    }{
+        {7, 6, 1, []PackQuantity{{Pack: 3, Quantity: 2}}},
+        {4, 3, 1, []PackQuantity{{Pack: 3, Quantity: 1}}},
+        {2, 0, 2, []PackQuantity{}},
+        {10, 10, 0, []PackQuantity{{Pack: 5, Quantity: 2}}},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate([]Pack{{Size: 3}, {Size: 5}}, test.items, CalculateOptions{Mode: ModePartial})
+        if err != nil {
+            t.Fatalf("Calculate(%d) failed: %v", test.items, err)
+        }
+
+        if result.TotalItems != test.shipped || result.Shortfall != test.shortfall {
+            t.Errorf("Calculate(%d): expected %d shipped and %d short, got %d and %d",
+                test.items, test.shipped, test.shortfall, result.TotalItems, result.Shortfall)
+        }
+
+        if !reflect.DeepEqual(result.Packs, test.expected) {
+            t.Errorf("Calculate(%d): expected %v, got %v", test.items, test.expected, result.Packs)
+        }
+    }
+}
+
+func TestCalculateCombined(t *testing.T) {
+    depots := map[string][]Pack{
+        "north": {{Size: 250}, {Size: 500}},
+        "south": {{Size: 500}, {Size: 2000}},
+    }
+
+    result, err := CalculateCombined(depots, 2751, CalculateOptions{})
+    if err != nil {
+        t.Fatalf("CalculateCombined failed: %v", err)
+    }
+
+    // 500 is stocked by both depots and comes from north, whose name sorts first
+    expected := []PackQuantity{
+        {Pack: 2000, Quantity: 1, Depot: "south"},
+        {Pack: 500, Quantity: 2, Depot: "north"},
+    }
+    if !reflect.DeepEqual(result.Packs, expected) {
+        t.Errorf("Expected %v, got %v", expected, result.Packs)
+    }
+
+    if _, err := CalculateCombined(map[string][]Pack{}, 10, CalculateOptions{}); err != ErrNoPacks {
+        t.Errorf("Expected ErrNoPacks without depots, got %v", err)
+    }
+}
+
+func TestCalculateOvershipTolerance(t *testing.T) {
+    tolerance := func(percent float64) *float64 { return &percent }
+
+    // 501 is best filled with 750 items, an overshipment of about 50%
+    result, err := Calculate(defaultPacks, 501, CalculateOptions{MaxOvershipPercent: tolerance(50)})
+    if err != nil || result.TotalItems != 750 {
+        t.Errorf("Expected 750 items within a 50%% tolerance, got %+v (%v)", result, err)
+    }
+
+    if _, err := Calculate(defaultPacks, 501, CalculateOptions{MaxOvershipPercent: tolerance(5)}); err != ErrOvershipExceeded {
+        t.Errorf("Expected ErrOvershipExceeded with a 5%% tolerance, got %v", err)
+    }
+
+    // An exact fill is always within tolerance, even a zero one
+    result, err = Calculate(defaultPacks, 1500, CalculateOptions{MaxOvershipPercent: tolerance(0)})
+    if err != nil || result.TotalItems != 1500 {
+        t.Errorf("Expected an exact fill of 1500, got %+v (%v)", result, err)
+    }
+
+    // A tolerance too large to count in items leaves the order unconstrained
+    for _, percent := range []float64{1e300, math.MaxFloat64} {
+        result, err = Calculate(defaultPacks, 251, CalculateOptions{MaxOvershipPercent: tolerance(percent)})
+        if err != nil || result.TotalItems != 500 {
+            t.Errorf("Expected 500 items within a %g%% tolerance, got %+v (%v)", percent, result, err)
+        }
+    }
+
+    if _, err := Calculate(defaultPacks, 10, CalculateOptions{MaxOvershipPercent: tolerance(-1)}); err != ErrInvalidTolerance {
+        t.Errorf("Expected ErrInvalidTolerance, got %v", err)
+    }
+}
+
+func TestCalculateStrategies(t *testing.T) {
+    packs := []Pack{{Size: 250}, {Size: 500}, {Size: 1000}}
+
+    balanced, err := Calculate(packs, 501, CalculateOptions{Strategy: StrategyBalanced})
+    if err != nil || balanced.TotalItems != 750 || balanced.TotalPacks != 2 {
+        t.Errorf("Expected balanced to ship 750 items in 2 packs, got %+v (%v)", balanced, err)
+    }
+
+    fewest, err := Calculate(packs, 501, CalculateOptions{Strategy: StrategyFewestPacks})
+    if err != nil || fewest.TotalItems != 1000 || fewest.TotalPacks != 1 {
+        t.Errorf("Expected fewest_packs to ship 1000 items in 1 pack, got %+v (%v)", fewest, err)
+    }
+
+    // Among breakdowns with the fewest packs the one shipping fewer items wins
+    fewest, err = Calculate(packs, 1001, CalculateOptions{Strategy: StrategyFewestPacks})
+    if err != nil || fewest.TotalItems != 1250 || fewest.TotalPacks != 2 {
+        t.Errorf("Expected fewest_packs to ship 1250 items in 2 packs, got %+v (%v)", fewest, err)
+    }
+
+    if _, err := Calculate(packs, 1, CalculateOptions{Strategy: "cheapest"}); err != ErrInvalidStrategy {
+        t.Errorf("Expected ErrInvalidStrategy, got %v", err)
+    }
+}
+
+func TestCalculateOrderEqualToPackSize(t *testing.T) {
+    single := func(size int) []PackQuantity { return []PackQuantity{{Pack: size, Quantity: 1}} }
+
+    for _, pack := range defaultPacks {
+        size := pack.Size
+
+        // One below a size rounds up to that single pack
+        for _, items := range []int{size - 1, size} {
+            for _, opts := range []CalculateOptions{{}, {Strategy: StrategyFewestPacks}} {
+                result, err := Calculate(defaultPacks, items, opts)
+                if err != nil || !reflect.DeepEqual(result.Packs, single(size)) || result.TotalItems != size {
+                    t.Errorf("Calculate(%d, %+v): expected one %d pack, got %+v (%v)", items, opts, size, result, err)
+                }
+            }
+        }
+
+        result, err := Calculate(defaultPacks, size, CalculateOptions{Mode: ModeExact})
+        if err != nil || !reflect.DeepEqual(result.Packs, single(size)) {
+            t.Errorf("Calculate(%d, exact): expected one %d pack, got %+v (%v)", size, size, result, err)
+        }
+
+        // One above a size adds the smallest pack, except 251 where a single 500 ships fewer packs
+        expected := []PackQuantity{{Pack: size, Quantity: 1}, {Pack: 250, Quantity: 1}}
+        if size == 250 {
+            expected = single(500)
+        }
+
+        result, err = Calculate(defaultPacks, size+1, CalculateOptions{})
+        if err != nil || !reflect.DeepEqual(result.Packs, expected) {
+            t.Errorf("Calculate(%d): expected %v, got %+v (%v)", size+1, expected, result, err)
+        }
+    }
+}
+
+func TestCalculateEmptyOrder(t *testing.T) {
+    for _, packs := range [][]Pack{defaultPacks, nil} {
+        for _, mode := range []string{ModeOvership, ModeExact, ModePartial} {
+            result, err := Calculate(packs, 0, CalculateOptions{Mode: mode})
+            if err != nil {
+                t.Fatalf("Calculate(0, %s) failed: %v", mode, err)
+            }
+
+            if result.Packs == nil || len(result.Packs) != 0 || result.TotalItems != 0 || result.TotalPacks != 0 {
+                t.Errorf("Calculate(0, %s): expected an empty, non-nil breakdown, got %+v", mode, result)
+            }
+        }
+    }
+}
+
+func TestCalculateSolutions(t *testing.T) {
+    packs := []Pack{{Size: 2}, {Size: 3}, {Size: 4}}
+
+    // 6 items ship exactly in two packs either as 4+2 or as 3+3
+    solutions, err := Solutions(packs, 6, CalculateOptions{}, 10)
+    if err != nil {
+        t.Fatalf("Solutions failed: %v", err)
+    }
+
+    expected := []Result{
+        {Packs: []PackQuantity{{Pack: 4, Quantity: 1}, {Pack: 2, Quantity: 1}}, TotalItems: 6, TotalPacks: 2},
+        {Packs: []PackQuantity{{Pack: 3, Quantity: 2}}, TotalItems: 6, TotalPacks: 2},
+    }
+    if !reflect.DeepEqual(solutions, expected) {
+        t.Errorf("Expected %+v, got %+v", expected, solutions)
+    }
+
+    best, _ := Calculate(packs, 6, CalculateOptions{})
+    if !reflect.DeepEqual(solutions[0], best) {
+        t.Errorf("Expected the first solution to be the Calculate result %+v, got %+v", best, solutions[0])
+    }
+
+    if bounded, _ := Solutions(packs, 6, CalculateOptions{}, 1); len(bounded) != 1 {
+        t.Errorf("Expected the solutions to be bounded to 1, got %d", len(bounded))
+    }
+
+    // Ties are found among overshipping breakdowns too: 9 items ship as 10 in 8+2 or 6+4
+    packs = []Pack{{Size: 2}, {Size: 4}, {Size: 6}, {Size: 8}}
+    solutions, _ = Solutions(packs, 9, CalculateOptions{}, 10)
+    expected = []Result{
+        {Packs: []PackQuantity{{Pack: 8, Quantity: 1}, {Pack: 2, Quantity: 1}}, TotalItems: 10, TotalPacks: 2},
+        {Packs: []PackQuantity{{Pack: 6, Quantity: 1}, {Pack: 4, Quantity: 1}}, TotalItems: 10, TotalPacks: 2},
+    }
+    if !reflect.DeepEqual(solutions, expected) {
+        t.Errorf("Expected %+v, got %+v", expected, solutions)
+    }
+
+    if _, err := Solutions(nil, 6, CalculateOptions{}, 10); err != ErrNoPacks {
+        t.Errorf("Expected ErrNoPacks, got %v", err)
+    }
+}
+
+func TestCalculateDeterministicTieBreak(t *testing.T) {
+    // 9 items ship as 10 in two packs either as 8+2 or as 6+4
+    packs := []Pack{{Size: 2}, {Size: 4}, {Size: 6}, {Size: 8}}
+    expected := []PackQuantity{{Pack: 8, Quantity: 1}, {Pack: 2, Quantity: 1}}
+
+    orders := [][]Pack{
+        packs,
+        {{Size: 8}, {Size: 6}, {Size: 4}, {Size: 2}},
+        {{Size: 4}, {Size: 8}, {Size: 2}, {Size: 6}},
+    }
+
+    for run := 0; run < 50; run++ {
+        for _, order := range orders {
+            result, err := Calculate(order, 9, CalculateOptions{})
+            if err != nil {
+                t.Fatalf("Calculate failed: %v", err)
+            }
+
+            if !reflect.DeepEqual(result.Packs, expected) {
+                t.Fatalf("Run %d with packs %v: expected %v, got %v", run, order, expected, result.Packs)
+            }
+        }
+    }
+}
+
+func TestNearest(t *testing.T) {
+    packs := []Pack{{Size: 3}, {Size: 5}}
+
+    tests := []struct {
+        items int
+        below []PackQuantity
+        above []PackQuantity
+    }{
+        {7, []PackQuantity{{Pack: 3, Quantity: 2}}, []PackQuantity{{Pack: 5, Quantity: 1}, {Pack: 3, Quantity: 1}}},
+        {4, []PackQuantity{{Pack: 3, Quantity: 1}}, []PackQuantity{{Pack: 5, Quantity: 1}}},
+        {8, []PackQuantity{{Pack: 5, Quantity: 1}, {Pack: 3, Quantity: 1}}, []PackQuantity{{Pack: 5, Quantity: 1}, {Pack: 3, Quantity: 1}}},
+        {2, []PackQuantity{}, []PackQuantity{{Pack: 3, Quantity: 1}}},
+    }
+
+    for _, test := range tests {
+        below, above, err := Nearest(packs, test.items)
+        if err != nil {
+            t.Fatalf("Nearest(%d) failed: %v", test.items, err)
+        }
+
+        if !reflect.DeepEqual(below.Packs, test.below) || !reflect.DeepEqual(above.Packs, test.above) {
+            t.Errorf("Nearest(%d): expected %v and %v, got %v and %v", test.items, test.below, test.above, below.Packs, above.Packs)
+        }
+
+        if below.TotalItems > test.items || above.TotalItems < test.items {
+            t.Errorf("Nearest(%d): expected totals around the order, got %d and %d", test.items, below.TotalItems, above.TotalItems)
+        }
+    }
+
+    if _, _, err := Nearest(nil, 7); err != ErrNoPacks {
+        t.Errorf("Expected ErrNoPacks, got %v", err)
+    }
+}
+
+func TestCalculateWeightLimit(t *testing.T) {
+    weight := func(w float64) *float64 { return &w }
+
+    // 500s are heavy for their size: two 250s carry the same items lighter
+    packs := []Pack{{Size: 250, Weight: 1}, {Size: 500, Weight: 5}, {Size: 1000, Weight: 6}}
+
+    tests := []struct {
+        items     int
+        maxWeight *float64
+        expected  []PackQuantity
+        weight    float64
+        err       error
+    }{
+        {501, nil, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, 0, nil},
+        {501, weight(6), []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, 6, nil},
+        {501, weight(5), []PackQuantity{{Pack: 250, Quantity: 3}}, 3, nil},       // The cap swaps the 500 for lighter 250s
+        {500, weight(4), []PackQuantity{{Pack: 250, Quantity: 2}}, 2, nil},       // Even an order matching a pack size
+        {1000, weight(6), []PackQuantity{{Pack: 1000, Quantity: 1}}, 6, nil},
+        {1000, weight(3), nil, 0, ErrWeightExceeded},                            // Four 250s weigh 4, over the cap
+        {1, weight(0.5), nil, 0, ErrWeightExceeded},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate(packs, test.items, CalculateOptions{MaxWeight: test.maxWeight})
+        if err != test.err {
+            t.Errorf("Calculate(%d, maxWeight %v): expected error %v, got %v", test.items, test.maxWeight, test.err, err)
+            continue
+        }
+        if err != nil {
+            continue
+        }
+
+        if !reflect.DeepEqual(result.Packs, test.expected) || result.TotalWeight != test.weight {
+            t.Errorf("Calculate(%d, maxWeight %v): expected %v weighing %g, got %v weighing %g", test.items, test.maxWeight, test.expected, test.weight, result.Packs, result.TotalWeight)
+        }
+    }
+
+    // Exact mode reports a fillable order that is too heavy apart from one that can't be filled
+    if _, err := Calculate(packs, 1000, CalculateOptions{Mode: ModeExact, MaxWeight: weight(3)}); err != ErrWeightExceeded {
+        t.Errorf("Expected ErrWeightExceeded in exact mode, got %v", err)
+    }
+
+    // Partial mode ships less rather than exceeding the cap
+    result, err := Calculate(packs, 1000, CalculateOptions{Mode: ModePartial, MaxWeight: weight(3)})
+    if err != nil || result.TotalItems != 750 || result.Shortfall != 250 {
+        t.Errorf("Expected partial mode to ship 750 items, got %+v (%v)", result, err)
+    }
+
+    if _, err := Calculate(packs, 1, CalculateOptions{MaxWeight: weight(-1)}); err != ErrInvalidWeight {
+        t.Errorf("Expected ErrInvalidWeight, got %v", err)
+    }
+}
+
+func TestCalculateMinOrder(t *testing.T) {
+    tests := []struct {
+        items    int
+        opts     CalculateOptions
+        expected int
+        err      error
+    }{
+        {100, CalculateOptions{MinOrder: 600}, 750, nil},   // Raised to the MOQ before packing
+        {600, CalculateOptions{MinOrder: 600}, 750, nil},   // At the MOQ nothing changes
+        {1200, CalculateOptions{MinOrder: 600}, 1250, nil}, // Above the MOQ nothing changes
+        {0, CalculateOptions{MinOrder: 600}, 0, nil},       // An empty order stays empty
+        {100, CalculateOptions{MinOrder: 600, RejectBelowMinOrder: true}, 0, ErrBelowMinOrder},
+        {600, CalculateOptions{MinOrder: 600, RejectBelowMinOrder: true}, 750, nil},
+        {100, CalculateOptions{MinOrder: -1}, 0, ErrInvalidMinOrder},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate(defaultPacks, test.items, test.opts)
+        if err != test.err {
+            t.Errorf("Calculate(%d, %+v): expected error %v, got %v", test.items, test.opts, test.err, err)
+            continue
+        }
+
+        if err == nil && result.TotalItems != test.expected {
+            t.Errorf("Calculate(%d, %+v): expected %d items, got %d", test.items, test.opts, test.expected, result.TotalItems)
+        }
+    }
+}
+
+func TestCalculateMinDistinctSizes(t *testing.T) {
+    tolerance := 100.0
+
+    tests := []struct {
+        items    int
+        opts     CalculateOptions
+        expected []PackQuantity
+        err      error
+    }{
+        {1000, CalculateOptions{}, []PackQuantity{{Pack: 1000, Quantity: 1}}, nil},
+        {1000, CalculateOptions{MinDistinctSizes: 2}, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 2}}, nil},                              // Spread instead of one matching pack
+        {251, CalculateOptions{MinDistinctSizes: 2}, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, nil},                               // Overships further to use two sizes
+        {251, CalculateOptions{MinDistinctSizes: 2, Strategy: StrategyFewestPacks}, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, nil},
+        {12001, CalculateOptions{MinDistinctSizes: 3}, []PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}}, nil}, // Already spread
+        {251, CalculateOptions{MinDistinctSizes: 6}, []PackQuantity{{Pack: 500, Quantity: 1}}, nil},                                                         // More sizes than the catalog has
+        {251, CalculateOptions{MinDistinctSizes: 2, MaxOvershipPercent: &tolerance}, []PackQuantity{{Pack: 500, Quantity: 1}}, nil},                         // No spread within the tolerance
+        {500, CalculateOptions{MinDistinctSizes: 2, Mode: ModeExact}, []PackQuantity{{Pack: 500, Quantity: 1}}, nil},                                        // Two 250s use a single size
+        {1250, CalculateOptions{MinDistinctSizes: 3, Mode: ModeExact}, []PackQuantity{{Pack: 1000, Quantity: 1}, {Pack: 250, Quantity: 1}}, nil},            // No three sizes sum to 1250
+        {900, CalculateOptions{MinDistinctSizes: 2, Mode: ModePartial}, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, nil},
+        {1, CalculateOptions{MinDistinctSizes: -1}, nil, ErrInvalidDistinctSizes},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate(defaultPacks, test.items, test.opts)
+        if err != test.err {
+            t.Errorf("Calculate(%d, %+v): expected error %v, got %v", test.items, test.opts, test.err, err)
+            continue
+        }
+        if err != nil {
+            continue
+        }
+
+        if !reflect.DeepEqual(result.Packs, test.expected) {
+            t.Errorf("Calculate(%d, %+v): expected %v, got %v", test.items, test.opts, test.expected, result.Packs)
+        }
+
+        items, packs := 0, 0
+        for _, line := range result.Packs {
+            items += line.Pack * line.Quantity
+            packs += line.Quantity
+        }
+        if result.TotalItems != items || result.TotalPacks != packs {
+            t.Errorf("Calculate(%d, %+v): totals %d items in %d packs don't match %v", test.items, test.opts, result.TotalItems, result.TotalPacks, result.Packs)
+        }
+    }
+
+    // Partial mode reports what the spread breakdown leaves unshipped
+    if result, _ := Calculate(defaultPacks, 900, CalculateOptions{MinDistinctSizes: 2, Mode: ModePartial}); result.Shortfall != 150 {
+        t.Errorf("Expected a shortfall of 150, got %d", result.Shortfall)
+    }
+
+    // Under a weight limit the spread breakdown must still be light enough
+    weight := 2.0
+    packs := []Pack{{Size: 250, Weight: 1}, {Size: 500, Weight: 5}}
+    result, err := Calculate(packs, 500, CalculateOptions{MinDistinctSizes: 2, MaxWeight: &weight})
+    if err != nil || !reflect.DeepEqual(result.Packs, []PackQuantity{{Pack: 250, Quantity: 2}}) {
+        t.Errorf("Expected two light 250s when no spread fits the weight limit, got %+v (%v)", result, err)
+    }
+}
+
+func TestCalculatePriority(t *testing.T) {
+    tests := []struct {
+        packs    []Pack
+        items    int
+        expected []PackQuantity
+    }{
+        // 4+2 and 3+3 both ship 6 items in 2 packs
+        {[]Pack{{Size: 2}, {Size: 3}, {Size: 4}}, 6, []PackQuantity{{Pack: 4, Quantity: 1}, {Pack: 2, Quantity: 1}}},
+        {[]Pack{{Size: 2}, {Size: 3, Priority: 1}, {Size: 4}}, 6, []PackQuantity{{Pack: 3, Quantity: 2}}},
+        {[]Pack{{Size: 2}, {Size: 3, Priority: -1}, {Size: 4}}, 6, []PackQuantity{{Pack: 4, Quantity: 1}, {Pack: 2, Quantity: 1}}},
+        // 4+4+2 and 4+3+3 tie, the priority only swaps the packs it can
+        {[]Pack{{Size: 2}, {Size: 3, Priority: 5}, {Size: 4}}, 10, []PackQuantity{{Pack: 4, Quantity: 1}, {Pack: 3, Quantity: 2}}},
+        // Priority never costs an extra pack or item
+        {[]Pack{{Size: 2, Priority: 9}, {Size: 3}, {Size: 4}}, 8, []PackQuantity{{Pack: 4, Quantity: 2}}},
+        // Duplicated sizes use their highest priority
+        {[]Pack{{Size: 2}, {Size: 3}, {Size: 3, Priority: 2}, {Size: 4, Priority: 1}}, 6, []PackQuantity{{Pack: 3, Quantity: 2}}},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate(test.packs, test.items, CalculateOptions{})
+        if err != nil || !reflect.DeepEqual(result.Packs, test.expected) {
+            t.Errorf("Calculate(%v, %d): expected %v, got %v (%v)", test.packs, test.items, test.expected, result.Packs, err)
+        }
+    }
+
+    // Every algorithm and the cache honour the priority
+    packs := []Pack{{Size: 2}, {Size: 3, Priority: 1}, {Size: 4}}
+    for _, algorithm := range []string{AlgorithmDP, AlgorithmBFS} {
+        result, _ := Calculate(packs, 6, CalculateOptions{Algorithm: algorithm})
+        if !reflect.DeepEqual(result.Packs, []PackQuantity{{Pack: 3, Quantity: 2}}) {
+            t.Errorf("%s: expected the prioritized 3s, got %v", algorithm, result.Packs)
+        }
+    }
+
+    cache := NewCalculationCache(10, time.Minute)
+    cache.Calculate([]Pack{{Size: 2}, {Size: 3}, {Size: 4}}, 6, CalculateOptions{})
+    if result, _ := cache.Calculate(packs, 6, CalculateOptions{}); !reflect.DeepEqual(result.Packs, []PackQuantity{{Pack: 3, Quantity: 2}}) {
+        t.Errorf("Expected a change of priority to miss the cache, got %v", result.Packs)
+    }
+
+    // The prioritized breakdown leads the list of tying solutions
+    solutions, err := Solutions(packs, 6, CalculateOptions{}, 10)
+    if err != nil || len(solutions) != 2 || !reflect.DeepEqual(solutions[0].Packs, []PackQuantity{{Pack: 3, Quantity: 2}}) {
+        t.Errorf("Expected the prioritized breakdown first of two solutions, got %+v (%v)", solutions, err)
+    }
+}
+
+func TestCalculatePreferExact(t *testing.T) {
+    tests := []struct {
+        packs       []int
+        items       int
+        strategy    string
+        expected    []PackQuantity
+        approximate bool
+    }{
+        // Exact fills are returned as they are, even where overshipping would use fewer packs
+        {[]int{3, 10}, 9, StrategyFewestPacks, []PackQuantity{{Pack: 3, Quantity: 3}}, false},
+        {[]int{250, 500}, 750, StrategyBalanced, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, false},
+        // Otherwise the least overshipment is returned and flagged
+        {[]int{3, 5}, 7, StrategyBalanced, []PackQuantity{{Pack: 5, Quantity: 1}, {Pack: 3, Quantity: 1}}, true},
+        {[]int{250, 500}, 501, StrategyBalanced, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, true},
+    }
+
+    for _, test := range tests {
+        packs := make([]Pack, len(test.packs))
+        for i, size := range test.packs {
+            packs[i] = Pack{Size: size}
+        }
+
+        result, err := Calculate(packs, test.items, CalculateOptions{Mode: ModePreferExact, Strategy: test.strategy})
+        if err != nil || !reflect.DeepEqual(result.Packs, test.expected) || result.Approximate != test.approximate {
+            t.Errorf("%v, %d items: expected %v approximate %t, got %+v (%v)", test.packs, test.items, test.expected, test.approximate, result, err)
+        }
+    }
+
+    // Constraints still apply to the fallback
+    limit := 10.0
+    if _, err := Calculate([]Pack{{Size: 250}, {Size: 500}}, 501, CalculateOptions{Mode: ModePreferExact, MaxOvershipPercent: &limit}); !errors.Is(err, ErrOvershipExceeded) {
+        t.Errorf("Expected the fallback to respect the overshipment tolerance, got %v", err)
+    }
+}
+
+func TestCalculateByWeight(t *testing.T) {
+    // Weight table: a 250 pack weighs 2.5, a 500 pack 4.8 and a 1000 pack 9.1
+    packs := []Pack{{Size: 250, Weight: 2.5}, {Size: 500, Weight: 4.8}, {Size: 1000, Weight: 9.1}, {Size: 2000}}
+
+    tests := []struct {
+        weight   float64
+        expected []PackQuantity
+        total    float64
+    }{
+        {2.5, []PackQuantity{{Pack: 250, Quantity: 1}}, 2.5},
+        {4, []PackQuantity{{Pack: 500, Quantity: 1}}, 4.8},
+        {7, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, 7.3},
+        {9.1, []PackQuantity{{Pack: 1000, Quantity: 1}}, 9.1},
+        {120.5, []PackQuantity{{Pack: 1000, Quantity: 9}, {Pack: 500, Quantity: 7}, {Pack: 250, Quantity: 2}}, 120.5},
+        {0.1, []PackQuantity{{Pack: 250, Quantity: 1}}, 2.5},
+    }
+
+    for _, test := range tests {
+        result, err := CalculateByWeight(packs, test.weight)
+        if err != nil {
+            t.Fatalf("CalculateByWeight(%g) failed: %v", test.weight, err)
+        }
+
+        if !reflect.DeepEqual(result.Packs, test.expected) || math.Abs(result.TotalWeight-test.total) > 1e-9 {
+            t.Errorf("CalculateByWeight(%g): expected %v weighing %g, got %v weighing %g", test.weight, test.expected, test.total, result.Packs, result.TotalWeight)
+        }
+
+        if result.TotalWeight < test.weight {
+            t.Errorf("CalculateByWeight(%g): total weight %g falls short of the target", test.weight, result.TotalWeight)
+        }
+    }
+
+    if _, err := CalculateByWeight([]Pack{{Size: 250}}, 10); err != ErrNoWeights {
+        t.Errorf("Expected ErrNoWeights, got %v", err)
+    }
+
+    for _, weight := range []float64{0, -1, maxTargetWeight + 1} {
+        if _, err := CalculateByWeight(packs, weight); err != ErrInvalidTargetWeight {
+            t.Errorf("CalculateByWeight(%g): expected ErrInvalidTargetWeight, got %v", weight, err)
+        }
+    }
+}
+
+func TestCalculateMulti(t *testing.T) {
+    orders := map[string]SKUOrder{
+        "cans":    {Packs: defaultPacks, Items: 501},
+        "bottles": {Packs: []Pack{{Size: 6}, {Size: 24}}, Items: 30},
+    }
+
+    result, err := CalculateMulti(orders, CalculateOptions{})
+    if err != nil {
+        t.Fatalf("CalculateMulti failed: %v", err)
+    }
+
+    expected := map[string][]PackQuantity{
+        "cans":    {{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}},
+        "bottles": {{Pack: 24, Quantity: 1}, {Pack: 6, Quantity: 1}},
+    }
+    for sku, packs := range expected {
+        if !reflect.DeepEqual(result.SKUs[sku].Packs, packs) {
+            t.Errorf("%s: expected %v, got %v", sku, packs, result.SKUs[sku].Packs)
+        }
+    }
+
+    if result.TotalItems != 780 || result.TotalPacks != 4 {
+        t.Errorf("Expected 780 items in 4 packs, got %d in %d", result.TotalItems, result.TotalPacks)
+    }
+
+    orders["empty"] = SKUOrder{Items: 10}
+    if _, err := CalculateMulti(orders, CalculateOptions{}); !errors.Is(err, ErrNoPacks) || !strings.Contains(err.Error(), "empty") {
+        t.Errorf("Expected ErrNoPacks naming the SKU, got %v", err)
+    }
+}
+
+func TestUtilization(t *testing.T) {
+    tests := []struct {
+        requested, shipped int
+        expected           float64
+    }{
+        {500, 500, 1},  // Exact fill
+        {501, 750, 0.668},
+        {1, 250, 0.004},
+        {12001, 12250, 12001.0 / 12250},
+        {1000, 750, 1}, // Partial fill ships less than ordered
+        {0, 0, 0},      // Empty order
+    }
+
+    for _, test := range tests {
+        if got := utilization(test.requested, test.shipped); !approxEqual(got, test.expected) {
+            t.Errorf("utilization(%d, %d): expected %v, got %v", test.requested, test.shipped, test.expected, got)
+        }
+    }
+}
+
+func TestCoalescePacks(t *testing.T) {
+    lines := []PackQuantity{
+        {Pack: 250, Quantity: 1},
+        {Pack: 1000, Quantity: 2},
+        {Pack: 500, Quantity: 0},
+        {Pack: 250, Quantity: 2},
+        {Pack: 1000, Quantity: 1, Depot: "north"},
+        {Pack: 1000, Quantity: 1, Depot: "east"},
+    }
+
+    expected := []PackQuantity{
+        {Pack: 1000, Quantity: 2},
+        {Pack: 1000, Quantity: 1, Depot: "east"},
+        {Pack: 1000, Quantity: 1, Depot: "north"},
+        {Pack: 250, Quantity: 3},
+    }
+
+    if got := coalescePacks(lines); !reflect.DeepEqual(got, expected) {
+        t.Errorf("Expected %+v, got %+v", expected, got)
+    }
+
+    if got := coalescePacks(nil); got == nil || len(got) != 0 {
+        t.Errorf("Expected an empty breakdown to stay an empty slice, got %#v", got)
+    }
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "math"
+    "strconv"
+)
+
+// Cost is an amount of money. It is rounded to whole cents when encoded, so float
+// noise such as 12.300000001 never reaches clients.
+type Cost float64
+
+// MarshalJSON encodes the cost rounded to two decimals.
+func (c Cost) MarshalJSON() ([]byte, error) {
+    return []byte(strconv.FormatFloat(roundCost(float64(c)), 'f', -1, 64)), nil
+}
+
+// roundCost rounds an amount to two decimals, halves away from zero. Amounts are first
+// rounded to six decimals so binary noise can't hide a half: 1.005, stored as
+// 1.00499999999999989..., rounds to 1.01 as it would on paper.
+func roundCost(amount float64) float64 {
+    cents := math.Round(amount*100*1e6) / 1e6
+    return math.Round(cents) / 100
+}
+
+// totalCost returns the cost of a breakdown given the catalog it was calculated from.
+// Pack sizes without a cost count as free.
+func totalCost(breakdown []PackQuantity, packs []Pack) Cost {
+    costs := make(map[int]float64, len(packs))
+    for _, pack := range packs {
+        costs[pack.Size] = pack.Cost
+    }
+
+    var total float64
+    for _, line := range breakdown {
+        total += float64(line.Quantity) * costs[line.Pack]
+    }
+
+    return Cost(total)
+}
+
+// addSubtotals sets the items, cost and weight of every line of a breakdown given the
+// catalog it was calculated from. Pack sizes without a cost or weight count as zero,
+// leaving those subtotals out of the response.
+func addSubtotals(breakdown []PackQuantity, packs []Pack) {
+    catalog := make(map[int]Pack, len(packs))
+    for _, pack := range packs {
+        catalog[pack.Size] = pack
+    }
+
+    for i, line := range breakdown {
+        pack := catalog[line.Pack]
+        breakdown[i].Items = line.Quantity * line.Pack
+        breakdown[i].Cost = Cost(float64(line.Quantity) * pack.Cost)
+        breakdown[i].Weight = float64(line.Quantity) * pack.Weight
+    }
+}
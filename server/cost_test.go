@@ -0,0 +1,73 @@
+package main
+
+import (
+    "encoding/json"
+    "testing"
+)
+
+func TestRoundCost(t *testing.T) {
+    tests := []struct {
+        amount   float64
+        expected float64
+    }{
+        {12.300000001, 12.3},
+        {12.299999999, 12.3},
+        {1.005, 1.01},  // Stored just below the half, still rounds up
+        {1.015, 1.02},
+        {2.675, 2.68},
+        {1.0049, 1},
+        {0.125, 0.13},
+        {-1.005, -1.01}, // Halves round away from zero
+        {0, 0},
+        {1e6 + 0.005, 1000000.01},
+    }
+
+    for _, test := range tests {
+        if got := roundCost(test.amount); got != test.expected {
+            t.Errorf("roundCost(%v): expected %v, got %v", test.amount, test.expected, got)
+        }
+    }
+}
+
+func TestCostJSON(t *testing.T) {
+    encoded, err := json.Marshal(Result{Packs: []PackQuantity{}, TotalCost: Cost(0.1 + 0.2)})
+    if err != nil {
+        t.Fatalf("Marshal failed: %v", err)
+    }
+
+    if expected := `{"packs":[],"totalItems":0,"totalPacks":0,"totalCost":0.3}`; string(encoded) != expected {
+        t.Errorf("Expected %s, got %s", expected, encoded)
+    }
+
+    if cost := totalCost([]PackQuantity{{Pack: 500, Quantity: 3}, {Pack: 250, Quantity: 1}}, []Pack{{Size: 250, Cost: 1.1}, {Size: 500, Cost: 2.2}}); roundCost(float64(cost)) != 7.7 {
+        t.Errorf("Expected a total cost of 7.70, got %v", cost)
+    }
+}
+
+func TestAddSubtotals(t *testing.T) {
+    packs := []Pack{{Size: 250, Cost: 1.1, Weight: 0.3}, {Size: 500, Cost: 2.2, Weight: 0.5}, {Size: 1000}}
+    breakdown := []PackQuantity{{Pack: 1000, Quantity: 2}, {Pack: 500, Quantity: 3}, {Pack: 250, Quantity: 1}}
+
+    addSubtotals(breakdown, packs)
+
+    expected := []struct {
+        items  int
+        cost   float64
+        weight float64
+    }{
+        {2000, 0, 0}, // No cost or weight in the catalog
+        {1500, 6.6, 1.5},
+        {250, 1.1, 0.3},
+    }
+
+    for i, line := range breakdown {
+        if line.Items != expected[i].items || roundCost(float64(line.Cost)) != expected[i].cost || !approxEqual(line.Weight, expected[i].weight) {
+            t.Errorf("Line %d: expected %+v, got %+v", i, expected[i], line)
+        }
+    }
+
+    encoded, _ := json.Marshal(breakdown[0])
+    if expected := `{"pack":1000,"quantity":2,"items":2000}`; string(encoded) != expected {
+        t.Errorf("Expected zero subtotals to be omitted as %s, got %s", expected, encoded)
+    }
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+    "crypto/subtle"
+    "net/http"
+    "net/url"
+    "os"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// maskedSecret replaces the value of a secret that is set in diagnostics output.
+const maskedSecret = "********"
+
+// DebugConfig is the effective configuration reported by GET /debug/config. Secrets
+// are masked, showing only whether they are set.
+type DebugConfig struct {
+    ListenAddr                string   `json:"listenAddr"`                // Address the server listens on
+    MongoURL                  string   `json:"mongoUrl"`                  // MongoDB connection URI with its password masked
+    Database                  string   `json:"database"`                  // MongoDB database holding the packs
+    Collections               []string `json:"collections"`               // MongoDB collections in use
+    DefaultStrategy           string   `json:"defaultStrategy"`           // Strategy used when a request names none
+    DefaultAlgorithm          string   `json:"defaultAlgorithm"`          // Algorithm used when a request names none
+    IDScheme                  string   `json:"idScheme"`                  // Format of new pack IDs
+    MaxItems                  int      `json:"maxItems"`                  // Largest order accepted
+    MaxBodyBytes              int64    `json:"maxBodyBytes"`              // Largest request body accepted
+    MaxConcurrentCalculations int      `json:"maxConcurrentCalculations"` // Calculations run at once, 0 for unlimited
+    CalculationQueueTimeout   string   `json:"calculationQueueTimeout"`   // How long a calculation waits for a free slot
+    CalculationTimeout        string   `json:"calculationTimeout"`        // How long a calculation runs before a greedy approximation is returned
+    CacheSize                 int      `json:"cacheSize"`                 // Most calculation results cached
+    CacheTTL                  string   `json:"cacheTTL"`                  // How long a calculation result is cached
+    FloatTolerance            float64  `json:"floatTolerance"`            // Relative tolerance of weight comparisons
+    TrustedProxies            []string `json:"trustedProxies"`            // Proxies whose X-Forwarded-For is believed
+    UnitLabel                 string   `json:"unitLabel"`                 // Label of the items being packed
+    ReadOnly                  bool     `json:"readOnly"`                  // Whether writes are disabled for maintenance
+    PacksFile                 string   `json:"packsFile"`                 // Catalog file imported at startup
+    TracingEndpoint           string   `json:"tracingEndpoint"`           // OTLP endpoint spans are exported to
+    APIKey                    string   `json:"apiKey"`                    // Masked API key, empty when unset
+}
+
+// requireAPIKey lets through only requests carrying the API_KEY in their X-API-Key
+// header. Without an API_KEY the routes it guards are disabled.
+func requireAPIKey(ctx *gin.Context) {
+    key := os.Getenv("API_KEY")
+    if key == "" {
+        ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Set API_KEY to enable this endpoint"})
+        return  // Return forbidden status while no API key is configured
+    }
+
+    if subtle.ConstantTimeCompare([]byte(ctx.GetHeader("X-API-Key")), []byte(key)) != 1 {
+        ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid X-API-Key header"})
+        return  // Return unauthorized status for a missing or wrong key
+    }
+
+    ctx.Next()
+}
+
+// DebugCalculation is a calculation replayed by POST /debug/calculate, with the steps
+// Calculate took and how long it ran.
+type DebugCalculation struct {
+    Request  CalculateRequest `json:"request"`          // The calculation as replayed
+    Packs    []Pack           `json:"packs"`            // Packs the order was calculated with
+    Result   *Result          `json:"result,omitempty"` // Breakdown when the calculation succeeded
+    Error    string           `json:"error,omitempty"`  // Reason the calculation failed
+    Status   int              `json:"status"`           // Status POST /calculate would respond with
+    Duration string           `json:"duration"`         // Time the calculation took
+    Trace    []TraceStep      `json:"trace"`            // Steps Calculate took, timed from its start
+}
+
+// debugCalculate handles POST requests to replay a calculate request with tracing. It
+// calls Calculate directly, bypassing the cache and time budget, so the trace and timing
+// reflect a full calculation. Failures of the calculation itself are reported in the body.
+func debugCalculate(ctx *gin.Context) {
+    req, packs, ok := bindCalculate(ctx)
+    if !ok {
+        return
+    }
+
+    opts := req.Options()
+    opts.Trace = newCalculationTrace()
+
+    start := time.Now()
+    result, err := Calculate(packs, req.Items, opts)
+    replay := DebugCalculation{Request: req, Packs: packs, Status: http.StatusOK, Duration: time.Since(start).String(), Trace: opts.Trace.Steps}
+
+    if err != nil {
+        replay.Status = calculateStatus(err)
+        replay.Error = err.Error()
+    } else {
+        replay.Result = &result
+    }
+
+    ctx.JSON(http.StatusOK, replay)  // Return the replayed calculation with OK status
+}
+
+// debugConfig handles GET requests to report the effective configuration of the server.
+func debugConfig(ctx *gin.Context) {
+    ctx.JSON(http.StatusOK, effectiveConfig())  // Return the configuration with OK status
+}
+
+// effectiveConfig resolves the configuration the server is running with, masking secrets.
+func effectiveConfig() DebugConfig {
+    stats := calculationCache.Stats()
+
+    config := DebugConfig{
+        ListenAddr:       listenAddr,
+        MongoURL:         redactURL(mongoURI()),
+        Database:         databaseName,
+        Collections:      []string{packsCollection, auditCollection},
+        DefaultStrategy:  defaultStrategy,
+        DefaultAlgorithm: defaultAlgorithm,
+        IDScheme:         idScheme,
+        MaxItems:         maxItems(),
+        MaxBodyBytes:     maxBodyBytes(),
+        CacheSize:        stats.Size,
+        CacheTTL:         stats.TTL,
+        FloatTolerance:   floatTolerance,
+        TrustedProxies:   trustedProxies,
+        UnitLabel:        unitLabel(),
+        ReadOnly:         readOnly.Load(),
+        PacksFile:        os.Getenv("PACKS_FILE"),
+        TracingEndpoint:  redactURL(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
+        APIKey:           maskSecret(os.Getenv("API_KEY")),
+    }
+
+    config.CalculationTimeout = calculationTimeout().String()
+
+    if calculationLimiter != nil {
+        config.MaxConcurrentCalculations = cap(calculationLimiter.slots)
+        config.CalculationQueueTimeout = calculationLimiter.wait.String()
+    }
+
+    return config
+}
+
+// maskSecret returns maskedSecret for a secret that is set and an empty string otherwise.
+func maskSecret(secret string) string {
+    if secret == "" {
+        return ""
+    }
+
+    return maskedSecret
+}
+
+// redactURL masks the password of a URL as xxxxx. URLs that don't parse are masked
+// entirely, since they might hold credentials in a form the parser doesn't recognize.
+func redactURL(raw string) string {
+    if raw == "" {
+        return ""
+    }
+
+    parsed, err := url.Parse(raw)
+    if err != nil {
+        return maskedSecret
+    }
+
+    return parsed.Redacted()
+}
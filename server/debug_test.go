@@ -0,0 +1,151 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestDebugConfig(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    request := func(key string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+        if key != "" {
+            req.Header.Set("X-API-Key", key)
+        }
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+        return rec
+    }
+
+    t.Setenv("API_KEY", "")
+    if rec := request("anything"); rec.Code != http.StatusForbidden {
+        t.Errorf("Expected status 403 without an API_KEY configured, got %d", rec.Code)
+    }
+
+    t.Setenv("API_KEY", "k3y-topsecret")
+    t.Setenv("MONGO_URL", "mongodb://root:p4ss-topsecret@db:27017/?authSource=admin")
+    t.Setenv("UNIT_LABEL", "cans")
+
+    for _, key := range []string{"", "wrong"} {
+        if rec := request(key); rec.Code != http.StatusUnauthorized {
+            t.Errorf("Expected status 401 for key %q, got %d", key, rec.Code)
+        }
+    }
+
+    rec := request("k3y-topsecret")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200 with the API key, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    body := rec.Body.String()
+    if strings.Contains(body, "topsecret") {
+        t.Errorf("Expected secrets to be masked, got %s", body)
+    }
+
+    var config map[string]interface{}
+    json.Unmarshal(rec.Body.Bytes(), &config)
+
+    for _, key := range []string{"listenAddr", "database", "collections", "defaultStrategy", "defaultAlgorithm", "maxItems", "maxBodyBytes", "cacheSize", "cacheTTL", "readOnly"} {
+        if _, ok := config[key]; !ok {
+            t.Errorf("Expected the configuration to include %s, got %s", key, body)
+        }
+    }
+
+    if config["mongoUrl"] != "mongodb://root:xxxxx@db:27017/?authSource=admin" || config["apiKey"] != maskedSecret || config["unitLabel"] != "cans" {
+        t.Errorf("Unexpected configuration values: %s", body)
+    }
+}
+
+func TestRedactURL(t *testing.T) {
+    tests := []struct {
+        raw      string
+        expected string
+    }{
+        {"mongodb://root:secret@db:27017/", "mongodb://root:xxxxx@db:27017/"},
+        {"mongodb://db:27017/", "mongodb://db:27017/"},
+        {"mongodb://reader@db:27017/", "mongodb://reader@db:27017/"}, // No password to mask
+        {"http://collector:4318", "http://collector:4318"},
+        {"mongodb://root:secret@db:port/", maskedSecret},             // Unparseable URLs are masked whole
+        {"", ""},
+    }
+
+    for _, test := range tests {
+        if got := redactURL(test.raw); got != test.expected {
+            t.Errorf("redactURL(%q): expected %q, got %q", test.raw, test.expected, got)
+        }
+    }
+}
+
+func TestDebugCalculate(t *testing.T) {
+    t.Setenv("API_KEY", "k3y")
+
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    if rec := performKeyedRequest(router, http.MethodPost, "/debug/calculate", `{"items": 501}`, "wrong"); rec.Code != http.StatusUnauthorized {
+        t.Errorf("Expected status 401 without the API key, got %d", rec.Code)
+    }
+
+    var replay DebugCalculation
+    rec := performKeyedRequest(router, http.MethodPost, "/debug/calculate", `{"items": 501}`, "k3y")
+    json.Unmarshal(rec.Body.Bytes(), &replay)
+
+    if rec.Code != http.StatusOK || replay.Status != http.StatusOK || replay.Result == nil || replay.Result.TotalItems != 750 {
+        t.Fatalf("Expected a replayed breakdown of 750, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    if duration, err := time.ParseDuration(replay.Duration); err != nil || duration <= 0 {
+        t.Errorf("Expected the calculation to be timed, got %q", replay.Duration)
+    }
+
+    // The trace walks from the options through the tables to the chosen total
+    var steps []string
+    for _, step := range replay.Trace {
+        if _, err := time.ParseDuration(step.Elapsed); err != nil {
+            t.Errorf("Expected every step to be timed, got %+v", step)
+        }
+        steps = append(steps, step.Step)
+    }
+    trace := strings.Join(steps, "\n")
+    for _, expected := range []string{"calculating 501 items in overship mode", "pack sizes [1000 500 250]", "built the dp tables", "picked 750 items"} {
+        if !strings.Contains(trace, expected) {
+            t.Errorf("Expected the trace to include %q, got\n%s", expected, trace)
+        }
+    }
+
+    // A failing calculation is reported with the status /calculate would give it
+    rec = performKeyedRequest(router, http.MethodPost, "/debug/calculate", `{"items": 501, "mode": "exact"}`, "k3y")
+    replay = DebugCalculation{}
+    json.Unmarshal(rec.Body.Bytes(), &replay)
+
+    if rec.Code != http.StatusOK || replay.Status != http.StatusUnprocessableEntity || replay.Error == "" || len(replay.Trace) == 0 {
+        t.Errorf("Expected a traced 422 failure, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    // Replays run in read-only mode but are held to the concurrency limit
+    readOnly.Store(true)
+    defer readOnly.Store(false)
+
+    if rec := performKeyedRequest(router, http.MethodPost, "/debug/calculate", `{"items": 501}`, "k3y"); rec.Code != http.StatusOK {
+        t.Errorf("Expected status 200 in read-only mode, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    previousLimiter := calculationLimiter
+    defer func() { calculationLimiter = previousLimiter }()
+    calculationLimiter = NewCalculationLimiter(1, 0)
+    calculationLimiter.acquire(nil)
+
+    if rec := performKeyedRequest(router, http.MethodPost, "/debug/calculate", `{"items": 501}`, "k3y"); rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status 503 while saturated, got %d", rec.Code)
+    }
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+    "slices"
+    "sort"
+)
+
+// PackChange is a pack size present in both catalogs whose tags differ.
+type PackChange struct {
+    Size   int      `json:"size"`   // Size of the pack
+    Before []string `json:"before"` // Tags in the current catalog
+    After  []string `json:"after"`  // Tags in the proposed catalog
+}
+
+// CatalogDiff lists how a proposed catalog differs from the current one, each list
+// largest size first.
+type CatalogDiff struct {
+    Added   []int        `json:"added"`   // Sizes only in the proposed catalog
+    Removed []int        `json:"removed"` // Sizes only in the current catalog
+    Changed []PackChange `json:"changed"` // Sizes in both catalogs with different tags
+}
+
+// DiffCatalogs compares a proposed catalog with the current one by pack size. Tags are
+// compared as sets, so their order doesn't count as a change. A size listed twice in the
+// proposed catalog keeps the tags of its first entry.
+func DiffCatalogs(current, proposed []Pack) (CatalogDiff, error) {
+    diff := CatalogDiff{Added: []int{}, Removed: []int{}, Changed: []PackChange{}}
+
+    var sizes []int
+    if len(proposed) > 0 {
+        var err error
+        if sizes, err = packSizes(proposed); err != nil {
+            return CatalogDiff{}, err
+        }
+    }
+
+    proposedTags := make(map[int][]string, len(proposed))
+    for _, pack := range proposed {
+        if _, ok := proposedTags[pack.Size]; !ok {
+            proposedTags[pack.Size] = pack.Tags
+        }
+    }
+
+    currentTags := make(map[int][]string, len(current))
+    for _, pack := range current {
+        currentTags[pack.Size] = pack.Tags
+
+        if _, ok := proposedTags[pack.Size]; !ok {
+            diff.Removed = append(diff.Removed, pack.Size)
+        }
+    }
+
+    for _, size := range sizes {
+        before, ok := currentTags[size]
+        if !ok {
+            diff.Added = append(diff.Added, size)
+            continue
+        }
+
+        if after := proposedTags[size]; !sameTags(before, after) {
+            diff.Changed = append(diff.Changed, PackChange{Size: size, Before: nonNil(before), After: nonNil(after)})
+        }
+    }
+
+    sort.Sort(sort.Reverse(sort.IntSlice(diff.Removed)))
+
+    return diff, nil
+}
+
+// ReplaceSummary lists the changes applied when the catalog is replaced, each list
+// largest size first.
+type ReplaceSummary struct {
+    Added   []int `json:"added"`   // Sizes created, including those recreated under another ID
+    Removed []int `json:"removed"` // Sizes deleted, including those recreated under another ID
+    Updated []int `json:"updated"` // Sizes kept whose tags, weight, cost, priority or stock changed
+}
+
+// planReplace works out how to turn the current catalog into the proposed one, using
+// DiffCatalogs for the sizes to add and remove. Sizes in both catalogs are updated when
+// any of their details differ. It also returns the proposed pack of each size, the
+// first entry winning for a size listed twice.
+//
+// Packs carrying an ID, as restored backups do, are matched by ID as well: a current
+// pack keeps its size only while no proposed pack claims its ID for another size and
+// its own size isn't proposed under another ID. Otherwise the size is removed and added
+// again, so a backup taken before a pack was resized restores without two packs
+// sharing an ID.
+func planReplace(current, proposed []Pack) (ReplaceSummary, map[int]Pack, error) {
+    diff, err := DiffCatalogs(current, proposed)
+    if err != nil {
+        return ReplaceSummary{}, nil, err
+    }
+
+    bySize := make(map[int]Pack, len(proposed))
+    for _, pack := range proposed {
+        if _, ok := bySize[pack.Size]; !ok {
+            bySize[pack.Size] = pack
+        }
+    }
+
+    claimed := make(map[string]bool, len(proposed))
+    for _, pack := range bySize {
+        if pack.ID != "" {
+            claimed[pack.ID] = true
+        }
+    }
+
+    summary := ReplaceSummary{Added: diff.Added, Removed: diff.Removed, Updated: []int{}}
+    for _, pack := range current {
+        after, ok := bySize[pack.Size]
+        if !ok {
+            continue
+        }
+
+        switch {
+        case after.ID != "" && after.ID != pack.ID, after.ID == "" && claimed[pack.ID]:
+            summary.Removed = append(summary.Removed, pack.Size)
+            summary.Added = append(summary.Added, pack.Size)
+        case !samePackDetails(pack, after):
+            summary.Updated = append(summary.Updated, pack.Size)
+        }
+    }
+
+    sort.Sort(sort.Reverse(sort.IntSlice(summary.Added)))
+    sort.Sort(sort.Reverse(sort.IntSlice(summary.Removed)))
+    sort.Sort(sort.Reverse(sort.IntSlice(summary.Updated)))
+
+    return summary, bySize, nil
+}
+
+// samePackDetails reports whether two packs carry the same tags, weight, cost, priority and stock.
+func samePackDetails(a, b Pack) bool {
+    return sameTags(a.Tags, b.Tags) && a.Weight == b.Weight && a.Cost == b.Cost && a.Priority == b.Priority && a.Stock == b.Stock
+}
+
+// sameTags reports whether two tag lists hold the same set of tags.
+func sameTags(a, b []string) bool {
+    a, b = slices.Clone(a), slices.Clone(b)
+    slices.Sort(a)
+    slices.Sort(b)
+
+    return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// nonNil returns tags, or an empty list when there are none, so they encode as [].
+func nonNil(tags []string) []string {
+    if tags == nil {
+        return []string{}
+    }
+
+    return tags
+}
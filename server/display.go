@@ -0,0 +1,21 @@
+package main
+
+// DisplayTotals are the totals of a result converted to a larger display unit, such as
+// cartons, for orders placed in those units but packed in items.
+type DisplayTotals struct {
+    Per        int     `json:"per"`        // Items in one display unit
+    Ordered    float64 `json:"ordered"`    // Items ordered, in display units
+    TotalItems float64 `json:"totalItems"` // Items shipped, in display units
+    Remainder  int     `json:"remainder"`  // Items shipped beyond the last whole display unit
+}
+
+// displayTotals converts the items ordered and shipped into display units of per items.
+// Fractions are rounded to two decimals as costs are, halves away from zero.
+func displayTotals(ordered, shipped, per int) *DisplayTotals {
+    return &DisplayTotals{
+        Per:        per,
+        Ordered:    roundCost(float64(ordered) / float64(per)),
+        TotalItems: roundCost(float64(shipped) / float64(per)),
+        Remainder:  shipped % per,
+    }
+}
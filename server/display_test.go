@@ -0,0 +1,54 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestDisplayTotals(t *testing.T) {
+    tests := []struct {
+        ordered, shipped, per int
+        expected              DisplayTotals
+    }{
+        {240, 240, 24, DisplayTotals{Per: 24, Ordered: 10, TotalItems: 10, Remainder: 0}},
+        {241, 250, 24, DisplayTotals{Per: 24, Ordered: 10.04, TotalItems: 10.42, Remainder: 10}},
+        {1, 250, 1000, DisplayTotals{Per: 1000, Ordered: 0, TotalItems: 0.25, Remainder: 250}},
+        {5, 5, 8, DisplayTotals{Per: 8, Ordered: 0.63, TotalItems: 0.63, Remainder: 5}}, // 0.625 rounds half up
+        {0, 0, 12, DisplayTotals{Per: 12}},
+    }
+
+    for _, test := range tests {
+        if got := displayTotals(test.ordered, test.shipped, test.per); !reflect.DeepEqual(*got, test.expected) {
+            t.Errorf("%d of %d per unit: expected %+v, got %+v", test.shipped, test.per, test.expected, *got)
+        }
+    }
+}
+
+func TestCalculateDisplayUnit(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, body := range []string{`{"size": 240}`, `{"size": 480}`} {
+        performRequest(router, http.MethodPost, "/packs", body)
+    }
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 700, "displayUnit": 24}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    expected := &DisplayTotals{Per: 24, Ordered: 29.17, TotalItems: 30, Remainder: 0}
+    if rec.Code != http.StatusOK || result.TotalItems != 720 || !reflect.DeepEqual(result.Display, expected) {
+        t.Errorf("Expected 720 items as %+v, got %d %s", expected, rec.Code, rec.Body.String())
+    }
+
+    if body := performRequest(router, http.MethodPost, "/calculate", `{"items": 700}`).Body.String(); strings.Contains(body, `"display"`) {
+        t.Errorf("Expected no display totals without a display unit, got %s", body)
+    }
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 700, "displayUnit": -1}`); rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for a negative display unit, got %d", rec.Code)
+    }
+}
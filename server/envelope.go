@@ -0,0 +1,83 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// envelopeResponses wraps every JSON response in an Envelope. It is set from
+// RESPONSE_ENVELOPE at startup.
+var envelopeResponses bool
+
+// Envelope is the consistent shape of JSON responses when RESPONSE_ENVELOPE=true:
+// successful responses carry their body in Data, failed ones their message in Error.
+type Envelope struct {
+    Data  json.RawMessage `json:"data"`  // Response body, null for failures
+    Error json.RawMessage `json:"error"` // Error message, null for successes
+}
+
+// envelopeWriter holds back JSON bodies so wrapEnvelope can wrap them once the handler
+// is done. Other bodies, such as pick sheets and streamed JSON Lines, pass straight through.
+type envelopeWriter struct {
+    gin.ResponseWriter
+    body bytes.Buffer
+}
+
+func (w *envelopeWriter) Write(data []byte) (int, error) {
+    if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+        return w.ResponseWriter.Write(data)
+    }
+
+    return w.body.Write(data)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+    return w.Write([]byte(s))
+}
+
+// wrapEnvelope wraps JSON responses in an Envelope when envelopeResponses is set. It
+// runs ahead of the other middleware so their rejections are wrapped as well.
+func wrapEnvelope(ctx *gin.Context) {
+    if !envelopeResponses {
+        ctx.Next()
+        return
+    }
+
+    writer := &envelopeWriter{ResponseWriter: ctx.Writer}
+    ctx.Writer = writer
+    ctx.Next()
+    ctx.Writer = writer.ResponseWriter
+
+    if writer.body.Len() == 0 {
+        return
+    }
+
+    wrapped, err := json.Marshal(envelope(writer.Status(), writer.body.Bytes()))
+    if err != nil {
+        wrapped = writer.body.Bytes() // Bodies that aren't valid JSON are sent as they are
+    }
+    writer.ResponseWriter.Write(wrapped)
+}
+
+// envelope wraps a JSON body sent with status. Failures keep only the message of an
+// {"error": ...} body, or the whole body when it has none.
+func envelope(status int, body []byte) Envelope {
+    null := json.RawMessage("null")
+
+    if status < http.StatusBadRequest {
+        return Envelope{Data: body, Error: null}
+    }
+
+    var failure struct {
+        Error json.RawMessage `json:"error"`
+    }
+    if err := json.Unmarshal(body, &failure); err == nil && len(failure.Error) > 0 {
+        return Envelope{Data: null, Error: failure.Error}
+    }
+
+    return Envelope{Data: null, Error: body}
+}
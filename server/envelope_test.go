@@ -0,0 +1,55 @@
+package main
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestResponseEnvelope(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    if body := performRequest(router, http.MethodGet, "/calculate?items=1", "").Body.String(); strings.Contains(body, `"data"`) {
+        t.Errorf("Expected responses to be unwrapped by default, got %s", body)
+    }
+
+    envelopeResponses = true
+    defer func() { envelopeResponses = false }()
+
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 1}`)
+    if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), `{"data":{`) || !strings.HasSuffix(rec.Body.String(), `,"error":null}`) {
+        t.Errorf("Expected the result wrapped in data, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    rec = performRequest(router, http.MethodGet, "/packs/not-a-pack", "")
+    if rec.Code < http.StatusBadRequest || !strings.HasPrefix(rec.Body.String(), `{"data":null,"error":"`) {
+        t.Errorf("Expected the error message wrapped in error, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    rec = performRequest(router, http.MethodGet, "/calculate?format=html&items=1", "")
+    if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"data"`) || !strings.Contains(rec.Body.String(), "<html") {
+        t.Errorf("Expected the pick sheet to be left alone, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestEnvelope(t *testing.T) {
+    cases := []struct {
+        status        int
+        body          string
+        data, failure string
+    }{
+        {http.StatusOK, `[1,2]`, `[1,2]`, `null`},
+        {http.StatusBadRequest, `{"error":"bad"}`, `null`, `"bad"`},
+        {http.StatusConflict, `{"message":"taken"}`, `null`, `{"message":"taken"}`},
+    }
+
+    for _, c := range cases {
+        wrapped := envelope(c.status, []byte(c.body))
+        if string(wrapped.Data) != c.data || string(wrapped.Error) != c.failure {
+            t.Errorf("Expected %s wrapped as %s/%s, got %s/%s", c.body, c.data, c.failure, wrapped.Data, wrapped.Error)
+        }
+    }
+}
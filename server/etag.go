@@ -0,0 +1,42 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// catalogCacheControl lets clients and CDNs keep catalog-derived responses but has them
+// revalidate every time, since the catalog can change at any moment.
+const catalogCacheControl = "public, no-cache"
+
+// catalogETag returns a strong ETag hashing every detail of packs, so any change to the
+// catalog, including one only touching timestamps, gives a new tag.
+func catalogETag(packs []Pack) string {
+    encoded, _ := json.Marshal(packs)
+    sum := sha256.Sum256(encoded)
+
+    return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified sets the caching headers of a response derived only from packs and,
+// when the request already holds the current version, answers it with 304 Not Modified.
+func notModified(ctx *gin.Context, packs []Pack) bool {
+    etag := catalogETag(packs)
+    ctx.Header("Cache-Control", catalogCacheControl)
+    ctx.Header("ETag", etag)
+
+    for _, tag := range strings.Split(ctx.GetHeader("If-None-Match"), ",") {
+        tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+        if tag == etag || tag == "*" {
+            ctx.Status(http.StatusNotModified)
+            return true
+        }
+    }
+
+    return false
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "fmt"
+    "time"
+)
+
+// CalculationTrace records the steps Calculate takes, for replaying a calculation
+// while debugging. A nil trace records nothing, so Calculate can trace unconditionally.
+type CalculationTrace struct {
+    Steps []TraceStep // Steps in the order they were taken
+    start time.Time
+}
+
+// TraceStep is one step of a traced calculation.
+type TraceStep struct {
+    Elapsed string `json:"elapsed"` // Time since the trace started when the step was taken
+    Step    string `json:"step"`    // What Calculate did
+}
+
+// newCalculationTrace returns an empty trace timing its steps from now.
+func newCalculationTrace() *CalculationTrace {
+    return &CalculationTrace{Steps: []TraceStep{}, start: time.Now()}
+}
+
+// add records a step described by format and args.
+func (t *CalculationTrace) add(format string, args ...any) {
+    if t == nil {
+        return
+    }
+
+    t.Steps = append(t.Steps, TraceStep{Elapsed: time.Since(t.start).String(), Step: fmt.Sprintf(format, args...)})
+}
+
+// orDefault returns value, or fallback when value is empty.
+func orDefault(value, fallback string) string {
+    if value == "" {
+        return fallback
+    }
+
+    return value
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+// packField is a field of Pack that GET /packs can project.
+type packField struct {
+    index int    // Index of the field in Pack
+    bson  string // Name of the field in MongoDB
+}
+
+// packFields maps the JSON name of every Pack field to the field, so ?fields= is
+// validated against the model itself.
+var packFields = func() map[string]packField {
+    fields := make(map[string]packField)
+
+    model := reflect.TypeOf(Pack{})
+    for i := 0; i < model.NumField(); i++ {
+        name, _, _ := strings.Cut(model.Field(i).Tag.Get("json"), ",")
+        bsonName, _, _ := strings.Cut(model.Field(i).Tag.Get("bson"), ",")
+        fields[name] = packField{index: i, bson: bsonName}
+    }
+
+    return fields
+}()
+
+// fieldsParam reads ?fields=, a comma separated list of pack fields such as size,id,
+// which may also be repeated. It returns nil when no fields are requested.
+func fieldsParam(ctx *gin.Context) ([]string, error) {
+    var fields []string
+    seen := make(map[string]bool)
+
+    for _, value := range ctx.QueryArray("fields") {
+        for _, name := range strings.Split(value, ",") {
+            name = strings.TrimSpace(name)
+            if _, ok := packFields[name]; !ok {
+                return nil, fmt.Errorf("unknown field %q, expected one of %s", name, strings.Join(packFieldNames(), ", "))
+            }
+
+            if !seen[name] {
+                seen[name] = true
+                fields = append(fields, name)
+            }
+        }
+    }
+
+    return fields, nil
+}
+
+// packFieldNames returns the JSON names of the pack fields in alphabetical order.
+func packFieldNames() []string {
+    names := make([]string, 0, len(packFields))
+    for name := range packFields {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    return names
+}
+
+// packProjection returns the MongoDB projection loading only the fields, leaving out _id.
+func packProjection(fields []string) bson.D {
+    projection := bson.D{{Key: "_id", Value: 0}}
+    for _, name := range fields {
+        projection = append(projection, bson.E{Key: packFields[name].bson, Value: 1})
+    }
+
+    return projection
+}
+
+// projectPacks returns the packs with only the fields, keyed by their JSON names. Fields
+// are kept even when empty, so every pack has the same keys.
+func projectPacks(packs []Pack, fields []string) []map[string]any {
+    projected := make([]map[string]any, len(packs))
+    for i, pack := range packs {
+        value := reflect.ValueOf(pack)
+
+        projected[i] = make(map[string]any, len(fields))
+        for _, name := range fields {
+            projected[i][name] = value.Field(packFields[name].index).Interface()
+        }
+    }
+
+    return projected
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "html/template"
+    "io"
+    "strconv"
+)
+
+// pickSheetTemplate renders a calculation as a minimal printable page.
+var pickSheetTemplate = template.Must(template.New("pick-sheet").Funcs(template.FuncMap{
+    "lineItems": func(line PackQuantity) int { return line.Pack * line.Quantity },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Pick sheet: {{.Number .Ordered}} {{.Unit}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #000; padding: 0.3em 0.8em; text-align: right; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Pick sheet</h1>
+<p>Ordered: {{.Number .Ordered}} {{.Unit}}</p>
+<table>
+<thead><tr><th>Pack</th><th>Quantity</th><th>Items</th></tr></thead>
+<tbody>
+{{- range .Result.Packs}}
+<tr><td>{{$.Number .Pack}}</td><td>{{$.Number .Quantity}}</td><td>{{$.Number (lineItems .)}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot><tr><th>Total</th><th>{{.Number .Result.TotalPacks}}</th><th>{{.Number .Result.TotalItems}}</th></tr></tfoot>
+</table>
+</body>
+</html>
+`))
+
+// pickSheet is the data rendered by pickSheetTemplate.
+type pickSheet struct {
+    Ordered int    // Number of items ordered
+    Unit    string // Label of the items, e.g. cans
+    Result  Result // Breakdown of the order
+    Human   bool   // Whether numbers are printed with thousands separators
+}
+
+// Number formats n for the sheet, with thousands separators when it is human readable.
+func (s pickSheet) Number(n int) string {
+    if s.Human {
+        return formatThousands(n)
+    }
+
+    return strconv.Itoa(n)
+}
+
+// renderPickSheet writes the breakdown of an order of items as a printable HTML table
+// with totals. When human is set, large numbers are grouped with thousands separators.
+func renderPickSheet(w io.Writer, items int, result Result, human bool) error {
+    unit := result.Unit
+    if unit == "" {
+        unit = "items"
+    }
+
+    return pickSheetTemplate.Execute(w, pickSheet{Ordered: items, Unit: unit, Result: result, Human: human})
+}
+
+// formatThousands formats n with a comma between every group of three digits, e.g. 12,001.
+func formatThousands(n int) string {
+    digits := strconv.Itoa(n)
+
+    sign := ""
+    if n < 0 {
+        sign, digits = "-", digits[1:]
+    }
+
+    grouped := make([]byte, 0, len(digits)+len(digits)/3)
+    for i := range digits {
+        if i > 0 && (len(digits)-i)%3 == 0 {
+            grouped = append(grouped, ',')
+        }
+        grouped = append(grouped, digits[i])
+    }
+
+    return sign + string(grouped)
+}
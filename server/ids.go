@@ -0,0 +1,119 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strconv"
+    "sync/atomic"
+
+    "github.com/google/uuid"
+)
+
+// ErrInvalidIDScheme is returned for an unknown pack ID scheme.
+var ErrInvalidIDScheme = errors.New("ID scheme must be one of uuid or numeric")
+
+// Pack ID schemes decide what the IDs of new packs look like.
+const (
+    IDSchemeUUID    = "uuid"    // Random UUIDs (default)
+    IDSchemeNumeric = "numeric" // Positive integers counting up from the largest ID in use
+)
+
+// IDScheme generates the IDs of new packs and recognises well-formed ones, so the
+// :id routes don't depend on the format a deployment uses.
+type IDScheme interface {
+    // Generator returns a generator of new IDs. existing lists the IDs already in use,
+    // and is only called by schemes that need to continue after them. observe must be
+    // called with IDs stored without the generator, such as restored ones, so it never
+    // hands them out again.
+    Generator(existing func() ([]string, error)) (next func() string, observe func(id string), err error)
+    // Validate returns an error saying why id is not well formed.
+    Validate(id string) error
+}
+
+// idSchemes maps the IDScheme constants to their implementations.
+var idSchemes = map[string]IDScheme{
+    IDSchemeUUID:    uuidScheme{},
+    IDSchemeNumeric: numericScheme{},
+}
+
+// idScheme is the scheme of new pack IDs, set from ID_SCHEME.
+var idScheme = IDSchemeUUID
+
+// loadIDScheme reads ID_SCHEME, falling back to uuid when unset.
+func loadIDScheme() (string, error) {
+    scheme := os.Getenv("ID_SCHEME")
+    if scheme == "" {
+        return IDSchemeUUID, nil
+    }
+
+    if _, ok := idSchemes[scheme]; !ok {
+        return "", fmt.Errorf("invalid ID_SCHEME %q: %w", scheme, ErrInvalidIDScheme)
+    }
+
+    return scheme, nil
+}
+
+// idSchemeFor returns the implementation of scheme, uuid when it is unknown.
+func idSchemeFor(scheme string) IDScheme {
+    if impl, ok := idSchemes[scheme]; ok {
+        return impl
+    }
+
+    return uuidScheme{}
+}
+
+// uuidScheme gives every pack a random UUID.
+type uuidScheme struct{}
+
+func (uuidScheme) Generator(func() ([]string, error)) (func() string, func(string), error) {
+    return uuid.NewString, func(string) {}, nil // Random IDs don't collide with stored ones
+}
+
+func (uuidScheme) Validate(id string) error {
+    if uuid.Validate(id) != nil {
+        return errors.New("is not a valid UUID")
+    }
+
+    return nil
+}
+
+// numericScheme numbers packs 1, 2, 3 and so on. The count starts after the largest
+// numeric ID in use when the generator is made and moves past any observed later, so
+// it must be the only one creating packs: IDs generated by another server aren't seen.
+type numericScheme struct{}
+
+func (numericScheme) Generator(existing func() ([]string, error)) (func() string, func(string), error) {
+    ids, err := existing()
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var last atomic.Uint64
+    observe := func(id string) {
+        n, err := strconv.ParseUint(id, 10, 64)
+        if err != nil {
+            return // IDs of another scheme are left alone
+        }
+
+        for current := last.Load(); n > current && !last.CompareAndSwap(current, n); current = last.Load() {
+        }
+    }
+
+    for _, id := range ids {
+        observe(id)
+    }
+
+    return func() string {
+        return strconv.FormatUint(last.Add(1), 10)
+    }, observe, nil
+}
+
+// Validate accepts only the IDs the generator makes, so "007" or "+7" can't name pack 7.
+func (numericScheme) Validate(id string) error {
+    if n, err := strconv.ParseUint(id, 10, 64); err != nil || n == 0 || strconv.FormatUint(n, 10) != id {
+        return errors.New("is not a positive integer")
+    }
+
+    return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+)
+
+func TestIDSchemesRoundTrip(t *testing.T) {
+    tests := []struct {
+        scheme  string
+        invalid string
+    }{
+        {IDSchemeUUID, "7"},
+        {IDSchemeNumeric, "6f1c2a43-0d7e-4b8a-9d55-1c2b3a4d5e6f"},
+    }
+
+    previous := idScheme
+    defer func() { idScheme = previous }()
+
+    for _, test := range tests {
+        idScheme = test.scheme
+        router, cleanup := newTestServer(t)
+
+        for _, size := range []int{250, 500} {
+            var created Pack
+            rec := performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size))
+            json.Unmarshal(rec.Body.Bytes(), &created)
+
+            if err := idSchemeFor(test.scheme).Validate(created.ID); rec.Code != http.StatusOK || err != nil {
+                t.Errorf("%s: expected a %s ID, got %d %s", test.scheme, test.scheme, rec.Code, rec.Body.String())
+                continue
+            }
+
+            var fetched Pack
+            rec = performRequest(router, http.MethodGet, "/packs/"+created.ID, "")
+            json.Unmarshal(rec.Body.Bytes(), &fetched)
+
+            if rec.Code != http.StatusOK || fetched.ID != created.ID || fetched.Size != size {
+                t.Errorf("%s: expected pack %s of %d, got %d %s", test.scheme, created.ID, size, rec.Code, rec.Body.String())
+            }
+        }
+
+        if rec := performRequest(router, http.MethodGet, "/packs/"+test.invalid, ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400 for %s, got %d", test.scheme, test.invalid, rec.Code)
+        }
+
+        cleanup()
+    }
+}
+
+func TestNumericIDGenerator(t *testing.T) {
+    newID, observe, err := numericScheme{}.Generator(func() ([]string, error) {
+        return []string{"3", "6f1c2a43-0d7e-4b8a-9d55-1c2b3a4d5e6f", "12", "9"}, nil
+    })
+    if err != nil {
+        t.Fatalf("Generator failed: %v", err)
+    }
+
+    if first, second := newID(), newID(); first != "13" || second != "14" {
+        t.Errorf("Expected IDs to continue after 12, got %s and %s", first, second)
+    }
+
+    // IDs stored later move the count past them, smaller ones leave it be
+    for _, id := range []string{"40", "21", "6f1c2a43-0d7e-4b8a-9d55-1c2b3a4d5e6f"} {
+        observe(id)
+    }
+    if next := newID(); next != "41" {
+        t.Errorf("Expected IDs to continue after the observed 40, got %s", next)
+    }
+
+    failure := errors.New("database down")
+    if _, _, err := (numericScheme{}).Generator(func() ([]string, error) { return nil, failure }); !errors.Is(err, failure) {
+        t.Errorf("Expected the error loading IDs, got %v", err)
+    }
+}
+
+func TestIDSchemeValidate(t *testing.T) {
+    tests := []struct {
+        scheme string
+        id     string
+        valid  bool
+    }{
+        {IDSchemeUUID, "6f1c2a43-0d7e-4b8a-9d55-1c2b3a4d5e6f", true},
+        {IDSchemeUUID, "42", false},
+        {IDSchemeNumeric, "42", true},
+        {IDSchemeNumeric, "0", false},
+        {IDSchemeNumeric, "007", false},
+        {IDSchemeNumeric, "+7", false},
+        {IDSchemeNumeric, "-7", false},
+        {IDSchemeNumeric, "99999999999999999999999", false},
+    }
+
+    for _, test := range tests {
+        if err := idSchemeFor(test.scheme).Validate(test.id); (err == nil) != test.valid {
+            t.Errorf("%s %q: expected valid %t, got %v", test.scheme, test.id, test.valid, err)
+        }
+    }
+}
+
+func TestLoadIDScheme(t *testing.T) {
+    for value, expected := range map[string]string{"": IDSchemeUUID, "uuid": IDSchemeUUID, "numeric": IDSchemeNumeric} {
+        t.Setenv("ID_SCHEME", value)
+        if scheme, err := loadIDScheme(); err != nil || scheme != expected {
+            t.Errorf("%q: expected %s, got %s %v", value, expected, scheme, err)
+        }
+    }
+
+    t.Setenv("ID_SCHEME", "serial")
+    if _, err := loadIDScheme(); !errors.Is(err, ErrInvalidIDScheme) {
+        t.Errorf("Expected ErrInvalidIDScheme, got %v", err)
+    }
+}
+
+func TestRestoreThenCreateNumeric(t *testing.T) {
+    t.Setenv("API_KEY", "k3y")
+
+    previous := idScheme
+    defer func() { idScheme = previous }()
+    idScheme = IDSchemeNumeric
+
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    // Restored IDs are ahead of the counter, which starts at 0 for the empty store
+    backup := `{"version": 1, "packs": [{"id": "1", "size": 250}, {"id": "7", "size": 500}]}`
+    if rec := performKeyedRequest(router, http.MethodPost, "/restore", backup, "k3y"); rec.Code != http.StatusOK {
+        t.Fatalf("Expected the restore to succeed, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    var created Pack
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": 1000}`)
+    json.Unmarshal(rec.Body.Bytes(), &created)
+
+    if rec.Code != http.StatusOK || created.ID != "8" {
+        t.Errorf("Expected the new pack to follow the restored IDs as 8, got %d %s", rec.Code, rec.Body.String())
+    }
+}
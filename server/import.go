@@ -0,0 +1,85 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+)
+
+// loadPacksFile reads a JSON array of pack sizes, such as [250, 500, 1000], from path.
+func loadPacksFile(path string) ([]int, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var sizes []int
+    if err := json.Unmarshal(data, &sizes); err != nil {
+        return nil, fmt.Errorf("%s must contain a JSON array of pack sizes: %w", path, err)
+    }
+
+    for _, size := range sizes {
+        if size <= 0 {
+            return nil, fmt.Errorf("%s contains invalid pack size %d: %w", path, size, ErrInvalidPackSize)
+        }
+
+        if err := checkPackSize(size); err != nil {
+            return nil, fmt.Errorf("%s contains invalid pack size: %w", path, err)
+        }
+    }
+
+    return sizes, nil
+}
+
+// ImportPacks upserts the given sizes into the store, creating a pack for every size
+// not already in the catalog. It returns the number of packs created.
+func ImportPacks(store PackStore, sizes []int) (int, error) {
+    packs, err := store.GetAllPacks(ListOptions{})
+    if err != nil {
+        return 0, err
+    }
+
+    existing := make(map[int]bool, len(packs))
+    for _, pack := range packs {
+        existing[pack.Size] = true
+    }
+
+    created := 0
+    for _, size := range sizes {
+        if existing[size] {
+            continue
+        }
+
+        if _, err := store.CreatePack(Pack{Size: size}); err != nil {
+            return created, err
+        }
+
+        existing[size] = true
+        created++
+    }
+
+    return created, nil
+}
+
+// importPacksFile loads the PACKS_FILE catalog into the store at startup, if one is configured.
+func importPacksFile(store PackStore) error {
+    path := os.Getenv("PACKS_FILE")
+    if path == "" {
+        return nil
+    }
+
+    sizes, err := loadPacksFile(path)
+    if err != nil {
+        return err
+    }
+
+    created, err := ImportPacks(store, sizes)
+    if err != nil {
+        return err
+    }
+
+    log.Printf("Imported packs from %s: %d sizes read, %d created, %d already present", path, len(sizes), created, len(sizes)-created)
+
+    return nil
+}
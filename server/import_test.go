@@ -0,0 +1,53 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "sort"
+    "testing"
+)
+
+func TestImportPacksFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "packs.json")
+    if err := os.WriteFile(path, []byte("[250, 500, 1000, 500]"), 0o600); err != nil {
+        t.Fatalf("Failed to write packs file: %v", err)
+    }
+    t.Setenv("PACKS_FILE", path)
+
+    store := NewMemoryStore()
+    store.CreatePack(Pack{Size: 250})
+
+    if err := importPacksFile(store); err != nil {
+        t.Fatalf("Failed to import packs file: %v", err)
+    }
+
+    packs, _ := store.GetAllPacks(ListOptions{})
+
+    var sizes []int
+    for _, pack := range packs {
+        sizes = append(sizes, pack.Size)
+    }
+    sort.Ints(sizes)
+
+    if len(sizes) != 3 || sizes[0] != 250 || sizes[1] != 500 || sizes[2] != 1000 {
+        t.Errorf("Expected sizes [250 500 1000], got %v", sizes)
+    }
+}
+
+func TestLoadPacksFileInvalid(t *testing.T) {
+    dir := t.TempDir()
+
+    for name, content := range map[string]string{
+        "object.json":   `{"size": 250}`,
+        "negative.json": `[250, -5]`,
+        "strings.json":  `["250"]`,
+        "huge.json":     `[250, 2147483648]`, // Above the default MAX_PACK_SIZE
+    } {
+        path := filepath.Join(dir, name)
+        os.WriteFile(path, []byte(content), 0o600)
+
+        if _, err := loadPacksFile(path); err == nil {
+            t.Errorf("%s: expected an error for %s", name, content)
+        }
+    }
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "slices"
+)
+
+// Label layouts decide the order in which packs of equal size are labelled.
+const (
+    LayoutGrouped     = "grouped"     // Label every pack of a size before the next size (default)
+    LayoutInterleaved = "interleaved" // Take one pack of each size in turn, for mixed-pallet loading
+)
+
+// Layouts lists every supported label layout, default first.
+var Layouts = []string{LayoutGrouped, LayoutInterleaved}
+
+// ValidLayout reports whether layout is empty or one of the Layout constants.
+func ValidLayout(layout string) bool {
+    return layout == "" || slices.Contains(Layouts, layout)
+}
+
+// expandLabels expands pack lines into the size of every individual pack, in the order
+// their labels are printed under layout.
+func expandLabels(lines []PackQuantity, layout string) []int {
+    var sizes []int
+
+    if layout != LayoutInterleaved {
+        for _, line := range lines {
+            for i := 0; i < line.Quantity; i++ {
+                sizes = append(sizes, line.Pack)
+            }
+        }
+
+        return sizes
+    }
+
+    remaining := make([]int, len(lines))
+    left := 0
+    for i, line := range lines {
+        remaining[i] = line.Quantity
+        left += line.Quantity
+    }
+
+    for left > 0 {
+        for i, line := range lines {
+            if remaining[i] > 0 {
+                sizes = append(sizes, line.Pack)
+                remaining[i]--
+                left--
+            }
+        }
+    }
+
+    return sizes
+}
+
+// flatSizes expands pack lines into the size of every individual pack, largest first,
+// e.g. [5000, 5000, 2000, 250]. An empty breakdown gives an empty list.
+func flatSizes(lines []PackQuantity) []int {
+    sizes := append([]int{}, expandLabels(lines, LayoutGrouped)...)
+    slices.SortStableFunc(sizes, func(a, b int) int { return b - a })
+
+    return sizes
+}
+
+// renderLabels writes one line per pack of result, e.g. "Pack 2 of 5: 500 cans", in
+// the order given by layout.
+func renderLabels(w io.Writer, result Result, layout string) error {
+    unit := result.Unit
+    if unit == "" {
+        unit = "items"
+    }
+
+    sizes := expandLabels(result.Packs, layout)
+    for i, size := range sizes {
+        if _, err := fmt.Fprintf(w, "Pack %d of %d: %d %s\n", i+1, len(sizes), size, unit); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
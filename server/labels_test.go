@@ -0,0 +1,119 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "reflect"
+    "testing"
+)
+
+func TestExpandLabels(t *testing.T) {
+    lines := []PackQuantity{{Pack: 5000, Quantity: 3}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 2}}
+
+    tests := []struct {
+        layout   string
+        expected []int
+    }{
+        {"", []int{5000, 5000, 5000, 2000, 250, 250}},
+        {LayoutGrouped, []int{5000, 5000, 5000, 2000, 250, 250}},
+        {LayoutInterleaved, []int{5000, 2000, 250, 5000, 250, 5000}},
+    }
+
+    for _, test := range tests {
+        if got := expandLabels(lines, test.layout); !reflect.DeepEqual(got, test.expected) {
+            t.Errorf("%q: expected %v, got %v", test.layout, test.expected, got)
+        }
+    }
+
+    if got := expandLabels(nil, LayoutInterleaved); got != nil {
+        t.Errorf("Expected no labels for no packs, got %v", got)
+    }
+}
+
+func TestCalculateLabels(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []int{250, 500, 1000} {
+        performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size))
+    }
+
+    tests := []struct {
+        layout   string
+        expected string
+    }{
+        {"grouped", "Pack 1 of 4: 1000 items\nPack 2 of 4: 1000 items\nPack 3 of 4: 1000 items\nPack 4 of 4: 500 items\n"},
+        {"interleaved", "Pack 1 of 4: 1000 items\nPack 2 of 4: 500 items\nPack 3 of 4: 1000 items\nPack 4 of 4: 1000 items\n"},
+    }
+
+    for _, test := range tests {
+        rec := performRequest(router, http.MethodGet, "/calculate?format=labels&items=3500&layout="+test.layout, "")
+        if rec.Code != http.StatusOK || rec.Body.String() != test.expected {
+            t.Errorf("%s: expected %q, got %d %q", test.layout, test.expected, rec.Code, rec.Body.String())
+        }
+    }
+
+    if rec := performRequest(router, http.MethodGet, "/calculate?format=labels&items=1&layout=diagonal", ""); rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for an unsupported layout, got %d", rec.Code)
+    }
+}
+
+func TestFlatSizes(t *testing.T) {
+    tests := []struct {
+        lines    []PackQuantity
+        expected []int
+    }{
+        {[]PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}}, []int{5000, 5000, 2000, 250}},
+        {[]PackQuantity{{Pack: 250, Quantity: 1}, {Pack: 5000, Quantity: 1}, {Pack: 250, Quantity: 1}}, []int{5000, 250, 250}},
+        {[]PackQuantity{}, []int{}},
+    }
+
+    for _, test := range tests {
+        if sizes := flatSizes(test.lines); !reflect.DeepEqual(sizes, test.expected) {
+            t.Errorf("%+v: expected %v, got %v", test.lines, test.expected, sizes)
+        }
+    }
+}
+
+func TestCalculateFlat(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []int{250, 500, 1000, 2000, 5000} {
+        performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size))
+    }
+
+    for _, items := range []int{0, 1, 251, 12001, 14750} {
+        var result Result
+        json.Unmarshal(performRequest(router, http.MethodGet, fmt.Sprintf("/calculate?items=%d", items), "").Body.Bytes(), &result)
+
+        var sizes []int
+        rec := performRequest(router, http.MethodGet, fmt.Sprintf("/calculate?format=flat&items=%d", items), "")
+        if err := json.Unmarshal(rec.Body.Bytes(), &sizes); rec.Code != http.StatusOK || err != nil || sizes == nil {
+            t.Errorf("%d: expected a list of sizes, got %d %s", items, rec.Code, rec.Body.String())
+            continue
+        }
+
+        // The flat list holds each size as many times as the breakdown has packs of it, largest first
+        var expected []int
+        for _, line := range result.Packs {
+            for i := 0; i < line.Quantity; i++ {
+                expected = append(expected, line.Pack)
+            }
+        }
+
+        total := 0
+        for i, size := range sizes {
+            total += size
+            if i > 0 && size > sizes[i-1] {
+                t.Errorf("%d: expected sizes largest first, got %v", items, sizes)
+                break
+            }
+        }
+
+        if len(sizes) != result.TotalPacks || total != result.TotalItems || (len(expected) > 0 && !reflect.DeepEqual(sizes, expected)) {
+            t.Errorf("%d: expected the sizes of %+v, got %v", items, result, sizes)
+        }
+    }
+}
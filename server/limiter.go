@@ -0,0 +1,151 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// calculationLimiter holds the limit on concurrent calculations, configured from
+// MAX_CONCURRENT_CALCULATIONS and CALCULATION_QUEUE_TIMEOUT in main. Nil means unlimited.
+var calculationLimiter *CalculationLimiter
+
+// CalculationLimiter caps how many calculations run at once, so a flood of large
+// orders can't exhaust the CPU. Requests beyond the cap wait for a free slot for up
+// to the queue timeout, or are rejected straight away when it is zero.
+type CalculationLimiter struct {
+    slots chan struct{}
+    wait  time.Duration
+}
+
+// NewCalculationLimiter returns a limiter running at most max calculations at once,
+// with others waiting up to wait for a slot.
+func NewCalculationLimiter(max int, wait time.Duration) *CalculationLimiter {
+    return &CalculationLimiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+// loadCalculationLimiter builds the limiter from MAX_CONCURRENT_CALCULATIONS and
+// CALCULATION_QUEUE_TIMEOUT. It returns nil when no maximum is set.
+func loadCalculationLimiter() (*CalculationLimiter, error) {
+    value := os.Getenv("MAX_CONCURRENT_CALCULATIONS")
+    if value == "" {
+        return nil, nil
+    }
+
+    max, err := strconv.Atoi(value)
+    if err != nil || max <= 0 {
+        return nil, fmt.Errorf("invalid MAX_CONCURRENT_CALCULATIONS %q: must be a positive integer", value)
+    }
+
+    var wait time.Duration
+    if value := os.Getenv("CALCULATION_QUEUE_TIMEOUT"); value != "" {
+        wait, err = time.ParseDuration(value)
+        if err != nil || wait < 0 {
+            return nil, fmt.Errorf("invalid CALCULATION_QUEUE_TIMEOUT %q: must be a non-negative duration, e.g. 2s", value)
+        }
+    }
+
+    return NewCalculationLimiter(max, wait), nil
+}
+
+// acquire takes a slot, waiting up to the queue timeout or until done is closed.
+// It reports whether a slot was taken; callers that got one must release it.
+func (l *CalculationLimiter) acquire(done <-chan struct{}) bool {
+    select {
+    case l.slots <- struct{}{}:
+        return true
+    default:
+    }
+
+    if l.wait == 0 {
+        return false
+    }
+
+    timer := time.NewTimer(l.wait)
+    defer timer.Stop()
+
+    select {
+    case l.slots <- struct{}{}:
+        return true
+    case <-timer.C:
+        return false
+    case <-done:
+        return false
+    }
+}
+
+// release frees a slot taken by acquire.
+func (l *CalculationLimiter) release() {
+    <-l.slots
+}
+
+// calculationSlot is a limiter slot shared by a request and the calculations it starts,
+// so a calculation abandoned when the time budget runs out keeps the slot until it ends.
+// The slot is freed when its last holder releases it. A nil slot holds nothing.
+type calculationSlot struct {
+    limiter *CalculationLimiter
+    holders atomic.Int32
+}
+
+// calculationSlotKey is the request context key of the calculationSlot of a request.
+type calculationSlotKey struct{}
+
+// requestSlot returns the slot held by the request of ctx, nil when none was taken.
+func requestSlot(ctx context.Context) *calculationSlot {
+    slot, _ := ctx.Value(calculationSlotKey{}).(*calculationSlot)
+    return slot
+}
+
+// hold adds a holder to the slot.
+func (s *calculationSlot) hold() {
+    if s != nil {
+        s.holders.Add(1)
+    }
+}
+
+// release removes a holder, freeing the limiter slot when it was the last.
+func (s *calculationSlot) release() {
+    if s != nil && s.holders.Add(-1) == 0 {
+        s.limiter.release()
+    }
+}
+
+// limitedRoutes lists routes outside /calculate that run calculations, and so are held
+// to the concurrency limit too.
+var limitedRoutes = map[string]bool{
+    "/packs/:id/calculate-impact": true,
+    "/packs/compare-waste":        true,
+    "/debug/calculate":            true,
+}
+
+// limitCalculations holds calculate requests to the concurrency limit, rejecting those
+// that find no free slot in time with 503.
+func limitCalculations(ctx *gin.Context) {
+    route := ctx.FullPath()
+    if calculationLimiter == nil || !strings.HasPrefix(route, "/calculate") && !limitedRoutes[route] {
+        ctx.Next()
+        return
+    }
+
+    limiter := calculationLimiter
+    if !limiter.acquire(ctx.Request.Context().Done()) {
+        ctx.Header("Retry-After", "1")
+        ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many calculations in progress, please retry shortly"})
+        return  // Return service unavailable status when no calculation slot is free
+    }
+    slot := &calculationSlot{limiter: limiter}
+    slot.hold()
+    defer slot.release()
+
+    // Calculations started by the request find the slot in its context and hold it too
+    ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), calculationSlotKey{}, slot))
+
+    ctx.Next()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestCalculationLimiter(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    previous := calculationLimiter
+    defer func() { calculationLimiter = previous }()
+
+    // Without a queue timeout, requests finding every slot taken are rejected at once
+    calculationLimiter = NewCalculationLimiter(1, 0)
+    calculationLimiter.acquire(nil)
+
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 100}`)
+    if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+        t.Errorf("Expected status 503 with Retry-After while saturated, got %d", rec.Code)
+    }
+
+    if rec := performRequest(router, http.MethodGet, "/packs", ""); rec.Code != http.StatusOK {
+        t.Errorf("Expected routes that don't calculate to be unaffected, got %d", rec.Code)
+    }
+
+    calculationLimiter.release()
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 100}`); rec.Code != http.StatusOK {
+        t.Errorf("Expected status 200 once a slot is free, got %d", rec.Code)
+    }
+
+    // With a queue timeout, requests wait for a slot to free up
+    calculationLimiter = NewCalculationLimiter(1, time.Second)
+    calculationLimiter.acquire(nil)
+    go func() {
+        time.Sleep(20 * time.Millisecond)
+        calculationLimiter.release()
+    }()
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 100}`); rec.Code != http.StatusOK {
+        t.Errorf("Expected a queued request to succeed once a slot is released, got %d", rec.Code)
+    }
+
+    // Queued requests still give up when the timeout passes
+    calculationLimiter = NewCalculationLimiter(1, 20*time.Millisecond)
+    calculationLimiter.acquire(nil)
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 100}`); rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status 503 after the queue timeout, got %d", rec.Code)
+    }
+}
+
+func TestLoadCalculationLimiter(t *testing.T) {
+    t.Setenv("MAX_CONCURRENT_CALCULATIONS", "")
+    if limiter, err := loadCalculationLimiter(); limiter != nil || err != nil {
+        t.Errorf("Expected no limiter by default, got %+v %v", limiter, err)
+    }
+
+    t.Setenv("MAX_CONCURRENT_CALCULATIONS", "4")
+    t.Setenv("CALCULATION_QUEUE_TIMEOUT", "2s")
+    limiter, err := loadCalculationLimiter()
+    if err != nil || cap(limiter.slots) != 4 || limiter.wait != 2*time.Second {
+        t.Errorf("Expected 4 slots waiting up to 2s, got %+v %v", limiter, err)
+    }
+
+    for _, env := range [][2]string{{"0", ""}, {"four", ""}, {"4", "soon"}, {"4", "-1s"}} {
+        t.Setenv("MAX_CONCURRENT_CALCULATIONS", env[0])
+        t.Setenv("CALCULATION_QUEUE_TIMEOUT", env[1])
+        if _, err := loadCalculationLimiter(); err == nil {
+            t.Errorf("Expected an error for MAX_CONCURRENT_CALCULATIONS %q and CALCULATION_QUEUE_TIMEOUT %q", env[0], env[1])
+        }
+    }
+}
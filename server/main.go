@@ -1,9 +1,23 @@
 package main
 
 import (
+    "bytes"
     "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net"
     "net/http"
+    "net/url"
     "os"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
 
     // Importing necessary packages
     "github.com/gin-contrib/cors" // Middleware for CORS support
@@ -17,26 +31,186 @@ import (
 
 // Pack represents the data model for a pack with ID and Size fields.
 type Pack struct {
-    ID   string `json:"id" bson:"id"`   // Unique identifier for the pack
-    Size int    `json:"size" bson:"size"` // Size of the pack
+    ID        string    `json:"id" bson:"id"`                                 // Unique identifier for the pack
+    Size      int       `json:"size" bson:"size"`                             // Size of the pack
+    Tags      []string  `json:"tags,omitempty" bson:"tags,omitempty"`         // Product lines or groups the pack belongs to
+    Weight    float64   `json:"weight,omitempty" bson:"weight,omitempty"`     // Physical weight of a full pack
+    Cost      float64   `json:"cost,omitempty" bson:"cost,omitempty"`         // Price of a full pack
+    Priority  int       `json:"priority,omitempty" bson:"priority,omitempty"` // Preference among equally good breakdowns, higher first
+    Stock     int       `json:"stock,omitempty" bson:"stock,omitempty"`       // Packs of this size on hand, 0 when stock isn't tracked
+    CreatedAt time.Time `json:"createdAt" bson:"createdAt"`                   // Time the pack was created
+    UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`                   // Time the pack was last updated
 }
 
+// PackSize is a pack size that also accepts quoted and whitespace-padded numbers,
+// such as "500 ", when decoded from JSON.
+type PackSize int
+
+// UnmarshalJSON decodes a JSON number or a string holding an integer into the size.
+func (s *PackSize) UnmarshalJSON(data []byte) error {
+    raw := string(data)
+
+    var quoted string
+    if err := json.Unmarshal(data, &quoted); err == nil {
+        raw = quoted // Unwrap string values before parsing
+    }
+
+    size, err := strconv.Atoi(strings.TrimSpace(raw))
+    if err != nil {
+        return fmt.Errorf("size must be an integer, got %s", data)
+    }
+
+    *s = PackSize(size)
+    return nil
+}
+
+// PackRequest is the body accepted when creating or updating a pack.
+type PackRequest struct {
+    Size     PackSize `json:"size"`                   // Size of the pack, as a number or numeric string
+    Tags     []string `json:"tags"`                   // Optional tags used to group packs
+    Weight   float64  `json:"weight" binding:"gte=0"` // Optional physical weight of a full pack
+    Cost     float64  `json:"cost" binding:"gte=0"`   // Optional price of a full pack
+    Priority int      `json:"priority"`               // Optional preference among equally good breakdowns, higher first
+    Stock    int      `json:"stock" binding:"gte=0"`  // Optional packs on hand, 0 when stock isn't tracked
+}
+
+// Pack converts the request into a Pack model.
+func (r PackRequest) Pack() Pack {
+    return Pack{Size: int(r.Size), Tags: r.Tags, Weight: r.Weight, Cost: r.Cost, Priority: r.Priority, Stock: r.Stock}
+}
+
+// ValidateRequest is the body accepted by POST /packs/validate.
+type ValidateRequest struct {
+    Sizes []int `json:"sizes"` // Proposed pack sizes
+}
+
+// ValidateResponse reports whether a proposed set of pack sizes is usable.
+type ValidateResponse struct {
+    Valid    bool     `json:"valid"`            // Whether the set has no errors
+    Errors   []string `json:"errors,omitempty"` // Problems that make the set unusable
+    Warnings []string `json:"warnings"`         // Problems worth reviewing that don't block the set
+}
+
+// SizeChange is an entry in a pack's history: a size the pack was given and when.
+type SizeChange struct {
+    PackID    string    `json:"-" bson:"packId"`            // ID of the pack
+    Size      int       `json:"size" bson:"size"`           // Size the pack was given
+    ChangedAt time.Time `json:"changedAt" bson:"changedAt"` // Time of the change
+}
+
+// DiffRequest is the body accepted by POST /packs/diff.
+type DiffRequest struct {
+    Packs []PackRequest `json:"packs"` // Proposed catalog
+}
+
+// ReplaceRequest is the body accepted by PUT /packs.
+type ReplaceRequest struct {
+    Packs []PackRequest `json:"packs" binding:"required,min=1,dive"` // Complete new catalog
+}
+
+// SuggestRequest is the body accepted by POST /packs/suggest.
+type SuggestRequest struct {
+    Orders       []int `json:"orders" binding:"required,min=1,max=100,dive,gt=0"` // Sample orders to suggest pack sizes for
+    Count        int   `json:"count" binding:"required,gt=0,max=10"`              // Number of pack sizes to suggest
+    TimeBudgetMs int   `json:"timeBudgetMs" binding:"gte=0,max=10000"`            // Longest the search may take in milliseconds, 2000 when omitted
+}
+
+// CompareWasteRequest is the body accepted by POST /packs/compare-waste.
+type CompareWasteRequest struct {
+    CalculateParams
+    Catalogs [][]int `json:"catalogs" binding:"required,min=2,max=10"`             // Pack sizes of each candidate catalog
+    Orders   []int   `json:"orders" binding:"required,min=1,max=10000,dive,gt=0"` // Demand profile both catalogs ship
+}
+
+// BulkDeleteRequest is the body accepted by POST /packs/delete.
+type BulkDeleteRequest struct {
+    Sizes []int `json:"sizes" binding:"required,min=1,max=100,dive,gt=0"` // Sizes of the packs to delete
+}
+
+// ListOptions controls how packs are filtered and ordered when listing them.
+type ListOptions struct {
+    Sort    string   // Sort order key from packSorts, empty keeps the natural order
+    Tags    []string // Only include packs carrying any of these tags, empty includes all
+    MinSize int      // Only include packs at least this size, 0 leaves the range open below
+    MaxSize int      // Only include packs at most this size, 0 leaves the range open above
+    Fields  []string // Only load these fields, by their JSON names, empty loads every field
+}
+
+// packSorts maps the supported ?sort= values to their MongoDB sort documents.
+var packSorts = map[string]bson.D{
+    "created_asc":  {{Key: "createdAt", Value: 1}},
+    "created_desc": {{Key: "createdAt", Value: -1}},
+}
+
+// defaultPackSort is the order packs are always read in, after any ?sort= order: largest
+// first, then by ID, so every read of an unchanged catalog lists the packs the same way.
+var defaultPackSort = bson.D{{Key: "size", Value: -1}, {Key: "id", Value: 1}}
+
+// packBefore reports whether a comes before b in defaultPackSort.
+func packBefore(a, b Pack) bool {
+    if a.Size != b.Size {
+        return a.Size > b.Size
+    }
+
+    return a.ID < b.ID
+}
+
+var (
+    // ErrPackNotFound is returned by MemoryStore when no pack matches the given ID.
+    ErrPackNotFound = errors.New("pack not found")
+    // ErrDuplicateSize is returned when creating or resizing a pack to a size already in the catalog.
+    ErrDuplicateSize = errors.New("pack size already exists")
+    // ErrPackSizeTooLarge is returned for pack sizes above MAX_PACK_SIZE.
+    ErrPackSizeTooLarge = errors.New("pack size is too large")
+)
+
+// PackStore is the storage backend used by the HTTP handlers.
+// Database is the MongoDB implementation and MemoryStore the in-memory one.
+type PackStore interface {
+    CreatePack(pack Pack) (Pack, error)
+    GetAllPacks(opts ListOptions) ([]Pack, error)
+    GetPack(id string) (Pack, error)
+    UpdatePack(pack Pack) (Pack, error)
+    DeletePack(id string) error
+    DeletePacksBySize(sizes []int) (int, error)
+    ReplacePacks(packs []Pack) (ReplaceSummary, error)
+    PackHistory(id string) ([]SizeChange, error)
+    Ping(ctx context.Context) error
+}
+
+// Names of the MongoDB database and collections the packs are stored in.
+const (
+    databaseName    = "packsdb"
+    packsCollection = "packs"
+    auditCollection = "audit"
+)
+
+// listenAddr is the address the server listens on.
+const listenAddr = ":8080"
+
 // Database encapsulates the MongoDB client and collection.
 type Database struct {
     client     *mongo.Client       // MongoDB client
     collection *mongo.Collection    // Collection to perform operations on
+    audit      *mongo.Collection    // Collection recording every size given to a pack
+    newID      func() string        // ID generator for new packs from ID_SCHEME, defaults to uuid.NewString
+    observeID  func(id string)      // Tells the generator of IDs stored without it
 }
 
 // InitDatabase initializes the database connection and returns a Database instance.
-func InitDatabase() Database {
-    // Load environment variables from .env file
-    err := godotenv.Load()
-    if err != nil {
-        panic(err) // Panic if loading .env file fails
+// Settings in a .env file are loaded when there is one, otherwise the environment is
+// used as is. A malformed MongoDB URL is reported as an error naming the setting to fix.
+func InitDatabase() (Database, error) {
+    // Load environment variables from .env file, if present; containers set them directly
+    if err := godotenv.Load(); err != nil {
+        log.Printf("No .env file loaded, using the environment: %s", err)
     }
     
     // Get the MongoDB connection URL from environment variables
-    mongoURL := os.Getenv("MONGO_URL")
+    mongoURL := mongoURI()
+    if err := validateMongoURI(mongoURL); err != nil {
+        return Database{}, err
+    }
     
     // Set up MongoDB client options with the provided URL
     clientOptions := options.Client().ApplyURI(mongoURL)
@@ -44,32 +218,176 @@ func InitDatabase() Database {
     // Connect to MongoDB using the specified options
     client, err := mongo.Connect(context.TODO(), clientOptions)
     if err != nil {
-        panic(err) // Panic if connection fails
+        return Database{}, fmt.Errorf("connecting to MongoDB at %s: %w", redactURL(mongoURL), err)
     }
 
-    // Initialize the collection for packs in the packsdb database
-    collection := client.Database("packsdb").Collection("packs")
+    // Initialize the collections for packs and their audit log in the packsdb database
+    collection := client.Database(databaseName).Collection(packsCollection)
+    audit := client.Database(databaseName).Collection(auditCollection)
+
+    db := Database{client: client, collection: collection, audit: audit}
+
+    // Pick the ID generator, letting numeric IDs continue after those already stored
+    db.newID, db.observeID, err = idSchemeFor(idScheme).Generator(db.packIDs)
+    if err != nil {
+        return Database{}, fmt.Errorf("reading pack IDs: %w", err)
+    }
     
-    return Database{client: client, collection: collection} // Return the initialized database instance
+    return db, nil // Return the initialized database instance
+}
+
+// packIDs returns the IDs of every stored pack.
+func (db Database) packIDs() ([]string, error) {
+    packs, err := db.GetAllPacks(ListOptions{Fields: []string{"id"}})
+    if err != nil {
+        return nil, err
+    }
+
+    ids := make([]string, len(packs))
+    for i, pack := range packs {
+        ids[i] = pack.ID
+    }
+
+    return ids, nil
+}
+
+// mongoURI returns MONGO_URL when set. Otherwise it assembles the URI from
+// MONGO_HOST, MONGO_PORT, MONGO_USER, MONGO_PASS and MONGO_AUTHDB, escaping the credentials.
+func mongoURI() string {
+    if mongoURL := os.Getenv("MONGO_URL"); mongoURL != "" {
+        return mongoURL
+    }
+
+    host := os.Getenv("MONGO_HOST")
+    if host == "" {
+        host = "localhost"
+    }
+
+    port := os.Getenv("MONGO_PORT")
+    if port == "" {
+        port = "27017"
+    }
+
+    uri := url.URL{Scheme: "mongodb", Host: net.JoinHostPort(host, port), Path: "/"}
+
+    if user := os.Getenv("MONGO_USER"); user != "" {
+        uri.User = url.UserPassword(user, os.Getenv("MONGO_PASS"))
+    }
+
+    if authDB := os.Getenv("MONGO_AUTHDB"); authDB != "" {
+        uri.RawQuery = url.Values{"authSource": {authDB}}.Encode()
+    }
+
+    return uri.String()
+}
+
+// validateMongoURI checks that the MongoDB URI is set and well formed before the driver
+// sees it, so a bad MONGO_URL fails startup with an error saying what is wrong with it.
+func validateMongoURI(uri string) error {
+    if strings.TrimSpace(uri) == "" {
+        return errors.New("MONGO_URL is empty: set it to a connection string such as mongodb://localhost:27017/")
+    }
+
+    parsed, err := url.Parse(uri)
+    if err != nil {
+        return fmt.Errorf("MONGO_URL is not a valid URL: %w", errors.Unwrap(err))
+    }
+
+    if parsed.Scheme != "mongodb" && parsed.Scheme != "mongodb+srv" {
+        return fmt.Errorf("MONGO_URL must start with mongodb:// or mongodb+srv://, got %s", redactURL(uri))
+    }
+
+    if parsed.Host == "" {
+        return fmt.Errorf("MONGO_URL has no host, got %s", redactURL(uri))
+    }
+
+    return nil
+}
+
+// generateID returns a new pack ID using the configured generator,
+// falling back to a random UUID when none is set.
+func (db Database) generateID() string {
+    if db.newID == nil {
+        return uuid.NewString()
+    }
+
+    return db.newID()
+}
+
+// reserveID tells the configured generator of an ID stored without it, if one is set,
+// so it is never generated for another pack.
+func (db Database) reserveID(id string) {
+    if db.observeID != nil {
+        db.observeID(id)
+    }
+}
+
+// indexSizes makes pack sizes unique in the collection, so writers racing past the
+// duplicate checks of CreatePack and UpdatePack can't both store the same size.
+func (db Database) indexSizes() error {
+    index := mongo.IndexModel{Keys: bson.D{{Key: "size", Value: 1}}, Options: options.Index().SetUnique(true)}
+    _, err := db.collection.Indexes().CreateOne(context.TODO(), index)
+    return err
 }
 
 // CreatePack inserts a new pack into the database and returns it.
+// It returns ErrDuplicateSize if a pack of the same size already exists.
 func (db Database) CreatePack(pack Pack) (Pack, error) {
-    pack.ID = uuid.New().String() // Generate a new unique ID for the pack
+    count, err := db.collection.CountDocuments(context.TODO(), bson.M{"size": pack.Size}) // Count packs of the same size
+    if err != nil {
+        return Pack{}, err // Return an error if the check fails
+    }
+
+    if count > 0 {
+        return Pack{}, ErrDuplicateSize // Pack sizes are unique within the catalog
+    }
+
+    pack.ID = db.generateID() // Generate a new unique ID for the pack
+    pack.CreatedAt = time.Now().UTC()
+    pack.UpdatedAt = pack.CreatedAt
 
-    _, err := db.collection.InsertOne(context.TODO(), pack) // Insert the pack into the collection
+    _, err = db.collection.InsertOne(context.TODO(), pack) // Insert the pack into the collection
+    if mongo.IsDuplicateKeyError(err) {
+        return Pack{}, ErrDuplicateSize // Another writer stored the size since the check
+    }
     if err != nil {
         return Pack{}, err // Return an error if insertion fails
     }
 
+    if err := db.recordSize(pack.ID, pack.Size, pack.CreatedAt); err != nil {
+        return Pack{}, err // Return an error if the audit log can't be written
+    }
+
     return pack, nil // Return the created pack on success
 }
 
-// GetAllPacks retrieves all packs from the database.
-func (db Database) GetAllPacks() ([]Pack, error) {
+// GetAllPacks retrieves all packs from the database in the requested order.
+func (db Database) GetAllPacks(opts ListOptions) ([]Pack, error) {
     var packs []Pack
 
-    cursor, err := db.collection.Find(context.TODO(), bson.M{}) // Find all packs in the collection
+    sort := append(append(bson.D{}, packSorts[opts.Sort]...), defaultPackSort...) // Break ties of the requested order deterministically
+    findOptions := options.Find().SetSort(sort)
+    if len(opts.Fields) > 0 {
+        findOptions.SetProjection(packProjection(opts.Fields)) // Load only the requested fields
+    }
+
+    filter := bson.M{}
+    if len(opts.Tags) > 0 {
+        filter["tags"] = bson.M{"$in": opts.Tags} // Match packs carrying any of the requested tags
+    }
+
+    size := bson.M{}
+    if opts.MinSize > 0 {
+        size["$gte"] = opts.MinSize
+    }
+    if opts.MaxSize > 0 {
+        size["$lte"] = opts.MaxSize
+    }
+    if len(size) > 0 {
+        filter["size"] = size // Match packs within the requested size range
+    }
+
+    cursor, err := db.collection.Find(context.TODO(), filter, findOptions) // Find matching packs in the collection
     if err != nil {
         return nil, err // Return an error if retrieval fails
     }
@@ -95,16 +413,73 @@ func (db Database) GetPack(id string) (Pack, error) {
     return pack, nil // Return the found pack on success
 }
 
-// UpdatePack updates an existing pack in the database.
+// UpdatePack updates an existing pack in the database, preserving its creation time.
+// It returns ErrDuplicateSize if another pack already has the new size.
 func (db Database) UpdatePack(pack Pack) (Pack, error) {
-   _, err := db.collection.UpdateOne(context.TODO(), bson.M{"id": pack.ID}, bson.M{"$set": pack}) 
-   // Update the pack in the collection based on its ID
+   var updated Pack
+
+   count, err := db.collection.CountDocuments(context.TODO(), bson.M{"size": pack.Size, "id": bson.M{"$ne": pack.ID}}) // Count other packs of the size
+   if err != nil {
+       return Pack{}, err // Return an error if the check fails
+   }
+
+   if count > 0 {
+       return Pack{}, ErrDuplicateSize // Pack sizes are unique within the catalog
+   }
 
+   update := bson.M{"$set": bson.M{"size": pack.Size, "tags": pack.Tags, "weight": pack.Weight, "cost": pack.Cost, "priority": pack.Priority, "stock": pack.Stock, "updatedAt": time.Now().UTC()}}
+   findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+   // Update the pack in the collection based on its ID and decode the stored result
+   err = db.collection.FindOneAndUpdate(context.TODO(), bson.M{"id": pack.ID}, update, findOptions).Decode(&updated)
+   if mongo.IsDuplicateKeyError(err) {
+       return Pack{}, ErrDuplicateSize // Another writer stored the size since the check
+   }
+   if err != nil {
+       return Pack{}, err // Return an error if update fails or pack not found
+   }
+
+   if err := db.recordSize(updated.ID, updated.Size, updated.UpdatedAt); err != nil {
+       return Pack{}, err // Return an error if the audit log can't be written
+   }
+
+   return updated, nil // Return the updated pack on success
+}
+
+// recordSize appends the size a pack was given to the audit log.
+func (db Database) recordSize(id string, size int, at time.Time) error {
+   _, err := db.audit.InsertOne(context.TODO(), SizeChange{PackID: id, Size: size, ChangedAt: at})
+   return err
+}
+
+// PackHistory returns the sizes a pack has had, oldest first, from the audit log.
+func (db Database) PackHistory(id string) ([]SizeChange, error) {
+   var entries []SizeChange
+
+   findOptions := options.Find().SetSort(bson.D{{Key: "changedAt", Value: 1}, {Key: "_id", Value: 1}})
+   cursor, err := db.audit.Find(context.TODO(), bson.M{"packId": id}, findOptions) // Find the pack's audit entries in order
    if err != nil {
-       return Pack{}, err // Return an error if update fails
+       return nil, err // Return an error if retrieval fails
+   }
+
+   if err = cursor.All(context.TODO(), &entries); err != nil {
+       return nil, err // Return an error if decoding fails
+   }
+
+   return sizeChanges(entries), nil // Return only the entries that changed the size
+}
+
+// sizeChanges drops the audit entries that left the size as it was, such as updates
+// that only changed tags, so just the size changes remain.
+func sizeChanges(entries []SizeChange) []SizeChange {
+   changes := []SizeChange{}
+   for _, entry := range entries {
+       if len(changes) == 0 || changes[len(changes)-1].Size != entry.Size {
+           changes = append(changes, entry)
+       }
    }
 
-   return pack, nil // Return the updated pack on success
+   return changes
 }
 
 // DeletePack removes a specific pack from the database by its ID.
@@ -115,112 +490,1632 @@ func (db Database) DeletePack(id string) error {
    return err // Return any errors that occurred during deletion
 }
 
-// Global variable to hold database instance initialized at application start.
-var database = InitDatabase()
-
-// InitRouter sets up HTTP routes and middleware for handling requests.
-func InitRouter() *gin.Engine {
-   router := gin.Default()           // Create a new Gin router instance
-   router.Use(cors.Default())        // Use default CORS middleware
+// DeletePacksBySize removes every pack whose size is in sizes and returns how many were removed.
+func (db Database) DeletePacksBySize(sizes []int) (int, error) {
+   res, err := db.collection.DeleteMany(context.TODO(), bson.M{"size": bson.M{"$in": sizes}}) // Delete all matching packs at once
+   if err != nil {
+       return 0, err // Return an error if deletion fails
+   }
 
-   router.POST("/packs", postPack)   // Route for creating a new pack
-   router.GET("/packs", getPacks)     // Route for retrieving all packs
-   router.GET("/packs/:id", getPack)  // Route for retrieving a specific pack by ID
-   router.PUT("/packs/:id", updatePack)  // Route for updating a specific pack by ID
-   router.DELETE("/packs/:id", deletePack)  // Route for deleting a specific pack by ID
-   
-   return router                     // Return configured router instance
+   return int(res.DeletedCount), nil // Return the number of deleted packs
 }
 
-// postPack handles POST requests to create a new pack.
-func postPack(ctx *gin.Context) {
-   var pack Pack
-   
-   if err := ctx.ShouldBindJSON(&pack); err != nil { 
-       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) 
-       return  // Return bad request status if JSON binding fails
+// ReplacePacks replaces the catalog with packs in a single transaction, so a failure
+// part way leaves the catalog as it was. Kept sizes keep their IDs and creation times,
+// and added packs keep any they carry, as restored backups do. Transactions need
+// MongoDB to run as a replica set; a standalone server rejects them.
+func (db Database) ReplacePacks(packs []Pack) (ReplaceSummary, error) {
+   session, err := db.client.StartSession()
+   if err != nil {
+       return ReplaceSummary{}, err // Return an error if no session can be started
    }
+   defer session.EndSession(context.TODO())
 
-   res, err := database.CreatePack(pack) 
+   summary, err := session.WithTransaction(context.TODO(), func(ctx mongo.SessionContext) (interface{}, error) {
+       return db.replacePacks(ctx, packs)
+   })
    if err != nil {
-       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}) 
-       return  // Return internal server error status if creation fails
+       return ReplaceSummary{}, err // Return an error if the transaction is aborted
    }
 
-   ctx.JSON(http.StatusOK, res)  // Return created pack with OK status on success
+   return summary.(ReplaceSummary), nil // Return the changes applied on success
 }
 
-// getAllPacks handles GET requests to retrieve all packs.
-func getAllPacks(ctx *gin.Context) {
-   packs, err := database.GetAllPacks() 
+// replacePacks applies a catalog replacement within the transaction of ctx.
+func (db Database) replacePacks(ctx mongo.SessionContext, packs []Pack) (ReplaceSummary, error) {
+   var current []Pack
+
+   cursor, err := db.collection.Find(ctx, bson.M{})
    if err != nil {
-       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err}) 
-       return  // Return internal server error status if retrieval fails
+       return ReplaceSummary{}, err // Return an error if retrieval fails
+   }
+   if err = cursor.All(ctx, &current); err != nil {
+       return ReplaceSummary{}, err // Return an error if decoding fails
    }
- 
-   ctx.JSON(http.StatusOK, packs)  // Return all packs with OK status on success
-}
-
-// getPack handles GET requests to retrieve a specific pack by ID.
-func getPack(ctx *gin.Context) {
-   id := ctx.Param("id")  // Extract ID from URL parameters
 
-   pack, err := database.GetPack(id)
+   summary, proposed, err := planReplace(current, packs)
    if err != nil {
-       ctx.JSON(http.StatusNotFound, gin.H{"error": "Pack not found"}) 
-       return  // Return not found status if retrieval fails or no such pack exists
+       return ReplaceSummary{}, err // Return an error for invalid proposed sizes
    }
 
-   ctx.JSON(http.StatusOK, pack)  // Return found pack with OK status on success
-}
+   now := time.Now().UTC()
 
-// updatePack handles PUT requests to update a specific pack by ID.
-func updatePack(ctx *gin.Context) {
-   id := ctx.Param("id")  // Extract ID from URL parameters
+   if len(summary.Removed) > 0 {
+       if _, err := db.collection.DeleteMany(ctx, bson.M{"size": bson.M{"$in": summary.Removed}}); err != nil {
+           return ReplaceSummary{}, err // Return an error if deletion fails
+       }
+   }
 
-   var pack Pack
-   
-   if err := ctx.ShouldBindJSON(&pack); err != nil { 
-       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) 
-       return  // Return bad request status if JSON binding fails
+   for _, size := range summary.Updated {
+       pack := proposed[size]
+       update := bson.M{"$set": bson.M{"tags": pack.Tags, "weight": pack.Weight, "cost": pack.Cost, "priority": pack.Priority, "stock": pack.Stock, "updatedAt": now}}
+       if _, err := db.collection.UpdateOne(ctx, bson.M{"size": size}, update); err != nil {
+           return ReplaceSummary{}, err // Return an error if the update fails
+       }
    }
 
-   pack.ID = id  // Ensure that the ID is set correctly for updating
+   for _, size := range summary.Added {
+       pack := proposed[size]
+       if pack.ID == "" {
+           pack.ID = db.generateID()
+       } else {
+           db.reserveID(pack.ID) // Keep later packs from reusing a carried ID
+       }
+       if pack.CreatedAt.IsZero() {
+           pack.CreatedAt = now
+       }
+       pack.UpdatedAt = now
 
-   updatedPack, err := database.UpdatePack(pack)
-   if err != nil {
-       ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pack"}) 
-       return  // Return internal server error status if update fails
+       if _, err := db.collection.InsertOne(ctx, pack); err != nil {
+           return ReplaceSummary{}, err // Return an error if insertion fails
+       }
+       if _, err := db.audit.InsertOne(ctx, SizeChange{PackID: pack.ID, Size: pack.Size, ChangedAt: now}); err != nil {
+           return ReplaceSummary{}, err // Return an error if the audit log can't be written
+       }
    }
 
-   ctx.JSON(http.StatusOK, updatedPack)  // Return updated pack with OK status on success
+   return summary, nil
 }
 
-// deletePack handles DELETE requests to remove a specific pack by ID.
-func deletePack(ctx *gin.Context) {
-   id := ctx.Param("id")  // Extract ID from URL parameters
+// Ping checks that MongoDB is reachable.
+func (db Database) Ping(ctx context.Context) error {
+   return db.client.Ping(ctx, nil) // Ping the server selected by the client's read preference
+}
 
-   if err := database.DeletePack(id); err != nil { 
-       ctx.JSON(http.StatusNotFound, gin.H{"error": "Failed to delete pack"}) 
-       return  // Return not found status if deletion fails or no such pack exists
-   }
+// Global variable to hold the pack store initialized at application start.
+var database PackStore
 
-   ctx.JSON(http.StatusNoContent, nil)  // Return No Content status (204) on successful deletion
+// defaultStrategy is the strategy applied when a calculate request omits one, set from DEFAULT_STRATEGY.
+var defaultStrategy = StrategyBalanced
+
+// loadDefaultStrategy reads DEFAULT_STRATEGY, falling back to balanced when unset.
+func loadDefaultStrategy() (string, error) {
+    strategy := os.Getenv("DEFAULT_STRATEGY")
+    if strategy == "" {
+        return StrategyBalanced, nil
+    }
+
+    if !ValidStrategy(strategy) {
+        return "", fmt.Errorf("invalid DEFAULT_STRATEGY %q: %w", strategy, ErrInvalidStrategy)
+    }
+
+    return strategy, nil
 }
 
-// getPacks handles GET requests to retrieve all packs (duplicate function).
-func getPacks(ctx *gin.Context) {
-   packs, err := database.GetAllPacks()
-   if err != nil {
-       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err}) 
-       return  // Return internal server error status if retrieval fails
-   }
+// trustedProxies lists the proxies whose forwarding headers are believed when resolving
+// client IPs, set from TRUSTED_PROXIES. None are trusted by default.
+var trustedProxies []string
 
-   ctx.JSON(http.StatusOK, packs)  // Return all packs with OK status on success
+// loadTrustedProxies reads TRUSTED_PROXIES, a comma-separated list of IPs and CIDR ranges.
+func loadTrustedProxies() ([]string, error) {
+    var proxies []string
+    for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+        proxy = strings.TrimSpace(proxy)
+        if proxy == "" {
+            continue
+        }
+
+        if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+            return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: must be an IP or CIDR range", proxy)
+        }
+        proxies = append(proxies, proxy)
+    }
+
+    return proxies, nil
 }
 
-// main is the entry point of the application.
-func main() {
+// defaultAlgorithm is the algorithm applied when a calculate request omits one, set from ALGO.
+var defaultAlgorithm = AlgorithmDP
+
+// loadDefaultAlgorithm reads ALGO, falling back to dp when unset.
+func loadDefaultAlgorithm() (string, error) {
+    algorithm := os.Getenv("ALGO")
+    if algorithm == "" {
+        return AlgorithmDP, nil
+    }
+
+    if !ValidAlgorithm(algorithm) {
+        return "", fmt.Errorf("invalid ALGO %q: %w", algorithm, ErrInvalidAlgorithm)
+    }
+
+    return algorithm, nil
+}
+
+// defaultMaxItems bounds the order size accepted by /calculate when MAX_ITEMS is unset,
+// since the calculation allocates memory proportional to the number of items.
+const defaultMaxItems = 1000000
+
+// defaultMaxPackSize bounds pack sizes when MAX_PACK_SIZE is unset. The calculation tables
+// grow with the largest pack as well as the order, so it matches defaultMaxItems.
+const defaultMaxPackSize = defaultMaxItems
+
+// readinessTimeout bounds how long a readiness probe waits for the store to answer.
+const readinessTimeout = 2 * time.Second
+
+// defaultMaxBodyBytes bounds request bodies when MAX_BODY_BYTES is unset.
+const defaultMaxBodyBytes = 1 << 20
+
+// maxSolutions bounds the co-optimal breakdowns listed when a request asks for all solutions.
+const maxSolutions = 20
+
+// maxTableRows bounds the orders listed by a single GET /calculate/table request.
+const maxTableRows = 10000
+
+// Page sizes of GET /packs: defaultPageLimit when only ?offset is given, at most maxPageLimit.
+const (
+    defaultPageLimit = 100
+    maxPageLimit     = 1000
+)
+
+// CalculateRequest is the body accepted by POST /calculate.
+type CalculateRequest struct {
+    CalculateParams
+    Items        int    `json:"items" binding:"gte=0"`       // Number of items ordered
+    Tag          string `json:"tag"`                         // Only calculate with packs carrying this tag
+    AllSolutions bool   `json:"allSolutions"`                // Also list every co-optimal breakdown, up to maxSolutions
+    Packs        []int  `json:"packs"`                       // Pack sizes to calculate with instead of the stored catalog
+    Subtotals    bool   `json:"subtotals"`                   // Add the items, cost and weight of each pack line
+    DisplayUnit  int    `json:"displayUnit" binding:"gte=0"` // Items per display unit, e.g. a carton, to also give the totals in, 0 for none
+}
+
+// CalculateParams holds the calculation options shared by the calculate request bodies.
+type CalculateParams struct {
+    Mode                string   `json:"mode" binding:"omitempty,mode"`                // Calculation mode, defaults to overship
+    Strategy            string   `json:"strategy" binding:"omitempty,strategy"`        // Calculation strategy, defaults to DEFAULT_STRATEGY
+    MaxOvershipPercent  *float64 `json:"maxOvershipPercent" binding:"omitempty,gte=0"` // Largest accepted overshipment in percent, unlimited when omitted
+    MaxWeight           *float64 `json:"maxWeight" binding:"omitempty,gte=0"`          // Largest accepted total weight of the packs, unlimited when omitted
+    MinOrder            int      `json:"minOrder" binding:"gte=0"`                     // Minimum order quantity, smaller orders are raised to it
+    RejectBelowMinOrder bool     `json:"rejectBelowMinOrder"`                          // Reject orders below minOrder instead of raising them
+    Algorithm           string   `json:"algorithm" binding:"omitempty,algorithm"`      // Calculation algorithm, defaults to ALGO
+    MinDistinctSizes    int      `json:"minDistinctSizes" binding:"gte=0"`             // Fewest distinct pack sizes to spread the order across when possible
+    LimitStock          bool     `json:"limitStock"`                                   // Never use more packs of a size than are in stock
+}
+
+// Options converts the params into CalculateOptions, applying the default strategy.
+func (p CalculateParams) Options() CalculateOptions {
+    strategy := p.Strategy
+    if strategy == "" {
+        strategy = defaultStrategy
+    }
+
+    algorithm := p.Algorithm
+    if algorithm == "" {
+        algorithm = defaultAlgorithm
+    }
+
+    return CalculateOptions{
+        Mode:                p.Mode,
+        Strategy:            strategy,
+        MaxOvershipPercent:  p.MaxOvershipPercent,
+        MaxWeight:           p.MaxWeight,
+        MinOrder:            p.MinOrder,
+        RejectBelowMinOrder: p.RejectBelowMinOrder,
+        Algorithm:           algorithm,
+        MinDistinctSizes:    p.MinDistinctSizes,
+        LimitStock:          p.LimitStock,
+    }
+}
+
+// NearestResponse is the result of GET /calculate/nearest.
+type NearestResponse struct {
+    Items int    `json:"items"` // Number of items ordered
+    Below Result `json:"below"` // Closest quantity at or below the order that fills exactly
+    Above Result `json:"above"` // Closest quantity at or above the order that fills exactly
+}
+
+// Capabilities lists the calculation options this server supports, so clients can
+// adapt to features as they land.
+type Capabilities struct {
+    Modes       []string         `json:"modes"`       // Supported values of mode
+    Strategies  []string         `json:"strategies"`  // Supported values of strategy
+    Algorithms  []string         `json:"algorithms"`  // Supported values of algorithm
+    Defaults    CapabilityValues `json:"defaults"`    // Values applied when a request omits them
+    Constraints []string         `json:"constraints"` // Other options accepted alongside mode, strategy and algorithm
+    Limits      CapabilityLimits `json:"limits"`      // Bounds on the size of requests
+}
+
+// CapabilityValues holds the mode, strategy and algorithm a calculation uses by default.
+type CapabilityValues struct {
+    Mode      string `json:"mode"`
+    Strategy  string `json:"strategy"`
+    Algorithm string `json:"algorithm"`
+}
+
+// CapabilityLimits holds the bounds applied to calculate requests.
+type CapabilityLimits struct {
+    MaxItems        int     `json:"maxItems"`        // Largest order accepted
+    MaxSolutions    int     `json:"maxSolutions"`    // Most co-optimal breakdowns listed
+    MaxTableRows    int     `json:"maxTableRows"`    // Most rows of /calculate/table
+    MaxTargetWeight float64 `json:"maxTargetWeight"` // Largest weight of /calculate/by-weight
+}
+
+// PackPage is a page of GET /packs, returned instead of the bare list when ?limit or
+// ?offset is given.
+type PackPage struct {
+    Data []Pack   `json:"data"` // Packs on this page
+    Page PageInfo `json:"page"` // Position of this page in the whole list
+}
+
+// PageInfo locates a page in a list, with the offsets of its neighbours so clients can
+// navigate without recomputing them.
+type PageInfo struct {
+    Limit      int  `json:"limit"`      // Most items on a page
+    Offset     int  `json:"offset"`     // Items before this page
+    Total      int  `json:"total"`      // Items in the whole list
+    NextOffset *int `json:"nextOffset"` // Offset of the next page, null on the last page
+    PrevOffset *int `json:"prevOffset"` // Offset of the previous page, null on the first page
+}
+
+// TableRow is the breakdown of one order in the result of GET /calculate/table.
+type TableRow struct {
+    Items      int            `json:"items"`      // Number of items ordered
+    Packs      []PackQuantity `json:"packs"`      // Breakdown of the order
+    TotalItems int            `json:"totalItems"` // Items shipped
+    TotalPacks int            `json:"totalPacks"` // Packs shipped
+}
+
+// ByWeightRequest is the body accepted by POST /calculate/by-weight.
+type ByWeightRequest struct {
+    Weight float64 `json:"weight" binding:"required,gt=0"` // Total weight to reach
+}
+
+// MultiRequest is the body accepted by POST /calculate/multi.
+type MultiRequest struct {
+    CalculateParams
+    SKUs map[string]MultiSKU `json:"skus" binding:"required,min=1,dive"` // Order of each product by SKU
+}
+
+// MultiSKU is the catalog and order of one product in a MultiRequest.
+type MultiSKU struct {
+    Packs []int `json:"packs" binding:"required"` // Pack sizes of the product
+    Items int   `json:"items" binding:"gte=0"`    // Number of items ordered
+}
+
+// ImpactRequest is the body accepted by POST /packs/:id/calculate-impact.
+type ImpactRequest struct {
+    CalculateParams
+    Size  int `json:"size" binding:"gt=0"`  // Proposed new size of the pack
+    Items int `json:"items" binding:"gte=0"` // Sample order to calculate
+}
+
+// ImpactResponse compares the breakdown of an order before and after resizing a pack.
+type ImpactResponse struct {
+    Before Result      `json:"before"` // Breakdown with the current catalog
+    After  Result      `json:"after"`  // Breakdown with the pack resized
+    Diff   []PackDelta `json:"diff"`   // Pack sizes whose quantities change
+}
+
+// CompareRequest is the body accepted by POST /calculate/compare.
+type CompareRequest struct {
+    CalculateParams
+    Items      int      `json:"items" binding:"gte=0"` // Number of items ordered
+    Strategies []string `json:"strategies"`            // Strategies to compare, all of them when omitted
+}
+
+// Comparison summarizes the breakdown of an order under one strategy.
+type Comparison struct {
+    Strategy     string         `json:"strategy"`        // Strategy used for this breakdown
+    TotalItems   int            `json:"totalItems"`      // Items shipped
+    TotalPacks   int            `json:"totalPacks"`      // Packs shipped
+    Overshipment int            `json:"overshipment"`    // Items shipped beyond the order
+    Packs        []PackQuantity `json:"packs,omitempty"` // Breakdown under this strategy
+    Error        string         `json:"error,omitempty"` // Reason the order could not be packed
+}
+
+// BatchRequest is the body accepted by POST /calculate/batch and /calculate/batch/stream.
+type BatchRequest struct {
+    CalculateParams
+    Orders []int `json:"orders" binding:"required,max=10000"` // Number of items in each order, at most 10000
+}
+
+// BatchEntry is the outcome of a single order in a batch calculation.
+type BatchEntry struct {
+    Items  int     `json:"items"`            // Number of items ordered
+    Status int     `json:"status"`           // HTTP status the order would get on its own
+    Result *Result `json:"result,omitempty"` // Breakdown when the order could be packed
+    Error  string  `json:"error,omitempty"`  // Reason the order could not be packed
+}
+
+// CombinedRequest is the body accepted by POST /calculate/combined.
+type CombinedRequest struct {
+    CalculateParams
+    Depots map[string][]int `json:"depots" binding:"required"` // Pack sizes stocked by each named depot
+    Items  int              `json:"items" binding:"gte=0"`     // Number of items ordered
+}
+
+// InitRouter sets up HTTP routes and middleware for handling requests.
+func InitRouter() *gin.Engine {
+   useJSONFieldNames()               // Report validation failures by their JSON field names
+   registerOptionRules()             // Accept the modes, strategies and algorithms Calculate supports
+   router := gin.Default()           // Create a new Gin router instance
+   router.Use(traceRequests)         // Record a span for every request
+   router.Use(wrapEnvelope)          // Wrap JSON responses in {"data", "error"} when RESPONSE_ENVELOPE=true
+   if err := router.SetTrustedProxies(trustedProxies); err != nil {
+       log.Printf("Ignoring TRUSTED_PROXIES: %s", err)  // Checked at startup, so only reachable from tests
+   }
+   router.Use(cors.Default())        // Use default CORS middleware
+   router.Use(readOnlyGuard)         // Reject writes while in read-only mode
+   router.Use(limitBody)             // Reject bodies larger than MAX_BODY_BYTES
+   router.Use(limitCalculations)     // Cap concurrent calculations at MAX_CONCURRENT_CALCULATIONS
+
+   router.POST("/packs", postPack)   // Route for creating a new pack
+   router.POST("/packs/validate", validatePacks)  // Route for validating a proposed set of pack sizes
+   router.POST("/packs/diff", diffPacks)  // Route for comparing a proposed catalog with the current one
+   router.POST("/packs/suggest", suggestPacks)  // Route for suggesting pack sizes for a sample of orders
+   router.POST("/packs/compare-waste", compareWaste)  // Route for comparing the overshipment of candidate catalogs
+   router.GET("/packs", getPacks)     // Route for retrieving all packs
+   router.PUT("/packs", putPacks)     // Route for replacing the whole catalog
+   router.GET("/packs/coverage", packCoverage)  // Route for checking how well the catalog covers orders
+   router.GET("/packs/search", searchPacks)  // Route for finding packs close to a size
+   router.GET("/packs/:id", validateID, getPack)  // Route for retrieving a specific pack by ID
+   router.PUT("/packs/:id", validateID, updatePack)  // Route for updating a specific pack by ID
+   router.DELETE("/packs/:id", validateID, deletePack)  // Route for deleting a specific pack by ID
+   router.POST("/packs/delete", deletePacks)  // Route for deleting every pack of the listed sizes
+   router.GET("/packs/:id/history", validateID, packHistory)  // Route for listing the size changes of a pack
+   router.POST("/packs/:id/calculate-impact", validateID, calculateImpact)  // Route for previewing how resizing a pack changes an order
+   router.POST("/calculate", calculate)  // Route for calculating the packs for an order
+   router.GET("/calculate", calculateQuery)  // Route for calculating an order from query parameters, e.g. as a printable pick sheet
+   router.GET("/calculate/nearest", nearestFillable)  // Route for finding the closest quantities that can be filled exactly
+   router.GET("/calculate/capabilities", capabilities)  // Route for listing the supported calculation options
+   router.GET("/calculate/table", calculateTable)  // Route for tabulating the breakdowns of a range of orders
+   router.POST("/calculate/by-weight", calculateByWeight)  // Route for calculating the packs reaching a target weight
+   router.POST("/calculate/combined", calculateCombined)  // Route for calculating an order across several depots
+   router.POST("/calculate/multi", calculateMulti)  // Route for calculating an order of several products at once
+   router.POST("/calculate/compare", compareStrategies)  // Route for comparing an order under several strategies
+   router.POST("/calculate/batch", calculateBatch)  // Route for calculating several orders at once
+   router.POST("/calculate/batch/stream", streamBatch)  // Route for streaming batch results as JSON Lines
+   router.GET("/selftest", selfTest)  // Route for checking the calculation against known cases
+   router.GET("/cache/stats", cacheStats)  // Route for reporting calculation cache hits and misses
+   router.GET("/livez", liveness)     // Route for the liveness probe, up while the process runs
+   router.GET("/readyz", readiness)   // Route for the readiness probe, up while the store answers
+   router.GET("/healthz", readiness)  // Route for the readiness probe under its older name
+   router.GET("/debug/config", requireAPIKey, debugConfig)  // Route for dumping the effective configuration, secrets masked
+   router.POST("/debug/calculate", requireAPIKey, debugCalculate)  // Route for replaying a calculation with its trace and timing
+   router.GET("/backup", requireAPIKey, backup)  // Route for exporting the packs and configuration for disaster recovery
+   router.POST("/restore", requireAPIKey, restore)  // Route for replacing the catalog with a backup in one transaction
+   
+   return router                     // Return configured router instance
+}
+
+// limitBody reads POST, PUT and PATCH bodies through http.MaxBytesReader and rejects
+// them with 413 once they pass maxBodyBytes, so an oversized import can't exhaust memory.
+// Bodies within the limit are buffered and handed on unchanged.
+func limitBody(ctx *gin.Context) {
+   switch ctx.Request.Method {
+   case http.MethodPost, http.MethodPut, http.MethodPatch:
+   default:
+       ctx.Next()
+       return
+   }
+
+   limit := maxBodyBytes()
+   body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit))
+   if err != nil {
+       var tooLarge *http.MaxBytesError
+       if errors.As(err, &tooLarge) {
+           ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body must not exceed %d bytes", limit)})
+           return  // Return request entity too large status for oversized bodies
+       }
+
+       ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if the body can't be read
+   }
+
+   ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+   ctx.Next()
+}
+
+// readOnly blocks pack mutations during maintenance. It is set from READ_ONLY
+// at startup and can be toggled at runtime.
+var readOnly atomic.Bool
+
+// readOnlyRoutes lists routes that accept a body but never modify the catalog.
+var readOnlyRoutes = map[string]bool{
+   "/packs/validate":            true,
+   "/packs/diff":                true,
+   "/packs/suggest":             true,
+   "/packs/compare-waste":       true,
+   "/packs/:id/calculate-impact": true,
+   "/debug/calculate":            true,
+}
+
+// readOnlyGuard rejects POST, PUT, PATCH and DELETE requests with 503 while in read-only
+// mode, letting reads and calculations through.
+func readOnlyGuard(ctx *gin.Context) {
+   if !readOnly.Load() {
+       ctx.Next()
+       return
+   }
+
+   switch ctx.Request.Method {
+   case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+       route := ctx.FullPath()
+       if !readOnlyRoutes[route] && !strings.HasPrefix(route, "/calculate") {
+           ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "The service is in read-only mode for maintenance, writes are disabled"})
+           return  // Return service unavailable status for writes in read-only mode
+       }
+   }
+
+   ctx.Next()
+}
+
+// validateID rejects requests whose :id path parameter is not a well-formed ID of the
+// ID_SCHEME before they reach the database.
+func validateID(ctx *gin.Context) {
+   id := ctx.Param("id")  // Extract ID from URL parameters
+
+   if err := idSchemeFor(idScheme).Validate(id); err != nil {
+       ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid pack ID: " + id + " " + err.Error()})
+       return  // Return bad request status for malformed IDs
+   }
+
+   ctx.Next()
+}
+
+// postPack handles POST requests to create a new pack.
+func postPack(ctx *gin.Context) {
+   var req PackRequest
+   
+   if err := ctx.ShouldBindJSON(&req); err != nil { 
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) 
+       return  // Return bad request status if JSON binding fails
+   }
+
+   pack := req.Pack()
+   if err := checkPackSize(pack.Size); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for oversized packs
+   }
+
+   res, err := tracedStore(ctx).CreatePack(pack) 
+   if errors.Is(err, ErrDuplicateSize) {
+       ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+       return  // Return conflict status if the size already exists
+   }
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}) 
+       return  // Return internal server error status if creation fails
+   }
+
+   ctx.JSON(http.StatusOK, res)  // Return created pack with OK status on success
+}
+
+// selfTest runs the calculation against known cases so a deployment can be smoke tested.
+func selfTest(ctx *gin.Context) {
+   results, passed := RunSelfTest(selfTestCases)
+
+   status := http.StatusOK
+   if !passed {
+       status = http.StatusInternalServerError  // Fail loudly so a broken deploy is caught
+   }
+
+   ctx.JSON(status, gin.H{"passed": passed, "cases": results})
+}
+
+// cacheStats handles GET requests to report how well the calculation cache is doing.
+func cacheStats(ctx *gin.Context) {
+   ctx.JSON(http.StatusOK, calculationCache.Stats())  // Return cache counters with OK status
+}
+
+// liveness handles GET requests to check that the process is running. It never touches
+// the store, so a brief MongoDB outage doesn't get the server restarted.
+func liveness(ctx *gin.Context) {
+   ctx.JSON(http.StatusOK, gin.H{"status": "ok"})  // Return OK status while the process runs
+}
+
+// readiness handles GET requests to check that the store can serve requests.
+func readiness(ctx *gin.Context) {
+   pingCtx, cancel := context.WithTimeout(ctx.Request.Context(), readinessTimeout)
+   defer cancel()
+
+   if err := tracedStore(ctx).Ping(pingCtx); err != nil {
+       ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+       return  // Return service unavailable status while the store is unreachable
+   }
+
+   ctx.JSON(http.StatusOK, gin.H{"status": "ok"})  // Return OK status when the store answers
+}
+
+// packCoverage handles GET requests to check how well the current catalog covers orders.
+// The report carries an ETag of the catalog, so repeat requests are answered with 304
+// until the catalog changes.
+func packCoverage(ctx *gin.Context) {
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   if notModified(ctx, packs) {
+       return  // Return not modified status while the catalog is unchanged
+   }
+
+   ctx.JSON(http.StatusOK, coverageReport(packs))  // Return the coverage report with OK status
+}
+
+// validatePacks handles POST requests to validate a set of pack sizes without persisting it.
+func validatePacks(ctx *gin.Context) {
+   var req ValidateRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if JSON binding fails
+   }
+
+   errs, warnings := ValidatePackSizes(req.Sizes)
+   if warnings == nil {
+       warnings = []string{}  // Always return a list so clients can iterate it
+   }
+
+   ctx.JSON(http.StatusOK, ValidateResponse{Valid: len(errs) == 0, Errors: errs, Warnings: warnings})
+}
+
+// suggestPacks handles POST requests to suggest pack sizes for a sample of orders. The
+// search stops after timeBudgetMs, returning the best sizes found so far.
+func suggestPacks(ctx *gin.Context) {
+   var req SuggestRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": bindingErrors(err)})
+       return  // Return bad request status listing every invalid field if binding fails
+   }
+
+   for _, items := range req.Orders {
+       if items > maxItems() {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": "orders must not exceed " + strconv.Itoa(maxItems()) + " items"})
+           return  // Return bad request status for orders that are too large
+       }
+   }
+
+   budget := defaultSuggestBudget
+   if req.TimeBudgetMs > 0 {
+       budget = time.Duration(req.TimeBudgetMs) * time.Millisecond
+   }
+
+   ctx.JSON(http.StatusOK, SuggestPackSizes(req.Orders, req.Count, budget))  // Return the suggested sizes with OK status
+}
+
+// compareWaste handles POST requests to compare how much candidate catalogs overship a
+// demand profile, without touching the stored catalog.
+func compareWaste(ctx *gin.Context) {
+   var req CompareWasteRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": bindingErrors(err)})
+       return  // Return bad request status listing every invalid field if binding fails
+   }
+
+   catalogs := make([][]Pack, len(req.Catalogs))
+   for i, sizes := range req.Catalogs {
+       packs, err := inlinePacks(sizes)
+       if err == nil && len(packs) == 0 {
+           err = errors.New("invalid packs: a catalog needs at least one pack size")
+       }
+       if err != nil {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("catalog %d: %s", i, err)})
+           return  // Return bad request status for invalid catalogs
+       }
+       catalogs[i] = packs
+   }
+
+   ctx.JSON(http.StatusOK, CompareWaste(ctx.Request.Context(), catalogs, req.Orders, req.Options()))  // Return the waste of each catalog with OK status
+}
+
+// diffPacks handles POST requests to compare a proposed catalog with the current one without persisting it.
+func diffPacks(ctx *gin.Context) {
+   var req DiffRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if JSON binding fails
+   }
+
+   proposed := make([]Pack, len(req.Packs))
+   for i, pack := range req.Packs {
+       proposed[i] = pack.Pack()
+   }
+
+   current, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   diff, err := DiffCatalogs(current, proposed)
+   if err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for invalid proposed sizes
+   }
+
+   ctx.JSON(http.StatusOK, diff)  // Return the differences with OK status
+}
+
+// getAllPacks handles GET requests to retrieve all packs.
+func getAllPacks(ctx *gin.Context) {
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{}) 
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err}) 
+       return  // Return internal server error status if retrieval fails
+   }
+ 
+   ctx.JSON(http.StatusOK, packs)  // Return all packs with OK status on success
+}
+
+// getPack handles GET requests to retrieve a specific pack by ID.
+func getPack(ctx *gin.Context) {
+   id := ctx.Param("id")  // Extract ID from URL parameters
+
+   pack, err := tracedStore(ctx).GetPack(id)
+   if err != nil {
+       ctx.JSON(http.StatusNotFound, gin.H{"error": "Pack not found"}) 
+       return  // Return not found status if retrieval fails or no such pack exists
+   }
+
+   ctx.JSON(http.StatusOK, pack)  // Return found pack with OK status on success
+}
+
+// updatePack handles PUT requests to update a specific pack by ID.
+func updatePack(ctx *gin.Context) {
+   id := ctx.Param("id")  // Extract ID from URL parameters
+
+   var req PackRequest
+   
+   if err := ctx.ShouldBindJSON(&req); err != nil { 
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}) 
+       return  // Return bad request status if JSON binding fails
+   }
+
+   pack := req.Pack()
+   pack.ID = id  // Ensure that the ID is set correctly for updating
+   if err := checkPackSize(pack.Size); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for oversized packs
+   }
+
+   updatedPack, err := tracedStore(ctx).UpdatePack(pack)
+   if errors.Is(err, ErrDuplicateSize) {
+       ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+       return  // Return conflict status if another pack has the size
+   }
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pack"}) 
+       return  // Return internal server error status if update fails
+   }
+
+   ctx.JSON(http.StatusOK, updatedPack)  // Return updated pack with OK status on success
+}
+
+// deletePack handles DELETE requests to remove a specific pack by ID.
+func deletePack(ctx *gin.Context) {
+   id := ctx.Param("id")  // Extract ID from URL parameters
+
+   if err := tracedStore(ctx).DeletePack(id); err != nil { 
+       ctx.JSON(http.StatusNotFound, gin.H{"error": "Failed to delete pack"}) 
+       return  // Return not found status if deletion fails or no such pack exists
+   }
+
+   ctx.JSON(http.StatusNoContent, nil)  // Return No Content status (204) on successful deletion
+}
+
+// packHistory handles GET requests for the size changes of a pack, oldest first.
+// The history outlives the pack, so deleted packs can still be looked up.
+func packHistory(ctx *gin.Context) {
+   history, err := tracedStore(ctx).PackHistory(ctx.Param("id"))
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   if len(history) == 0 {
+       ctx.JSON(http.StatusNotFound, gin.H{"error": "Pack not found"})
+       return  // Return not found status for packs that never existed
+   }
+
+   ctx.JSON(http.StatusOK, history)  // Return the size changes with OK status on success
+}
+
+// deletePacks handles POST requests to delete every pack whose size is listed.
+// Sizes with no pack are ignored, so the count tells how many were found.
+func deletePacks(ctx *gin.Context) {
+   var req BulkDeleteRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": bindingErrors(err)})
+       return  // Return bad request status if the sizes are missing or invalid
+   }
+
+   deleted, err := tracedStore(ctx).DeletePacksBySize(req.Sizes)
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if deletion fails
+   }
+
+   ctx.JSON(http.StatusOK, gin.H{"deleted": deleted})  // Return the number of deleted packs with OK status
+}
+
+// putPacks handles PUT requests to replace the whole catalog with the given packs,
+// adding, removing and updating sizes so it matches exactly, and reports the changes.
+func putPacks(ctx *gin.Context) {
+   var req ReplaceRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": bindingErrors(err)})
+       return  // Return bad request status listing every invalid field if binding fails
+   }
+
+   packs := make([]Pack, len(req.Packs))
+   for i, pack := range req.Packs {
+       packs[i] = pack.Pack()
+       if err := checkPackSize(packs[i].Size); err != nil {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+           return  // Return bad request status for oversized packs, leaving the catalog alone
+       }
+   }
+
+   summary, err := tracedStore(ctx).ReplacePacks(packs)
+   if errors.Is(err, ErrInvalidPackSize) {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for invalid sizes
+   }
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if the replacement fails
+   }
+
+   ctx.JSON(http.StatusOK, summary)  // Return the changes applied with OK status
+}
+
+// getPacks handles GET requests to retrieve all packs (duplicate function).
+func getPacks(ctx *gin.Context) {
+   sort := ctx.Query("sort")  // Optional sort order, e.g. created_desc
+   if _, ok := packSorts[sort]; sort != "" && !ok {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort: " + sort})
+       return  // Return bad request status for unsupported sort orders
+   }
+
+   tags := ctx.QueryArray("tag")  // Optional tag filters, e.g. ?tag=fragile
+
+   limit, offset, paged, err := pageParams(ctx)
+   if err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for a malformed page
+   }
+
+   fields, err := fieldsParam(ctx)  // Optional projection, e.g. ?fields=size
+   if err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for unknown fields
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{Sort: sort, Tags: tags, Fields: fields})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err}) 
+       return  // Return internal server error status if retrieval fails
+   }
+
+   if len(fields) > 0 {
+       if paged {
+           page := packPage(packs, limit, offset)
+           ctx.JSON(http.StatusOK, gin.H{"data": projectPacks(page.Data, fields), "page": page.Page})
+           return  // Return the requested page of projected packs with OK status
+       }
+
+       ctx.JSON(http.StatusOK, projectPacks(packs, fields))  // Return only the requested fields with OK status
+       return
+   }
+
+   if paged {
+       ctx.JSON(http.StatusOK, packPage(packs, limit, offset))  // Return the requested page with OK status
+       return
+   }
+
+   ctx.JSON(http.StatusOK, packs)  // Return all packs with OK status on success
+}
+
+// pageParams reads ?limit and ?offset, reporting whether either was given. The limit
+// defaults to defaultPageLimit and the offset to 0.
+func pageParams(ctx *gin.Context) (limit int, offset int, paged bool, err error) {
+   limitValue, hasLimit := ctx.GetQuery("limit")
+   offsetValue, hasOffset := ctx.GetQuery("offset")
+   if !hasLimit && !hasOffset {
+       return 0, 0, false, nil
+   }
+
+   limit = defaultPageLimit
+   if hasLimit {
+       if limit, err = strconv.Atoi(limitValue); err != nil || limit <= 0 || limit > maxPageLimit {
+           return 0, 0, false, fmt.Errorf("limit must be an integer from 1 to %d", maxPageLimit)
+       }
+   }
+
+   if hasOffset {
+       if offset, err = strconv.Atoi(offsetValue); err != nil || offset < 0 {
+           return 0, 0, false, errors.New("offset must be a non-negative integer")
+       }
+   }
+
+   return limit, offset, true, nil
+}
+
+// packPage returns the page of packs starting at offset, with the offsets of the pages
+// around it. Offsets past the end give an empty page whose previous page is the last one.
+func packPage(packs []Pack, limit, offset int) PackPage {
+   page := PackPage{Data: []Pack{}, Page: PageInfo{Limit: limit, Offset: offset, Total: len(packs)}}
+
+   if offset < len(packs) {
+       page.Data = packs[offset:min(offset+limit, len(packs))]
+   }
+
+   if next := offset + limit; next < len(packs) {
+       page.Page.NextOffset = &next
+   }
+
+   if offset > 0 {
+       prev := max(min(offset, len(packs))-limit, 0)
+       page.Page.PrevOffset = &prev
+   }
+
+   return page
+}
+
+// searchPacks handles GET requests for the packs within ?tolerance= of the ?near= size,
+// closest first. Packs equally close are listed smaller first.
+func searchPacks(ctx *gin.Context) {
+   near, err := strconv.Atoi(ctx.Query("near"))
+   if err != nil || near <= 0 {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "near must be a positive integer"})
+       return  // Return bad request status for a missing or invalid size
+   }
+
+   tolerance := 0
+   if value := ctx.Query("tolerance"); value != "" {
+       tolerance, err = strconv.Atoi(value)
+       if err != nil || tolerance < 0 {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": "tolerance must be a non-negative integer"})
+           return  // Return bad request status for an invalid tolerance
+       }
+   }
+
+   opts := ListOptions{MinSize: max(near-tolerance, 1), MaxSize: near + tolerance}
+   packs, err := tracedStore(ctx).GetAllPacks(opts)
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   distance := func(pack Pack) int { return max(pack.Size-near, near-pack.Size) }
+   sort.SliceStable(packs, func(i, j int) bool {
+       if di, dj := distance(packs[i]), distance(packs[j]); di != dj {
+           return di < dj
+       }
+       return packs[i].Size < packs[j].Size
+   })
+
+   ctx.JSON(http.StatusOK, packs)  // Return the matching packs with OK status on success
+}
+
+// maxItems returns the largest order accepted by /calculate, read from MAX_ITEMS.
+func maxItems() int {
+   if n, err := strconv.Atoi(os.Getenv("MAX_ITEMS")); err == nil && n > 0 {
+       return n
+   }
+
+   return defaultMaxItems
+}
+
+// maxBodyBytes returns the largest request body accepted, read from MAX_BODY_BYTES.
+func maxBodyBytes() int64 {
+   if n, err := strconv.ParseInt(os.Getenv("MAX_BODY_BYTES"), 10, 64); err == nil && n > 0 {
+       return n
+   }
+
+   return defaultMaxBodyBytes
+}
+
+// maxPackSize returns the largest pack size accepted, read from MAX_PACK_SIZE.
+func maxPackSize() int {
+   if n, err := strconv.Atoi(os.Getenv("MAX_PACK_SIZE")); err == nil && n > 0 {
+       return n
+   }
+
+   return defaultMaxPackSize
+}
+
+// checkPackSize returns ErrPackSizeTooLarge, naming the bound, when size exceeds maxPackSize.
+func checkPackSize(size int) error {
+   if size > maxPackSize() {
+       return fmt.Errorf("%w: %d exceeds the largest pack size of %d", ErrPackSizeTooLarge, size, maxPackSize())
+   }
+
+   return nil
+}
+
+// unitLabel returns the label of the items being packed, read from UNIT_LABEL.
+func unitLabel() string {
+   return os.Getenv("UNIT_LABEL")
+}
+
+// calculateStatus maps a calculation error to its HTTP status: orders that can't be
+// packed with the catalog are unprocessable, anything else is invalid input.
+func calculateStatus(err error) int {
+   if errors.Is(err, ErrCalculationTimeout) {
+       return http.StatusServiceUnavailable
+   }
+
+   if errors.Is(err, ErrCalculationFailed) {
+       return http.StatusInternalServerError
+   }
+
+   if errors.Is(err, ErrNoPacks) || errors.Is(err, ErrUnfillable) || errors.Is(err, ErrOvershipExceeded) || errors.Is(err, ErrWeightExceeded) || errors.Is(err, ErrBelowMinOrder) || errors.Is(err, ErrStockExceeded) {
+       return http.StatusUnprocessableEntity
+   }
+
+   return http.StatusBadRequest
+}
+
+// calculate handles POST requests to calculate the packs needed for an order.
+func calculate(ctx *gin.Context) {
+   req, packs, ok := bindCalculate(ctx)
+   if !ok {
+       return
+   }
+
+   result, err := calculateWithin(ctx.Request.Context(), packs, req.Items, req.Options())
+   if err != nil {
+       ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+       return  // Return an error status matching the calculation failure
+   }
+
+   if req.AllSolutions {
+       result.Solutions, err = Solutions(packs, req.Items, req.Options(), maxSolutions)
+       if err != nil {
+           ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+           return  // Return an error status matching the calculation failure
+       }
+   }
+
+   result.Unit = unitLabel()
+   result.Packs = coalescePacks(result.Packs)  // Return packs largest first, whatever the algorithm built
+   result.TotalCost = totalCost(result.Packs, packs)
+   result.Utilization = utilization(req.Items, result.TotalItems)
+   if req.Subtotals {
+       addSubtotals(result.Packs, packs)
+   }
+   if req.DisplayUnit > 0 {
+       result.Display = displayTotals(req.Items, result.TotalItems, req.DisplayUnit)
+   }
+   ctx.JSON(http.StatusOK, result)  // Return the pack breakdown with OK status on success
+}
+
+// bindCalculate binds a calculate request and loads the packs it is calculated with,
+// its inline packs or the stored catalog, writing an error response on failure.
+func bindCalculate(ctx *gin.Context) (CalculateRequest, []Pack, bool) {
+   var req CalculateRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return req, nil, false  // Return bad request status if JSON binding fails
+   }
+
+   if req.Items > maxItems() {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must not exceed " + strconv.Itoa(maxItems())})
+       return req, nil, false  // Return bad request status for orders that are too large
+   }
+
+   packs, err := inlinePacks(req.Packs)
+   if err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return req, nil, false  // Return bad request status for an invalid inline pack set
+   }
+
+   if req.Packs != nil && req.Tag != "" {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "tag only applies to the stored catalog, not to inline packs"})
+       return req, nil, false  // Return bad request status when both an inline set and a tag are given
+   }
+
+   if req.Packs == nil {
+       var listOptions ListOptions
+       if req.Tag != "" {
+           listOptions.Tags = []string{req.Tag}  // Restrict the catalog to the requested tag
+       }
+
+       packs, err = tracedStore(ctx).GetAllPacks(listOptions)
+       if err != nil {
+           ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+           return req, nil, false  // Return internal server error status if retrieval fails
+       }
+   }
+
+   return req, packs, true
+}
+
+// inlinePacks validates the pack sizes given in a calculate request and converts them
+// into packs. It returns nil when no sizes were given, so the stored catalog is used.
+func inlinePacks(sizes []int) ([]Pack, error) {
+   if sizes == nil {
+       return nil, nil
+   }
+
+   if errs, _ := ValidatePackSizes(sizes); len(errs) > 0 {
+       return nil, errors.New("invalid packs: " + strings.Join(errs, "; "))
+   }
+
+   packs := make([]Pack, len(sizes))
+   for i, size := range sizes {
+       if size > maxItems() {
+           return nil, fmt.Errorf("invalid packs: pack size %d must not exceed %d", size, maxItems())
+       }
+       packs[i] = Pack{Size: size}
+   }
+
+   return packs, nil
+}
+
+// calculateQuery handles GET requests to calculate an order given as ?items=N. With
+// ?format=html the breakdown is rendered as a printable pick sheet instead of JSON,
+// and ?human=true groups its numbers with thousands separators. With ?format=labels
+// it is expanded to one plain text label per pack, ordered by ?layout=grouped or
+// ?layout=interleaved, and with ?format=flat to a JSON array of every pack's size.
+func calculateQuery(ctx *gin.Context) {
+   format := ctx.DefaultQuery("format", "json")
+   if format != "json" && format != "html" && format != "labels" && format != "flat" {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format: " + format})
+       return  // Return bad request status for unsupported formats
+   }
+
+   layout := ctx.Query("layout")
+   if !ValidLayout(layout) {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid layout: " + layout})
+       return  // Return bad request status for unsupported label layouts
+   }
+
+   items, err := strconv.Atoi(ctx.Query("items"))
+   if err != nil || items < 0 {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must be a non-negative integer"})
+       return  // Return bad request status for a missing or malformed order
+   }
+
+   if items > maxItems() {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must not exceed " + strconv.Itoa(maxItems())})
+       return  // Return bad request status for orders that are too large
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   result, err := calculateWithin(ctx.Request.Context(), packs, items, CalculateParams{}.Options())
+   if err != nil {
+       ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+       return  // Return an error status matching the calculation failure
+   }
+
+   result.Unit = unitLabel()
+   result.Packs = coalescePacks(result.Packs)  // Return packs largest first, whatever the algorithm built
+   result.TotalCost = totalCost(result.Packs, packs)
+   result.Utilization = utilization(items, result.TotalItems)
+
+   if format == "json" {
+       ctx.JSON(http.StatusOK, result)  // Return the pack breakdown with OK status on success
+       return
+   }
+
+   if format == "flat" {
+       ctx.JSON(http.StatusOK, flatSizes(result.Packs))  // Return the size of every pack, largest first, with OK status
+       return
+   }
+
+   if format == "labels" {
+       ctx.Header("Content-Type", "text/plain; charset=utf-8")
+       ctx.Status(http.StatusOK)
+       if err := renderLabels(ctx.Writer, result, layout); err != nil {
+           log.Printf("Unable to render labels: %s", err)
+       }
+       return
+   }
+
+   ctx.Header("Content-Type", "text/html; charset=utf-8")
+   ctx.Status(http.StatusOK)
+   if err := renderPickSheet(ctx.Writer, items, result, ctx.Query("human") == "true"); err != nil {
+       log.Printf("Unable to render pick sheet: %s", err)
+   }
+}
+
+// nearestFillable handles GET requests to find the closest quantities around an order that fill exactly.
+func nearestFillable(ctx *gin.Context) {
+   items, err := strconv.Atoi(ctx.Query("items"))
+   if err != nil || items < 0 {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must be a non-negative integer"})
+       return  // Return bad request status for a missing or malformed order
+   }
+
+   if items > maxItems() {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must not exceed " + strconv.Itoa(maxItems())})
+       return  // Return bad request status for orders that are too large
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   below, above, err := Nearest(packs, items)
+   if err != nil {
+       ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+       return  // Return an error status matching the calculation failure
+   }
+
+   below.Unit, above.Unit = unitLabel(), unitLabel()
+   ctx.JSON(http.StatusOK, NearestResponse{Items: items, Below: below, Above: above})
+}
+
+// capabilities handles GET requests to list the supported calculation options. They
+// come from the same lists and CalculateParams fields the requests are validated against.
+func capabilities(ctx *gin.Context) {
+   var constraints []string
+   params := reflect.TypeOf(CalculateParams{})
+   for i := 0; i < params.NumField(); i++ {
+       name, _, _ := strings.Cut(params.Field(i).Tag.Get("json"), ",")
+       if name != "mode" && name != "strategy" && name != "algorithm" {
+           constraints = append(constraints, name)
+       }
+   }
+
+   ctx.JSON(http.StatusOK, Capabilities{
+       Modes:       Modes,
+       Strategies:  Strategies,
+       Algorithms:  AlgorithmNames,
+       Defaults:    CapabilityValues{Mode: ModeOvership, Strategy: defaultStrategy, Algorithm: defaultAlgorithm},
+       Constraints: constraints,
+       Limits:      CapabilityLimits{MaxItems: maxItems(), MaxSolutions: maxSolutions, MaxTableRows: maxTableRows, MaxTargetWeight: maxTargetWeight},
+   })  // Return the supported options with OK status
+}
+
+// calculateTable handles GET requests to list the breakdown of every order from ?from=A
+// to ?to=B in steps of ?step=S, which defaults to 1. At most maxTableRows are listed.
+// The table carries an ETag of the catalog, so repeat requests are answered with 304
+// until the catalog changes.
+func calculateTable(ctx *gin.Context) {
+   from, err := strconv.Atoi(ctx.Query("from"))
+   if err != nil || from < 0 {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be a non-negative integer"})
+       return  // Return bad request status for a missing or malformed start of the range
+   }
+
+   to, err := strconv.Atoi(ctx.Query("to"))
+   if err != nil || to < from {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be an integer no smaller than from"})
+       return  // Return bad request status for a missing or malformed end of the range
+   }
+
+   step, err := strconv.Atoi(ctx.DefaultQuery("step", "1"))
+   if err != nil || step <= 0 {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "step must be a positive integer"})
+       return  // Return bad request status for a malformed step
+   }
+
+   if to > maxItems() {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must not exceed " + strconv.Itoa(maxItems())})
+       return  // Return bad request status for orders that are too large
+   }
+
+   rows := (to-from)/step + 1
+   if rows > maxTableRows {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "the table must not exceed " + strconv.Itoa(maxTableRows) + " rows"})
+       return  // Return bad request status for ranges listing too many orders
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   if notModified(ctx, packs) {
+       return  // Return not modified status while the catalog is unchanged
+   }
+
+   table := make([]TableRow, 0, rows)
+   for items := from; items <= to; items += step {
+       result, err := calculationCache.Calculate(packs, items, CalculateParams{}.Options())
+       if err != nil {
+           ctx.JSON(calculateStatus(err), gin.H{"error": "items " + strconv.Itoa(items) + ": " + err.Error()})
+           return  // Return an error status matching the calculation failure
+       }
+
+       table = append(table, TableRow{
+           Items:      items,
+           Packs:      coalescePacks(result.Packs),
+           TotalItems: result.TotalItems,
+           TotalPacks: result.TotalPacks,
+       })
+   }
+
+   ctx.JSON(http.StatusOK, table)  // Return one row per order with OK status
+}
+
+// calculateByWeight handles POST requests to find the packs reaching a target weight with the least overshoot.
+func calculateByWeight(ctx *gin.Context) {
+   var req ByWeightRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if JSON binding fails
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   result, err := CalculateByWeight(packs, req.Weight)
+   if errors.Is(err, ErrNoWeights) {
+       ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+       return  // Return unprocessable entity status when no pack has a weight
+   }
+   if err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for invalid target weights
+   }
+
+   result.Unit = unitLabel()
+   result.TotalCost = totalCost(result.Packs, packs)
+   ctx.JSON(http.StatusOK, result)  // Return the pack breakdown with OK status on success
+}
+
+// calculateMulti handles POST requests to calculate an order of several products, each from its own catalog.
+func calculateMulti(ctx *gin.Context) {
+   var req MultiRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if JSON binding fails
+   }
+
+   orders := make(map[string]SKUOrder, len(req.SKUs))
+   for sku, order := range req.SKUs {
+       if order.Items > maxItems() {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": "sku " + sku + ": items must not exceed " + strconv.Itoa(maxItems())})
+           return  // Return bad request status for orders that are too large
+       }
+
+       packs := make([]Pack, len(order.Packs))
+       for i, size := range order.Packs {
+           if err := checkPackSize(size); err != nil {
+               ctx.JSON(http.StatusBadRequest, gin.H{"error": "sku " + sku + ": " + err.Error()})
+               return  // Return bad request status for oversized packs, whose tables would exhaust memory
+           }
+           packs[i] = Pack{Size: size}
+       }
+       orders[sku] = SKUOrder{Packs: packs, Items: order.Items}
+   }
+
+   result, err := CalculateMulti(orders, req.Options())
+   if err != nil {
+       ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+       return  // Return an error status matching the calculation failure
+   }
+
+   ctx.JSON(http.StatusOK, result)  // Return the per-SKU breakdowns and totals with OK status on success
+}
+
+// calculateCombined handles POST requests to fill an order from several depots' catalogs.
+func calculateCombined(ctx *gin.Context) {
+   var req CombinedRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if JSON binding fails
+   }
+
+   if req.Items > maxItems() {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must not exceed " + strconv.Itoa(maxItems())})
+       return  // Return bad request status for orders that are too large
+   }
+
+   depots := make(map[string][]Pack, len(req.Depots))
+   for name, sizes := range req.Depots {
+       if name == "" {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": "depot names must not be empty"})
+           return  // Return bad request status for unnamed depots
+       }
+
+       packs, err := inlinePacks(sizes)
+       if err != nil {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": "depot " + name + ": " + err.Error()})
+           return  // Return bad request status for invalid or oversized sizes, whose tables would exhaust memory
+       }
+       depots[name] = packs
+   }
+
+   result, err := CalculateCombined(depots, req.Items, req.Options())
+   if err != nil {
+       ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+       return  // Return an error status matching the calculation failure
+   }
+
+   result.Unit = unitLabel()
+   ctx.JSON(http.StatusOK, result)  // Return the annotated breakdown with OK status on success
+}
+
+// calculateImpact handles POST requests to preview how resizing a pack changes an order's breakdown.
+func calculateImpact(ctx *gin.Context) {
+   id := ctx.Param("id")  // Extract ID from URL parameters
+
+   var req ImpactRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if JSON binding fails
+   }
+
+   if req.Items > maxItems() {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must not exceed " + strconv.Itoa(maxItems())})
+       return  // Return bad request status for orders that are too large
+   }
+
+   if err := checkPackSize(req.Size); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status for oversized packs
+   }
+
+   if _, err := tracedStore(ctx).GetPack(id); err != nil {
+       ctx.JSON(http.StatusNotFound, gin.H{"error": "Pack not found"})
+       return  // Return not found status if no such pack exists
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   proposed := make([]Pack, len(packs))
+   for i, pack := range packs {
+       proposed[i] = pack
+       if pack.ID == id {
+           proposed[i].Size = req.Size  // Resize only the targeted pack
+       }
+   }
+
+   before, err := calculateWithin(ctx.Request.Context(), packs, req.Items, req.Options())
+   if err != nil {
+       ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+       return  // Return an error status matching the calculation failure
+   }
+
+   after, err := calculateWithin(ctx.Request.Context(), proposed, req.Items, req.Options())
+   if err != nil {
+       ctx.JSON(calculateStatus(err), gin.H{"error": err.Error()})
+       return  // Return an error status matching the calculation failure
+   }
+
+   ctx.JSON(http.StatusOK, ImpactResponse{Before: before, After: after, Diff: DiffBreakdowns(before.Packs, after.Packs)})
+}
+
+// compareStrategies handles POST requests to calculate an order under several strategies side by side.
+func compareStrategies(ctx *gin.Context) {
+   var req CompareRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+       return  // Return bad request status if JSON binding fails
+   }
+
+   if req.Items > maxItems() {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": "items must not exceed " + strconv.Itoa(maxItems())})
+       return  // Return bad request status for orders that are too large
+   }
+
+   strategies := req.Strategies
+   if len(strategies) == 0 {
+       strategies = Strategies  // Compare every supported strategy by default
+   }
+
+   for _, strategy := range strategies {
+       if strategy == "" || !ValidStrategy(strategy) {
+           ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid strategy: " + strategy})
+           return  // Return bad request status for unknown strategies
+       }
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return  // Return internal server error status if retrieval fails
+   }
+
+   comparisons := make([]Comparison, len(strategies))
+   for i, strategy := range strategies {
+       opts := req.Options()
+       opts.Strategy = strategy
+
+       comparisons[i] = Comparison{Strategy: strategy}
+
+       result, err := Calculate(packs, req.Items, opts)
+       if err != nil {
+           comparisons[i].Error = err.Error()
+           continue
+       }
+
+       comparisons[i].TotalItems = result.TotalItems
+       comparisons[i].TotalPacks = result.TotalPacks
+       comparisons[i].Overshipment = max(result.TotalItems-req.Items, 0)  // Partial fills never overship
+       comparisons[i].Packs = result.Packs
+   }
+
+   ctx.JSON(http.StatusOK, comparisons)  // Return one comparison per strategy with OK status
+}
+
+// bindBatch binds a batch request and loads the catalog, writing an error response on failure.
+func bindBatch(ctx *gin.Context) (BatchRequest, []Pack, bool) {
+   var req BatchRequest
+
+   if err := ctx.ShouldBindJSON(&req); err != nil {
+       ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "errors": bindingErrors(err)})
+       return req, nil, false  // Return bad request status listing every invalid field if binding fails
+   }
+
+   packs, err := tracedStore(ctx).GetAllPacks(ListOptions{})
+   if err != nil {
+       ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+       return req, nil, false  // Return internal server error status if retrieval fails
+   }
+
+   return req, packs, true
+}
+
+// calculateOrder computes a single batch entry within the time budget, recording
+// failures on the entry.
+func calculateOrder(ctx context.Context, packs []Pack, items int, opts CalculateOptions) BatchEntry {
+   entry := BatchEntry{Items: items, Status: http.StatusOK}
+
+   if items > maxItems() {
+       entry.Status = http.StatusBadRequest
+       entry.Error = "items must not exceed " + strconv.Itoa(maxItems())
+       return entry
+   }
+
+   result, err := calculateWithin(ctx, packs, items, opts)
+   if err != nil {
+       entry.Status = calculateStatus(err)
+       entry.Error = err.Error()
+       return entry
+   }
+
+   result.Unit = unitLabel()
+   result.TotalCost = totalCost(result.Packs, packs)
+   result.Utilization = utilization(items, result.TotalItems)
+   entry.Result = &result
+   return entry
+}
+
+// calculateBatch handles POST requests to calculate several orders against the catalog.
+// When any order fails the response is 207 Multi-Status, each entry carrying its own status.
+func calculateBatch(ctx *gin.Context) {
+   req, packs, ok := bindBatch(ctx)
+   if !ok {
+       return
+   }
+
+   status := http.StatusOK
+   entries := make([]BatchEntry, len(req.Orders))
+   for i, items := range req.Orders {
+       entries[i] = calculateOrder(ctx.Request.Context(), packs, items, req.Options())
+       if entries[i].Error != "" {
+           status = http.StatusMultiStatus
+       }
+   }
+
+   ctx.JSON(status, entries)  // Return one entry per order, with multi-status if any failed
+}
+
+// streamBatch handles POST requests to calculate several orders, writing each result
+// as a JSON line and flushing it as soon as it is computed instead of buffering the batch.
+func streamBatch(ctx *gin.Context) {
+   req, packs, ok := bindBatch(ctx)
+   if !ok {
+       return
+   }
+
+   ctx.Header("Content-Type", "application/x-ndjson")
+
+   next := 0
+   ctx.Stream(func(w io.Writer) bool {
+       if next >= len(req.Orders) {
+           return false  // Close the stream once every order is written
+       }
+
+       json.NewEncoder(w).Encode(calculateOrder(ctx.Request.Context(), packs, req.Orders[next], req.Options()))
+       next++
+
+       return next < len(req.Orders)
+   })
+}
+
+// main is the entry point of the application.
+func main() {
+     strategy, err := loadDefaultStrategy()  // Validate configuration before connecting.
+     if err != nil {
+         log.Fatal(err)
+     }
+     defaultStrategy = strategy
+     algorithm, err := loadDefaultAlgorithm()  // Pick the packing algorithm from ALGO.
+     if err != nil {
+         log.Fatal(err)
+     }
+     defaultAlgorithm = algorithm
+     scheme, err := loadIDScheme()  // Pick the format of new pack IDs from ID_SCHEME.
+     if err != nil {
+         log.Fatal(err)
+     }
+     idScheme = scheme
+     tolerance, err := loadFloatTolerance()  // Compare weights within FLOAT_TOLERANCE.
+     if err != nil {
+         log.Fatal(err)
+     }
+     floatTolerance = tolerance
+     readOnly.Store(os.Getenv("READ_ONLY") == "true")  // Start in maintenance mode when READ_ONLY=true.
+     envelopeResponses = os.Getenv("RESPONSE_ENVELOPE") == "true"  // Wrap JSON responses when RESPONSE_ENVELOPE=true.
+     cache, err := loadCalculationCache()  // Size the calculation cache from CACHE_SIZE and CACHE_TTL.
+     if err != nil {
+         log.Fatal(err)
+     }
+     calculationCache = cache
+     limiter, err := loadCalculationLimiter()  // Cap concurrent calculations from MAX_CONCURRENT_CALCULATIONS.
+     if err != nil {
+         log.Fatal(err)
+     }
+     calculationLimiter = limiter
+     proxies, err := loadTrustedProxies()  // Only believe X-Forwarded-For from TRUSTED_PROXIES.
+     if err != nil {
+         log.Fatal(err)
+     }
+     trustedProxies = proxies
+
+     shutdownTracing, err := initTracing(context.Background())  // Export spans when OTEL_EXPORTER_OTLP_ENDPOINT is set.
+     if err != nil {
+         log.Fatal(err)
+     }
+     defer shutdownTracing(context.Background())
+
+     db, err := InitDatabase()     // Connect to MongoDB before serving requests.
+     if err != nil {
+         log.Fatal(err)
+     }
+     database = db
+     if err := db.indexSizes(); err != nil {
+         log.Fatalf("Unable to index pack sizes: %s", err)  // Refuse to start when sizes can't be kept unique.
+     }
+     if err := importPacksFile(database); err != nil {
+         log.Fatalf("Unable to import packs file: %s", err)  // Refuse to start with an invalid catalog file.
+     }
+     logCatalog(database)           // Show operators the catalog the server starts with.
+     logCoverageWarnings(database)  // Warn about catalogs that leave many orders unfillable exactly.
      r := InitRouter()             // Initialize HTTP router with routes and middleware setup.
-     r.Run(":8080")                // Start listening on port 8080 for incoming requests.
+     r.Run(listenAddr)             // Start listening on port 8080 for incoming requests.
 }
\ No newline at end of file
@@ -1,10 +1,25 @@
 package main
 
 import (
+    "bufio"
+    "bytes"
     "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "reflect"
+    "strconv"
+    "strings"
     "testing"
     "time"
 
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+
     "github.com/testcontainers/testcontainers-go"
     "github.com/testcontainers/testcontainers-go/wait"
     "go.mongodb.org/mongo-driver/bson"
@@ -33,13 +48,7 @@ func RunMongo(ctx context.Context, t *testing.T) testcontainers.Container {
     return mongoContainer
 }
 
-func TestDatabase(t *testing.T) {
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-    defer cancel()
-
-    mongoContainer := RunMongo(ctx, t)
-    defer mongoContainer.Terminate(ctx)
-
+func ConnectMongo(ctx context.Context, t *testing.T, mongoContainer testcontainers.Container) *mongo.Client {
     host, err := mongoContainer.Host(ctx)
     if err != nil {
         t.Fatalf("Failed to get container host: %v", err)
@@ -58,12 +67,25 @@ func TestDatabase(t *testing.T) {
     if err != nil {
         t.Fatalf("Failed to connect to MongoDB: %v", err)
     }
+
+    return client
+}
+
+func TestDatabase(t *testing.T) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    mongoContainer := RunMongo(ctx, t)
+    defer mongoContainer.Terminate(ctx)
+
+    client := ConnectMongo(ctx, t, mongoContainer)
     
     collection := client.Database("packsdb").Collection("packs")
-    db := Database{client: client, collection: collection}
+    db := Database{client: client, collection: collection, audit: client.Database("packsdb").Collection("audit")}
 
     // Clean up before tests
     collection.DeleteMany(ctx, bson.M{})
+    db.audit.DeleteMany(ctx, bson.M{})
 
     // Test CreatePack
     pack := Pack{Size: 10}
@@ -77,7 +99,7 @@ func TestDatabase(t *testing.T) {
     }
 
     // Test GetAllPacks
-    packs, err := db.GetAllPacks()
+    packs, err := db.GetAllPacks(ListOptions{})
     if err != nil {
         t.Fatalf("Failed to get all packs: %v", err)
     }
@@ -107,15 +129,2053 @@ func TestDatabase(t *testing.T) {
         t.Errorf("Expected updated size 20, got %d", updatedPack.Size)
     }
 
+    // Test PackHistory
+    createdPack.Size = 30
+    db.UpdatePack(createdPack)
+
+    history, err := db.PackHistory(createdPack.ID)
+    if err != nil || len(history) != 3 || history[0].Size != 10 || history[1].Size != 20 || history[2].Size != 30 {
+        t.Errorf("Expected a history of sizes 10, 20 and 30, got %+v %v", history, err)
+    }
+
     // Test DeletePack
     err = db.DeletePack(createdPack.ID)
     if err != nil {
         t.Fatalf("Failed to delete pack: %v", err)
     }
 
-    packsAfterDelete, _ := db.GetAllPacks()
+    packsAfterDelete, _ := db.GetAllPacks(ListOptions{})
     
     if len(packsAfterDelete) != 0 {
         t.Errorf("Expected 0 packs after deletion, got %d", len(packsAfterDelete))
    }
-}
\ No newline at end of file
+
+    // Test DeletePacksBySize
+    db.CreatePack(Pack{Size: 250})
+    db.CreatePack(Pack{Size: 500})
+
+    deleted, err := db.DeletePacksBySize([]int{250, 750})
+    if err != nil || deleted != 1 {
+        t.Errorf("Expected 1 pack deleted by size, got %d %v", deleted, err)
+    }
+}
+
+func TestDatabaseIDGenerator(t *testing.T) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    mongoContainer := RunMongo(ctx, t)
+    defer mongoContainer.Terminate(ctx)
+
+    client := ConnectMongo(ctx, t, mongoContainer)
+
+    collection := client.Database("packsdb").Collection("packs")
+    collection.DeleteMany(ctx, bson.M{})
+
+    // Use a fake generator so the created ID is predictable
+    next := 0
+    db := Database{client: client, collection: collection, audit: client.Database("packsdb").Collection("audit"), newID: func() string {
+        next++
+        return fmt.Sprintf("pack-%d", next)
+    }}
+
+    createdPack, err := db.CreatePack(Pack{Size: 250})
+    if err != nil {
+        t.Fatalf("Failed to create pack: %v", err)
+    }
+
+    if createdPack.ID != "pack-1" {
+        t.Errorf("Expected pack ID pack-1, got %s", createdPack.ID)
+    }
+
+    retrievedPack, err := db.GetPack("pack-1")
+    if err != nil {
+        t.Fatalf("Failed to get pack: %v", err)
+    }
+
+    if retrievedPack.Size != 250 {
+        t.Errorf("Expected size 250, got %d", retrievedPack.Size)
+    }
+}
+
+func TestPackTimestamps(t *testing.T) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    mongoContainer := RunMongo(ctx, t)
+    defer mongoContainer.Terminate(ctx)
+
+    client := ConnectMongo(ctx, t, mongoContainer)
+
+    collection := client.Database("packsdb").Collection("packs")
+    collection.DeleteMany(ctx, bson.M{})
+
+    db := Database{client: client, collection: collection, audit: client.Database("packsdb").Collection("audit")}
+
+    first, err := db.CreatePack(Pack{Size: 250})
+    if err != nil {
+        t.Fatalf("Failed to create pack: %v", err)
+    }
+
+    if first.CreatedAt.IsZero() || !first.UpdatedAt.Equal(first.CreatedAt) {
+        t.Errorf("Expected matching creation timestamps, got %v and %v", first.CreatedAt, first.UpdatedAt)
+    }
+
+    time.Sleep(5 * time.Millisecond)
+
+    second, err := db.CreatePack(Pack{Size: 500})
+    if err != nil {
+        t.Fatalf("Failed to create pack: %v", err)
+    }
+
+    time.Sleep(5 * time.Millisecond)
+
+    // Updating must keep the original creation time
+    first.Size = 300
+    updated, err := db.UpdatePack(first)
+    if err != nil {
+        t.Fatalf("Failed to update pack: %v", err)
+    }
+
+    if !updated.CreatedAt.Equal(first.CreatedAt.Truncate(time.Millisecond)) {
+        t.Errorf("Expected created time %v to be preserved, got %v", first.CreatedAt, updated.CreatedAt)
+    }
+
+    if !updated.UpdatedAt.After(updated.CreatedAt) {
+        t.Errorf("Expected updated time after created time, got %v", updated.UpdatedAt)
+    }
+
+    packs, err := db.GetAllPacks(ListOptions{Sort: "created_desc"})
+    if err != nil {
+        t.Fatalf("Failed to get all packs: %v", err)
+    }
+
+    if len(packs) != 2 || packs[0].ID != second.ID || packs[1].ID != first.ID {
+        t.Errorf("Expected newest pack first, got %+v", packs)
+    }
+
+    // Without a sort the largest pack comes first
+    packs, err = db.GetAllPacks(ListOptions{})
+    if err != nil {
+        t.Fatalf("Failed to get all packs: %v", err)
+    }
+
+    if len(packs) != 2 || packs[0].Size != 500 || packs[1].Size != 300 {
+        t.Errorf("Expected the largest pack first, got %+v", packs)
+    }
+}
+
+// newTestServer returns a router backed by a fresh MemoryStore, so handler
+// tests run without Docker or MongoDB. The cleanup func restores the previous store.
+func newTestServer(t *testing.T) (*gin.Engine, func()) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+
+    previous := database
+    database = NewMemoryStore()
+
+    return InitRouter(), func() { database = previous }
+}
+
+// performRequest sends a request with an optional JSON body through the router.
+func performRequest(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    rec := httptest.NewRecorder()
+
+    router.ServeHTTP(rec, req)
+
+    return rec
+}
+
+func TestPackHandlers(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    // Test POST /packs
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": 10}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200 on create, got %d", rec.Code)
+    }
+
+    var createdPack Pack
+    if err := json.Unmarshal(rec.Body.Bytes(), &createdPack); err != nil {
+        t.Fatalf("Failed to decode created pack: %v", err)
+    }
+
+    if createdPack.ID == "" {
+        t.Error("Expected a valid ID for the created pack")
+    }
+
+    // Test GET /packs
+    rec = performRequest(router, http.MethodGet, "/packs", "")
+
+    var packs []Pack
+    if err := json.Unmarshal(rec.Body.Bytes(), &packs); err != nil {
+        t.Fatalf("Failed to decode packs: %v", err)
+    }
+
+    if len(packs) != 1 {
+        t.Errorf("Expected 1 pack, got %d", len(packs))
+    }
+
+    // Test GET /packs/:id
+    rec = performRequest(router, http.MethodGet, "/packs/"+createdPack.ID, "")
+
+    var retrievedPack Pack
+    json.Unmarshal(rec.Body.Bytes(), &retrievedPack)
+
+    if retrievedPack.ID != createdPack.ID {
+        t.Errorf("Expected pack ID %s, got %s", createdPack.ID, retrievedPack.ID)
+    }
+
+    // Test PUT /packs/:id
+    rec = performRequest(router, http.MethodPut, "/packs/"+createdPack.ID, `{"size": 20}`)
+
+    var updatedPack Pack
+    json.Unmarshal(rec.Body.Bytes(), &updatedPack)
+
+    if updatedPack.Size != 20 {
+        t.Errorf("Expected updated size 20, got %d", updatedPack.Size)
+    }
+
+    // Test DELETE /packs/:id
+    rec = performRequest(router, http.MethodDelete, "/packs/"+createdPack.ID, "")
+    if rec.Code != http.StatusNoContent {
+        t.Errorf("Expected status 204 on delete, got %d", rec.Code)
+    }
+
+    rec = performRequest(router, http.MethodGet, "/packs/"+createdPack.ID, "")
+    if rec.Code != http.StatusNotFound {
+        t.Errorf("Expected status 404 after deletion, got %d", rec.Code)
+    }
+}
+
+func TestMalformedPackID(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    routes := []struct {
+        method string
+        body   string
+    }{
+        {http.MethodGet, ""},
+        {http.MethodPut, `{"size": 10}`},
+        {http.MethodDelete, ""},
+    }
+
+    for _, route := range routes {
+        rec := performRequest(router, route.method, "/packs/not-a-uuid", route.body)
+
+        if rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", route.method, rec.Code)
+        }
+
+        if !strings.Contains(rec.Body.String(), "not a valid UUID") {
+            t.Errorf("%s: expected invalid UUID message, got %s", route.method, rec.Body.String())
+        }
+    }
+}
+
+func TestCalculateHugeTolerance(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251, "packs": [250, 500], "maxOvershipPercent": 1e300}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if rec.Code != http.StatusOK || result.TotalItems != 500 {
+        t.Errorf("Expected 500 items with a huge tolerance, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestCalculateHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 501}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", rec.Code)
+    }
+
+    var result Result
+    if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+        t.Fatalf("Failed to decode result: %v", err)
+    }
+
+    if result.TotalItems != 750 || result.TotalPacks != 2 {
+        t.Errorf("Expected 750 items in 2 packs, got %+v", result)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": -1}`)
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for negative items, got %d", rec.Code)
+    }
+}
+
+func TestCalculateCombinedHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    rec := performRequest(router, http.MethodPost, "/calculate/combined",
+        `{"depots": {"north": [250], "south": [1000]}, "items": 1250}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", rec.Code)
+    }
+
+    var result Result
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    expected := []PackQuantity{{Pack: 1000, Quantity: 1, Depot: "south"}, {Pack: 250, Quantity: 1, Depot: "north"}}
+    if fmt.Sprint(result.Packs) != fmt.Sprint(expected) {
+        t.Errorf("Expected %v, got %v", expected, result.Packs)
+    }
+
+    for _, body := range []string{
+        `{"depots": {"north": [250], "south": [50000000]}, "items": 1250}`,
+        `{"depots": {"north": [250, 250]}, "items": 1250}`,
+        `{"depots": {"north": [0]}, "items": 1250}`,
+    } {
+        if rec := performRequest(router, http.MethodPost, "/calculate/combined", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+}
+
+// streamRecorder adds the http.CloseNotifier that gin's streaming responses require.
+type streamRecorder struct {
+    *httptest.ResponseRecorder
+}
+
+func (streamRecorder) CloseNotify() <-chan bool {
+    return make(chan bool)
+}
+
+func TestCalculateBatchHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500}`)
+
+    rec := performRequest(router, http.MethodPost, "/calculate/batch", `{"orders": [1, 501]}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200 when every order succeeds, got %d", rec.Code)
+    }
+
+    // A mixed batch reports each order's own status under 207 Multi-Status
+    rec = performRequest(router, http.MethodPost, "/calculate/batch", `{"orders": [1, 501, -1, 2000000]}`)
+    if rec.Code != http.StatusMultiStatus {
+        t.Fatalf("Expected status 207, got %d", rec.Code)
+    }
+
+    var entries []BatchEntry
+    json.Unmarshal(rec.Body.Bytes(), &entries)
+
+    if len(entries) != 4 || entries[1].Result.TotalItems != 750 || entries[2].Error == "" {
+        t.Fatalf("Unexpected batch entries: %+v", entries)
+    }
+
+    for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusBadRequest, http.StatusBadRequest} {
+        if entries[i].Status != expected {
+            t.Errorf("Entry %d: expected status %d, got %+v", i, expected, entries[i])
+        }
+    }
+
+    // With no packs every order is unprocessable
+    database.DeletePacksBySize([]int{250, 500})
+    rec = performRequest(router, http.MethodPost, "/calculate/batch", `{"orders": [1]}`)
+    json.Unmarshal(rec.Body.Bytes(), &entries)
+
+    if rec.Code != http.StatusMultiStatus || len(entries) != 1 || entries[0].Status != http.StatusUnprocessableEntity {
+        t.Errorf("Expected a 422 entry under 207, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestStreamBatchHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500}`)
+
+    orders := []int{1, 250, 251, 501, 1000}
+    body, _ := json.Marshal(BatchRequest{Orders: orders})
+
+    req := httptest.NewRequest(http.MethodPost, "/calculate/batch/stream", strings.NewReader(string(body)))
+    req.Header.Set("Content-Type", "application/json")
+    rec := streamRecorder{httptest.NewRecorder()}
+
+    router.ServeHTTP(rec, req)
+
+    if contentType := rec.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+        t.Errorf("Expected application/x-ndjson, got %s", contentType)
+    }
+
+    // Read the stream line by line, expecting one result per order in order
+    scanner := bufio.NewScanner(rec.Body)
+    lines := 0
+    for scanner.Scan() {
+        var entry BatchEntry
+        if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+            t.Fatalf("Failed to decode line %d: %v", lines, err)
+        }
+
+        if lines >= len(orders) || entry.Items != orders[lines] || entry.Result == nil {
+            t.Errorf("Unexpected entry on line %d: %+v", lines, entry)
+        }
+        lines++
+    }
+
+    if lines != len(orders) {
+        t.Errorf("Expected %d lines, got %d", len(orders), lines)
+    }
+}
+
+func TestDuplicatePackSize(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    if rec.Code != http.StatusConflict {
+        t.Errorf("Expected status 409 for a duplicate size, got %d", rec.Code)
+    }
+
+    if !strings.Contains(rec.Body.String(), "pack size already exists") {
+        t.Errorf("Expected duplicate size message, got %s", rec.Body.String())
+    }
+
+    // Resizing a pack to a size another pack has conflicts too, keeping its own size doesn't
+    var pack Pack
+    json.Unmarshal(performRequest(router, http.MethodPost, "/packs", `{"size": 500}`).Body.Bytes(), &pack)
+
+    if rec := performRequest(router, http.MethodPut, "/packs/"+pack.ID, `{"size": 250}`); rec.Code != http.StatusConflict {
+        t.Errorf("Expected status 409 when resizing to a taken size, got %d", rec.Code)
+    }
+
+    if rec := performRequest(router, http.MethodPut, "/packs/"+pack.ID, `{"size": 500, "cost": 2}`); rec.Code != http.StatusOK {
+        t.Errorf("Expected status 200 when keeping the size, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestPackSizeUnmarshal(t *testing.T) {
+    valid := map[string]PackSize{
+        `500`:       500,
+        `"500"`:     500,
+        `"500 "`:    500,
+        `"  42\t"`:  42,
+    }
+
+    for input, expected := range valid {
+        var size PackSize
+        if err := json.Unmarshal([]byte(input), &size); err != nil || size != expected {
+            t.Errorf("Unmarshal(%s): expected %d, got %d (%v)", input, expected, size, err)
+        }
+    }
+
+    for _, input := range []string{`"abc"`, `"5OO"`, `12.5`, `"12.5"`, `true`, `""`} {
+        var size PackSize
+        if err := json.Unmarshal([]byte(input), &size); err == nil {
+            t.Errorf("Unmarshal(%s): expected an error, got %d", input, size)
+        }
+    }
+}
+
+func TestPostPackCoercesSize(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": "500 "}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200 for a padded quoted size, got %d", rec.Code)
+    }
+
+    var pack Pack
+    json.Unmarshal(rec.Body.Bytes(), &pack)
+
+    if pack.Size != 500 {
+        t.Errorf("Expected size 500, got %d", pack.Size)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/packs", `{"size": "lots"}`)
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for a non-numeric size, got %d", rec.Code)
+    }
+}
+
+func TestDefaultStrategyFromEnv(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    t.Setenv("DEFAULT_STRATEGY", "fewest_packs")
+    strategy, err := loadDefaultStrategy()
+    if err != nil {
+        t.Fatalf("Failed to load default strategy: %v", err)
+    }
+
+    previous := defaultStrategy
+    defaultStrategy = strategy
+    defer func() { defaultStrategy = previous }()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    // Without a strategy in the body the env default applies
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 501}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if result.TotalItems != 1000 || result.TotalPacks != 1 {
+        t.Errorf("Expected the fewest_packs default to ship 1000 items in 1 pack, got %+v", result)
+    }
+
+    // An explicit strategy still overrides the default
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": 501, "strategy": "balanced"}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if result.TotalItems != 750 {
+        t.Errorf("Expected the balanced strategy to ship 750 items, got %+v", result)
+    }
+
+    t.Setenv("DEFAULT_STRATEGY", "cheapest")
+    if _, err := loadDefaultStrategy(); err == nil {
+        t.Error("Expected an error for an invalid DEFAULT_STRATEGY")
+    }
+}
+
+func TestPackTags(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250, "tags": ["fragile"]}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500, "tags": ["fragile", "bulk"]}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 1000, "tags": ["bulk"]}`)
+
+    // Test GET /packs?tag=fragile
+    var packs []Pack
+    rec := performRequest(router, http.MethodGet, "/packs?tag=fragile", "")
+    json.Unmarshal(rec.Body.Bytes(), &packs)
+
+    if len(packs) != 2 || packs[0].Size != 500 || packs[1].Size != 250 {
+        t.Errorf("Expected the 500 and 250 packs for tag fragile, got %+v", packs)
+    }
+
+    // Test POST /calculate restricted to a tag: without 1000, 900 needs two 500s
+    var result Result
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": 900, "tag": "fragile"}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    expected := []PackQuantity{{Pack: 500, Quantity: 2}}
+    if fmt.Sprint(result.Packs) != fmt.Sprint(expected) {
+        t.Errorf("Expected %v for tag fragile, got %v", expected, result.Packs)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": 900, "tag": "bulk"}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    expected = []PackQuantity{{Pack: 1000, Quantity: 1}}
+    if fmt.Sprint(result.Packs) != fmt.Sprint(expected) {
+        t.Errorf("Expected %v for tag bulk, got %v", expected, result.Packs)
+    }
+}
+
+func TestGetPacksPagination(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for size := 1; size <= 7; size++ {
+        performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size*100))
+    }
+
+    offset := func(n int) *int { return &n }
+
+    tests := []struct {
+        query string
+        sizes []int
+        page  PageInfo
+    }{
+        {"limit=3", []int{700, 600, 500}, PageInfo{Limit: 3, Offset: 0, Total: 7, NextOffset: offset(3)}},
+        {"limit=3&offset=3", []int{400, 300, 200}, PageInfo{Limit: 3, Offset: 3, Total: 7, NextOffset: offset(6), PrevOffset: offset(0)}},
+        {"limit=3&offset=6", []int{100}, PageInfo{Limit: 3, Offset: 6, Total: 7, PrevOffset: offset(3)}},
+        {"limit=3&offset=2", []int{500, 400, 300}, PageInfo{Limit: 3, Offset: 2, Total: 7, NextOffset: offset(5), PrevOffset: offset(0)}},
+        {"limit=3&offset=20", []int{}, PageInfo{Limit: 3, Offset: 20, Total: 7, PrevOffset: offset(4)}},
+        {"offset=5", []int{200, 100}, PageInfo{Limit: defaultPageLimit, Offset: 5, Total: 7, PrevOffset: offset(0)}},
+    }
+
+    for _, test := range tests {
+        rec := performRequest(router, http.MethodGet, "/packs?"+test.query, "")
+
+        var page PackPage
+        json.Unmarshal(rec.Body.Bytes(), &page)
+
+        sizes := []int{}
+        for _, pack := range page.Data {
+            sizes = append(sizes, pack.Size)
+        }
+
+        if rec.Code != http.StatusOK || !reflect.DeepEqual(sizes, test.sizes) || !reflect.DeepEqual(page.Page, test.page) {
+            t.Errorf("%s: expected %v on %+v, got %d %s", test.query, test.sizes, test.page, rec.Code, rec.Body.String())
+        }
+    }
+
+    // The ends of the list have null links
+    body := performRequest(router, http.MethodGet, "/packs?limit=7", "").Body.String()
+    if !strings.Contains(body, `"nextOffset":null`) || !strings.Contains(body, `"prevOffset":null`) {
+        t.Errorf("Expected null links on a single page, got %s", body)
+    }
+
+    // Without page parameters the bare list is returned
+    var packs []Pack
+    rec := performRequest(router, http.MethodGet, "/packs", "")
+    if err := json.Unmarshal(rec.Body.Bytes(), &packs); err != nil || len(packs) != 7 {
+        t.Errorf("Expected the bare list of 7 packs, got %s", rec.Body.String())
+    }
+
+    for _, query := range []string{"limit=0", "limit=1001", "limit=x", "offset=-1", "offset=x"} {
+        if rec := performRequest(router, http.MethodGet, "/packs?"+query, ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+        }
+    }
+}
+
+func TestGetPacksFields(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250, "weight": 1.5}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500}`)
+
+    tests := []struct {
+        query    string
+        expected string
+    }{
+        {"fields=size", `[{"size":500},{"size":250}]`},
+        {"fields=size,weight", `[{"size":500,"weight":0},{"size":250,"weight":1.5}]`},
+        {"fields=size&fields=size", `[{"size":500},{"size":250}]`},
+        {"fields=size&limit=1&offset=1", `{"data":[{"size":250}],"page":{"limit":1,"offset":1,"total":2,"nextOffset":null,"prevOffset":0}}`},
+    }
+
+    for _, test := range tests {
+        rec := performRequest(router, http.MethodGet, "/packs?"+test.query, "")
+        if rec.Code != http.StatusOK || rec.Body.String() != test.expected {
+            t.Errorf("%s: expected %s, got %d %s", test.query, test.expected, rec.Code, rec.Body.String())
+        }
+    }
+
+    for _, query := range []string{"fields=colour", "fields=size,", "fields=Size", "fields="} {
+        if rec := performRequest(router, http.MethodGet, "/packs?"+query, ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d %s", query, rec.Code, rec.Body.String())
+        }
+    }
+}
+
+func TestCompareStrategiesHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    rec := performRequest(router, http.MethodPost, "/calculate/compare", `{"items": 501}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", rec.Code)
+    }
+
+    var comparisons []Comparison
+    json.Unmarshal(rec.Body.Bytes(), &comparisons)
+
+    if len(comparisons) != len(Strategies) {
+        t.Fatalf("Expected one comparison per strategy, got %+v", comparisons)
+    }
+
+    expected := map[string][3]int{
+        StrategyBalanced:    {750, 2, 249},
+        StrategyFewestPacks: {1000, 1, 499},
+    }
+
+    for _, comparison := range comparisons {
+        figures := [3]int{comparison.TotalItems, comparison.TotalPacks, comparison.Overshipment}
+        if figures != expected[comparison.Strategy] {
+            t.Errorf("%s: expected items, packs and overshipment %v, got %v", comparison.Strategy, expected[comparison.Strategy], figures)
+        }
+    }
+
+    rec = performRequest(router, http.MethodPost, "/calculate/compare", `{"items": 501, "strategies": ["cheapest"]}`)
+    if rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for an unknown strategy, got %d", rec.Code)
+    }
+}
+
+func TestValidatePacksHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    tests := []struct {
+        body     string
+        valid    bool
+        warnings int
+        errors   int
+    }{
+        {`{"sizes": [250, 499, 1000]}`, true, 0, 0},
+        {`{"sizes": [250, 500, 1000]}`, true, 1, 0},  // gcd 250 leaves most orders unfillable exactly
+        {`{"sizes": [250, 250, -1]}`, false, 0, 2},
+        {`{"sizes": []}`, false, 0, 1},
+    }
+
+    for _, test := range tests {
+        rec := performRequest(router, http.MethodPost, "/packs/validate", test.body)
+        if rec.Code != http.StatusOK {
+            t.Fatalf("%s: expected status 200, got %d", test.body, rec.Code)
+        }
+
+        var response ValidateResponse
+        json.Unmarshal(rec.Body.Bytes(), &response)
+
+        if response.Valid != test.valid || len(response.Warnings) != test.warnings || len(response.Errors) != test.errors {
+            t.Errorf("%s: unexpected response %+v", test.body, response)
+        }
+    }
+
+    // Validation never persists the proposed sizes
+    rec := performRequest(router, http.MethodGet, "/packs", "")
+    if body := rec.Body.String(); body != "[]" && body != "null" {
+        t.Errorf("Expected an empty catalog after validation, got %s", body)
+    }
+}
+
+func TestCalculateUnitLabel(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 6}`)
+
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 6}`)
+    if strings.Contains(rec.Body.String(), `"unit"`) {
+        t.Errorf("Expected no unit without UNIT_LABEL, got %s", rec.Body.String())
+    }
+
+    t.Setenv("UNIT_LABEL", "cans")
+
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": 6}`)
+    if !strings.Contains(rec.Body.String(), `"unit":"cans"`) {
+        t.Errorf("Expected unit cans in the response, got %s", rec.Body.String())
+    }
+}
+
+func TestCalculateImpactHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    var pack Pack
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    json.Unmarshal(rec.Body.Bytes(), &pack)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 1000}`)
+
+    // 600 is 3x250 today; resizing 250 to 300 makes it 2x300
+    rec = performRequest(router, http.MethodPost, "/packs/"+pack.ID+"/calculate-impact", `{"size": 300, "items": 600}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    var impact ImpactResponse
+    json.Unmarshal(rec.Body.Bytes(), &impact)
+
+    if impact.Before.TotalItems != 750 || impact.After.TotalItems != 600 {
+        t.Errorf("Expected 750 items before and 600 after, got %d and %d", impact.Before.TotalItems, impact.After.TotalItems)
+    }
+
+    expected := []PackDelta{{Pack: 300, Before: 0, After: 2}, {Pack: 250, Before: 3, After: 0}}
+    if fmt.Sprint(impact.Diff) != fmt.Sprint(expected) {
+        t.Errorf("Expected diff %v, got %v", expected, impact.Diff)
+    }
+
+    // The catalog itself is unchanged
+    rec = performRequest(router, http.MethodGet, "/packs/"+pack.ID, "")
+    json.Unmarshal(rec.Body.Bytes(), &pack)
+
+    if pack.Size != 250 {
+        t.Errorf("Expected the pack to keep size 250, got %d", pack.Size)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/packs/"+uuid.NewString()+"/calculate-impact", `{"size": 300, "items": 600}`)
+    if rec.Code != http.StatusNotFound {
+        t.Errorf("Expected status 404 for an unknown pack, got %d", rec.Code)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/packs/"+pack.ID+"/calculate-impact", `{"size": 40000000, "items": 600}`)
+    if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "largest pack size") {
+        t.Errorf("Expected status 400 for an oversized pack, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    // Both calculations are held to CALCULATION_TIMEOUT, falling back to greedy breakdowns
+    release := make(chan struct{})
+    defer close(release)
+
+    previous := exactCalculate
+    defer func() { exactCalculate = previous }()
+    exactCalculate = func(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+        <-release
+        return Result{}, nil
+    }
+
+    t.Setenv("CALCULATION_TIMEOUT", "20ms")
+
+    rec = performRequest(router, http.MethodPost, "/packs/"+pack.ID+"/calculate-impact", `{"size": 300, "items": 600}`)
+    impact = ImpactResponse{}
+    json.Unmarshal(rec.Body.Bytes(), &impact)
+
+    if rec.Code != http.StatusOK || !impact.Before.Approximate || !impact.After.Approximate {
+        t.Errorf("Expected approximate breakdowns once the timeout passes, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestCalculateHandlerEmptyOrder(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 0}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", rec.Code)
+    }
+
+    if body := rec.Body.String(); body != `{"packs":[],"totalItems":0,"totalPacks":0}` {
+        t.Errorf("Unexpected body for an empty order: %s", body)
+    }
+}
+
+func TestMongoURI(t *testing.T) {
+    tests := []struct {
+        env      map[string]string
+        expected string
+    }{
+        {map[string]string{"MONGO_URL": "mongodb://root:secret@db:27017/"}, "mongodb://root:secret@db:27017/"},
+        {map[string]string{}, "mongodb://localhost:27017/"},
+        {map[string]string{"MONGO_HOST": "db", "MONGO_PORT": "27018"}, "mongodb://db:27018/"},
+        {
+            map[string]string{"MONGO_HOST": "db", "MONGO_USER": "root", "MONGO_PASS": "p@ss:w/rd%", "MONGO_AUTHDB": "admin"},
+            "mongodb://root:p%40ss%3Aw%2Frd%25@db:27017/?authSource=admin",
+        },
+    }
+
+    for _, test := range tests {
+        for _, key := range []string{"MONGO_URL", "MONGO_HOST", "MONGO_PORT", "MONGO_USER", "MONGO_PASS", "MONGO_AUTHDB"} {
+            t.Setenv(key, test.env[key])
+        }
+
+        if uri := mongoURI(); uri != test.expected {
+            t.Errorf("Expected %s, got %s", test.expected, uri)
+        }
+    }
+}
+
+func TestValidateMongoURI(t *testing.T) {
+    tests := []struct {
+        uri      string
+        expected string // Start of the error, empty for a valid URI
+    }{
+        {"mongodb://root:secret@db:27017/", ""},
+        {"mongodb+srv://cluster0.example.net/", ""},
+        {"mongodb://db1:27017,db2:27017/?replicaSet=rs0", ""},
+        {"", "MONGO_URL is empty"},
+        {"   ", "MONGO_URL is empty"},
+        {"localhost:27017", "MONGO_URL must start with mongodb:// or mongodb+srv://"}, // Missing scheme
+        {"http://db:27017/", "MONGO_URL must start with mongodb:// or mongodb+srv://"},
+        {"mongodb://", "MONGO_URL has no host"},
+        {"mongodb://root:secret@db:port/", "MONGO_URL is not a valid URL"},
+    }
+
+    for _, test := range tests {
+        err := validateMongoURI(test.uri)
+        if test.expected == "" {
+            if err != nil {
+                t.Errorf("validateMongoURI(%q): expected no error, got %v", test.uri, err)
+            }
+            continue
+        }
+
+        if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+            t.Errorf("validateMongoURI(%q): expected an error starting %q, got %v", test.uri, test.expected, err)
+            continue
+        }
+
+        if strings.Contains(err.Error(), "secret") {
+            t.Errorf("validateMongoURI(%q): expected the password to be masked, got %v", test.uri, err)
+        }
+    }
+
+    // InitDatabase refuses a malformed URL before handing it to the driver
+    t.Setenv("MONGO_URL", "localhost:27017")
+    if _, err := InitDatabase(); err == nil || !strings.Contains(err.Error(), "mongodb://") {
+        t.Errorf("Expected InitDatabase to describe the malformed MONGO_URL, got %v", err)
+    }
+}
+
+func TestInitDatabaseWithoutEnvFile(t *testing.T) {
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(t.TempDir()); err != nil { // No .env file here
+        t.Fatal(err)
+    }
+    defer os.Chdir(wd)
+
+    t.Setenv("MONGO_URL", "mongodb://db.example:27017/")
+    db, err := InitDatabase()
+    if err != nil {
+        t.Fatalf("Expected the environment to be used without a .env file, got %v", err)
+    }
+    defer db.client.Disconnect(context.Background())
+
+    if db.collection.Name() != packsCollection || db.audit.Name() != auditCollection {
+        t.Errorf("Expected the packs and audit collections, got %s and %s", db.collection.Name(), db.audit.Name())
+    }
+
+    // Settings that are missing or wrong still fail startup, with a clear error
+    t.Setenv("MONGO_URL", " ")
+    if _, err := InitDatabase(); err == nil || !strings.HasPrefix(err.Error(), "MONGO_URL is empty") {
+        t.Errorf("Expected an empty MONGO_URL to be reported, got %v", err)
+    }
+}
+
+func TestReadOnlyMode(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    var pack Pack
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    json.Unmarshal(rec.Body.Bytes(), &pack)
+
+    readOnly.Store(true)
+    defer readOnly.Store(false)
+
+    writes := []struct {
+        method string
+        path   string
+        body   string
+    }{
+        {http.MethodPost, "/packs", `{"size": 500}`},
+        {http.MethodPut, "/packs/" + pack.ID, `{"size": 300}`},
+        {http.MethodDelete, "/packs/" + pack.ID, ""},
+    }
+
+    for _, write := range writes {
+        rec := performRequest(router, write.method, write.path, write.body)
+        if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "read-only") {
+            t.Errorf("%s %s: expected status 503 with a read-only message, got %d %s", write.method, write.path, rec.Code, rec.Body.String())
+        }
+    }
+
+    reads := []struct {
+        method string
+        path   string
+        body   string
+    }{
+        {http.MethodGet, "/packs", ""},
+        {http.MethodGet, "/packs/" + pack.ID, ""},
+        {http.MethodPost, "/calculate", `{"items": 10}`},
+        {http.MethodPost, "/packs/validate", `{"sizes": [250]}`},
+        {http.MethodPost, "/packs/compare-waste", `{"catalogs": [[250], [500]], "orders": [250]}`},
+    }
+
+    for _, read := range reads {
+        if rec := performRequest(router, read.method, read.path, read.body); rec.Code != http.StatusOK {
+            t.Errorf("%s %s: expected status 200 in read-only mode, got %d", read.method, read.path, rec.Code)
+        }
+    }
+
+    // Leaving read-only mode allows writes again
+    readOnly.Store(false)
+    if rec := performRequest(router, http.MethodPost, "/packs", `{"size": 500}`); rec.Code != http.StatusOK {
+        t.Errorf("Expected writes to succeed after leaving read-only mode, got %d", rec.Code)
+    }
+}
+
+func TestCalculateAllSolutions(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []int{2, 3, 4} {
+        performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size))
+    }
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 6, "allSolutions": true}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", rec.Code)
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+        t.Fatalf("Failed to decode response: %v", err)
+    }
+
+    if len(result.Solutions) != 2 || result.TotalPacks != 2 {
+        t.Errorf("Expected the breakdown with 2 co-optimal solutions, got %+v", result)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": 6}`)
+    if strings.Contains(rec.Body.String(), "solutions") {
+        t.Errorf("Expected no solutions unless requested, got %s", rec.Body.String())
+    }
+}
+
+func TestSelfTestHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    rec := performRequest(router, http.MethodGet, "/selftest", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    var response struct {
+        Passed bool             `json:"passed"`
+        Cases  []SelfTestResult `json:"cases"`
+    }
+    json.Unmarshal(rec.Body.Bytes(), &response)
+
+    if !response.Passed || len(response.Cases) != len(selfTestCases) {
+        t.Errorf("Expected every self-test case to pass, got %+v", response)
+    }
+
+    // A fixture the calculation disagrees with fails the self-test
+    broken := []SelfTestCase{{"wrong breakdown", []int{250, 500}, 251, CalculateOptions{}, []PackQuantity{{Pack: 250, Quantity: 2}}}}
+    if results, passed := RunSelfTest(broken); passed || results[0].Passed {
+        t.Errorf("Expected a wrong fixture to fail, got %+v", results)
+    }
+}
+
+func TestCacheStats(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    previous := calculationCache
+    calculationCache = NewCalculationCache(10, time.Minute)
+    defer func() { calculationCache = previous }()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    stats := func() CacheStats {
+        var stats CacheStats
+        rec := performRequest(router, http.MethodGet, "/cache/stats", "")
+        json.Unmarshal(rec.Body.Bytes(), &stats)
+        return stats
+    }
+
+    if got := stats(); got.Hits != 0 || got.Misses != 0 || got.HitRatio != 0 {
+        t.Errorf("Expected empty stats, got %+v", got)
+    }
+
+    performRequest(router, http.MethodPost, "/calculate", `{"items": 1}`)   // Miss
+    performRequest(router, http.MethodPost, "/calculate", `{"items": 1}`)   // Hit
+    performRequest(router, http.MethodPost, "/calculate", `{"items": 1}`)   // Hit
+    performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`) // Miss
+
+    if got := stats(); got.Hits != 2 || got.Misses != 2 || got.HitRatio != 0.5 || got.Entries != 2 {
+        t.Errorf("Expected 2 hits and 2 misses, got %+v", got)
+    }
+
+    // A catalog change is a different key, so it misses rather than serving a stale breakdown
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500}`)
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`)
+    if !strings.Contains(rec.Body.String(), `"pack":500`) {
+        t.Errorf("Expected the new pack to be used, got %s", rec.Body.String())
+    }
+
+    if got := stats(); got.Misses != 3 {
+        t.Errorf("Expected a miss after the catalog changed, got %+v", got)
+    }
+}
+
+func TestDiffPacksHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500, "tags": ["fragile", "bulk"]}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 1000, "tags": ["bulk"]}`)
+
+    body := `{"packs": [
+        {"size": 250},
+        {"size": 500, "tags": ["bulk", "fragile"]},
+        {"size": 1000, "tags": ["fragile"]},
+        {"size": "2000"}
+    ]}`
+
+    rec := performRequest(router, http.MethodPost, "/packs/diff", body)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    var diff CatalogDiff
+    json.Unmarshal(rec.Body.Bytes(), &diff)
+
+    // 250 is unchanged and 500 only reorders its tags, so neither is reported
+    expected := CatalogDiff{
+        Added:   []int{2000},
+        Removed: []int{},
+        Changed: []PackChange{{Size: 1000, Before: []string{"bulk"}, After: []string{"fragile"}}},
+    }
+    if !reflect.DeepEqual(diff, expected) {
+        t.Errorf("Expected %+v, got %+v", expected, diff)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/packs/diff", `{"packs": [{"size": 250}]}`)
+    json.Unmarshal(rec.Body.Bytes(), &diff)
+    if !reflect.DeepEqual(diff.Removed, []int{1000, 500}) || len(diff.Added) != 0 || len(diff.Changed) != 0 {
+        t.Errorf("Expected 1000 and 500 to be removed, got %+v", diff)
+    }
+
+    if rec := performRequest(router, http.MethodPost, "/packs/diff", `{"packs": [{"size": -1}]}`); rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for an invalid size, got %d", rec.Code)
+    }
+
+    // Diffing never changes the catalog
+    rec = performRequest(router, http.MethodGet, "/packs", "")
+    var packs []Pack
+    json.Unmarshal(rec.Body.Bytes(), &packs)
+    if len(packs) != 3 {
+        t.Errorf("Expected the catalog to keep 3 packs, got %d", len(packs))
+    }
+}
+
+func TestBatchValidationErrors(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    rec := performRequest(router, http.MethodPost, "/calculate/batch", `{"mode": "approximate", "strategy": "cheapest", "maxOvershipPercent": -5}`)
+    if rec.Code != http.StatusBadRequest {
+        t.Fatalf("Expected status 400, got %d", rec.Code)
+    }
+
+    var response struct {
+        Error  string       `json:"error"`
+        Errors []FieldError `json:"errors"`
+    }
+    json.Unmarshal(rec.Body.Bytes(), &response)
+
+    expected := map[string]string{
+        "mode":               "oneof",
+        "strategy":           "oneof",
+        "maxOvershipPercent": "gte",
+        "orders":             "required",
+    }
+    if len(response.Errors) != len(expected) {
+        t.Fatalf("Expected %d field errors, got %+v", len(expected), response.Errors)
+    }
+    for _, fieldError := range response.Errors {
+        if expected[fieldError.Field] != fieldError.Rule || fieldError.Message == "" {
+            t.Errorf("Unexpected field error %+v", fieldError)
+        }
+    }
+
+    if response.Error == "" {
+        t.Errorf("Expected the error message to be kept alongside the field errors")
+    }
+
+    // A body that isn't valid JSON for the request is reported as a single entry
+    rec = performRequest(router, http.MethodPost, "/calculate/batch", `{"orders": "many"}`)
+    json.Unmarshal(rec.Body.Bytes(), &response)
+    if len(response.Errors) != 1 || response.Errors[0].Field != "orders" || response.Errors[0].Rule != "type" {
+        t.Errorf("Expected a single type error for orders, got %+v", response.Errors)
+    }
+}
+
+func TestNearestFillableHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 3}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 5}`)
+
+    rec := performRequest(router, http.MethodGet, "/calculate/nearest?items=7", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    var response NearestResponse
+    json.Unmarshal(rec.Body.Bytes(), &response)
+
+    if response.Items != 7 || response.Below.TotalItems != 6 || response.Above.TotalItems != 8 {
+        t.Errorf("Expected 6 and 8 around 7 items, got %+v", response)
+    }
+
+    for _, query := range []string{"", "?items=many", "?items=-1"} {
+        if rec := performRequest(router, http.MethodGet, "/calculate/nearest"+query, ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("%q: expected status 400, got %d", query, rec.Code)
+        }
+    }
+}
+
+func TestCalculateTable(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    rec := performRequest(router, http.MethodGet, "/calculate/table?from=1&to=501&step=250", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    var table []TableRow
+    json.Unmarshal(rec.Body.Bytes(), &table)
+
+    expected := []TableRow{
+        {Items: 1, Packs: []PackQuantity{{Pack: 250, Quantity: 1}}, TotalItems: 250, TotalPacks: 1},
+        {Items: 251, Packs: []PackQuantity{{Pack: 500, Quantity: 1}}, TotalItems: 500, TotalPacks: 1},
+        {Items: 501, Packs: []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, TotalItems: 750, TotalPacks: 2},
+    }
+    if !reflect.DeepEqual(table, expected) {
+        t.Errorf("Expected %+v, got %+v", expected, table)
+    }
+
+    rec = performRequest(router, http.MethodGet, "/calculate/table?from=1&to=100", "")
+    json.Unmarshal(rec.Body.Bytes(), &table)
+    if rec.Code != http.StatusOK || len(table) != 100 || table[99].Items != 100 {
+        t.Errorf("Expected 100 rows with the default step, got %d rows and status %d", len(table), rec.Code)
+    }
+
+    for _, query := range []string{"", "?from=1", "?from=-1&to=5", "?from=5&to=1", "?from=1&to=5&step=0", "?from=0&to=" + strconv.Itoa(maxTableRows)} {
+        if rec := performRequest(router, http.MethodGet, "/calculate/table"+query, ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("%q: expected status 400, got %d", query, rec.Code)
+        }
+    }
+}
+
+func TestCapabilities(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    rec := performRequest(router, http.MethodGet, "/calculate/capabilities", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    var response Capabilities
+    json.Unmarshal(rec.Body.Bytes(), &response)
+
+    if !reflect.DeepEqual(response.Modes, []string{"overship", "exact", "partial", "prefer_exact"}) ||
+        !reflect.DeepEqual(response.Strategies, []string{"balanced", "fewest_packs"}) ||
+        !reflect.DeepEqual(response.Algorithms, []string{"dp", "bfs", "greedy"}) {
+        t.Errorf("Expected every implemented mode, strategy and algorithm, got %+v", response)
+    }
+
+    expected := []string{"maxOvershipPercent", "maxWeight", "minOrder", "rejectBelowMinOrder", "minDistinctSizes", "limitStock"}
+    if !reflect.DeepEqual(response.Constraints, expected) {
+        t.Errorf("Expected constraints %v, got %v", expected, response.Constraints)
+    }
+
+    if response.Defaults.Mode != ModeOvership || response.Limits.MaxItems != maxItems() || response.Limits.MaxTableRows != maxTableRows {
+        t.Errorf("Expected the defaults and limits in force, got %+v %+v", response.Defaults, response.Limits)
+    }
+
+    // Requests are validated against the same lists
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    for _, mode := range response.Modes {
+        if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 250, "mode": "`+mode+`"}`); rec.Code != http.StatusOK {
+            t.Errorf("Expected mode %s to be accepted, got %d: %s", mode, rec.Code, rec.Body.String())
+        }
+    }
+
+    rec = performRequest(router, http.MethodPost, "/calculate/batch", `{"orders": [250], "algorithm": "quantum"}`)
+    if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "algorithm must be one of dp, bfs, greedy") {
+        t.Errorf("Expected an unlisted algorithm to be rejected, got %d %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestCalculatePreferExactHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500}`)
+
+    for _, test := range []struct {
+        items       string
+        approximate bool
+    }{{"750", false}, {"501", true}} {
+        rec := performRequest(router, http.MethodPost, "/calculate", `{"items": `+test.items+`, "mode": "prefer_exact"}`)
+
+        var result Result
+        json.Unmarshal(rec.Body.Bytes(), &result)
+
+        if rec.Code != http.StatusOK || result.TotalItems != 750 || result.Approximate != test.approximate {
+            t.Errorf("%s items: expected 750 items approximate %t, got %d %s", test.items, test.approximate, rec.Code, rec.Body.String())
+        }
+    }
+}
+
+func TestFormatThousands(t *testing.T) {
+    tests := []struct {
+        n        int
+        expected string
+    }{
+        {0, "0"},
+        {7, "7"},
+        {999, "999"},
+        {1000, "1,000"},
+        {12001, "12,001"},
+        {250000, "250,000"},
+        {1234567, "1,234,567"},
+        {1000000000, "1,000,000,000"},
+        {-1234567, "-1,234,567"},
+        {-999, "-999"},
+    }
+
+    for _, test := range tests {
+        if got := formatThousands(test.n); got != test.expected {
+            t.Errorf("formatThousands(%d): expected %q, got %q", test.n, test.expected, got)
+        }
+    }
+}
+
+func TestCalculatePickSheet(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []int{250, 500, 1000, 2000, 5000} {
+        performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size))
+    }
+
+    rec := performRequest(router, http.MethodGet, "/calculate?format=html&items=12001", "")
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+        t.Errorf("Expected an HTML response, got %s", contentType)
+    }
+
+    body := rec.Body.String()
+    for _, expected := range []string{
+        "<tr><td>5000</td><td>2</td><td>10000</td></tr>",
+        "<tr><td>2000</td><td>1</td><td>2000</td></tr>",
+        "<tr><td>250</td><td>1</td><td>250</td></tr>",
+        "<tfoot><tr><th>Total</th><th>4</th><th>12250</th></tr></tfoot>",
+        "Ordered: 12001 items",
+    } {
+        if !strings.Contains(body, expected) {
+            t.Errorf("Expected the pick sheet to contain %q, got %s", expected, body)
+        }
+    }
+
+    rec = performRequest(router, http.MethodGet, "/calculate?items=251", "")
+    if !strings.Contains(rec.Body.String(), `"pack":500`) {
+        t.Errorf("Expected a JSON breakdown by default, got %s", rec.Body.String())
+    }
+
+    if rec := performRequest(router, http.MethodGet, "/calculate?format=pdf&items=1", ""); rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for an unsupported format, got %d", rec.Code)
+    }
+
+    body = performRequest(router, http.MethodGet, "/calculate?format=html&human=true&items=12001", "").Body.String()
+    for _, expected := range []string{
+        "<tr><td>5,000</td><td>2</td><td>10,000</td></tr>",
+        "<tfoot><tr><th>Total</th><th>4</th><th>12,250</th></tr></tfoot>",
+        "Ordered: 12,001 items",
+    } {
+        if !strings.Contains(body, expected) {
+            t.Errorf("Expected the human readable pick sheet to contain %q, got %s", expected, body)
+        }
+    }
+}
+
+func TestPackCoverage(t *testing.T) {
+    tests := []struct {
+        sizes    []int
+        gcd      int
+        warnings int
+    }{
+        {[]int{4, 6}, 2, 1},
+        {[]int{3, 5}, 1, 0},
+        {nil, 0, 0},
+    }
+
+    for _, test := range tests {
+        router, cleanup := newTestServer(t)
+
+        for _, size := range test.sizes {
+            performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d}`, size))
+        }
+
+        var report CoverageReport
+        rec := performRequest(router, http.MethodGet, "/packs/coverage", "")
+        json.Unmarshal(rec.Body.Bytes(), &report)
+
+        if rec.Code != http.StatusOK || report.GCD != test.gcd || len(report.Warnings) != test.warnings {
+            t.Errorf("%v: expected gcd %d with %d warnings, got %d %+v", test.sizes, test.gcd, test.warnings, rec.Code, report)
+        }
+
+        if test.warnings > 0 && !strings.Contains(report.Warnings[0], "such as 3") {
+            t.Errorf("%v: expected the warning to give example orders, got %q", test.sizes, report.Warnings[0])
+        }
+
+        cleanup()
+    }
+}
+
+func TestCatalogETag(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+
+    for _, path := range []string{"/calculate/table?from=1&to=10", "/packs/coverage"} {
+        rec := performRequest(router, http.MethodGet, path, "")
+        etag := rec.Header().Get("ETag")
+        if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Cache-Control") != catalogCacheControl {
+            t.Fatalf("%s: expected OK with caching headers, got %d %v", path, rec.Code, rec.Header())
+        }
+
+        // A repeat with the catalog unchanged is not modified
+        req := httptest.NewRequest(http.MethodGet, path, nil)
+        req.Header.Set("If-None-Match", etag)
+        rec = httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+
+        if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+            t.Errorf("%s: expected 304 with the same ETag, got %d %q", path, rec.Code, rec.Body.String())
+        }
+    }
+
+    // Changing the catalog invalidates the tag
+    rec := performRequest(router, http.MethodGet, "/packs/coverage", "")
+    etag := rec.Header().Get("ETag")
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500}`)
+
+    req := httptest.NewRequest(http.MethodGet, "/packs/coverage", nil)
+    req.Header.Set("If-None-Match", etag)
+    rec = httptest.NewRecorder()
+    router.ServeHTTP(rec, req)
+
+    if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+        t.Errorf("Expected a new ETag once the catalog changed, got %d %v", rec.Code, rec.Header())
+    }
+}
+
+func TestCalculateByWeightHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250, "weight": 2.5}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500, "weight": 4.8}`)
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate/by-weight", `{"weight": 7}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if rec.Code != http.StatusOK || result.TotalItems != 750 || result.TotalWeight != 7.3 {
+        t.Errorf("Expected 750 items weighing 7.3, got %d %+v", rec.Code, result)
+    }
+
+    for _, body := range []string{`{}`, `{"weight": -1}`, `{"weight": 100000}`} {
+        if rec := performRequest(router, http.MethodPost, "/calculate/by-weight", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+}
+
+func TestCalculateMultiHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    body := `{"skus": {"cans": {"packs": [250, 500], "items": 501}, "bottles": {"packs": [6, 24], "items": 30}}}`
+
+    var result MultiResult
+    rec := performRequest(router, http.MethodPost, "/calculate/multi", body)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if rec.Code != http.StatusOK || len(result.SKUs) != 2 || result.TotalItems != 780 || result.TotalPacks != 4 {
+        t.Errorf("Expected two SKUs totalling 780 items in 4 packs, got %d %+v", rec.Code, result)
+    }
+
+    for _, body := range []string{`{}`, `{"skus": {}}`, `{"skus": {"cans": {"items": 1}}}`, `{"skus": {"cans": {"packs": [250], "items": -1}}}`, `{"skus": {"cans": {"packs": [250, 50000000], "items": 1}}}`} {
+        if rec := performRequest(router, http.MethodPost, "/calculate/multi", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+
+    rec = performRequest(router, http.MethodPost, "/calculate/multi", `{"skus": {"cans": {"packs": [], "items": 1}}}`)
+    if rec.Code != http.StatusUnprocessableEntity {
+        t.Errorf("Expected status 422 for a SKU without packs, got %d", rec.Code)
+    }
+}
+
+// unreachableStore is a MemoryStore whose backing database can't be reached.
+type unreachableStore struct {
+    *MemoryStore
+}
+
+func (unreachableStore) Ping(ctx context.Context) error {
+    return errors.New("server selection timeout")
+}
+
+func TestProbes(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, path := range []string{"/livez", "/readyz", "/healthz"} {
+        if rec := performRequest(router, http.MethodGet, path, ""); rec.Code != http.StatusOK {
+            t.Errorf("%s: expected status 200 with the store up, got %d", path, rec.Code)
+        }
+    }
+
+    database = unreachableStore{NewMemoryStore()}
+
+    if rec := performRequest(router, http.MethodGet, "/livez", ""); rec.Code != http.StatusOK {
+        t.Errorf("/livez: expected status 200 with the store down, got %d", rec.Code)
+    }
+
+    for _, path := range []string{"/readyz", "/healthz"} {
+        rec := performRequest(router, http.MethodGet, path, "")
+        if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "server selection timeout") {
+            t.Errorf("%s: expected status 503 with the store down, got %d %s", path, rec.Code, rec.Body.String())
+        }
+    }
+}
+
+func TestBodySizeLimit(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+    t.Setenv("MAX_BODY_BYTES", "64")
+
+    oversized := `{"orders": [` + strings.Repeat("1, ", 100) + `1]}`
+    rec := performRequest(router, http.MethodPost, "/calculate/batch", oversized)
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("Expected status 413 for a %d byte body, got %d", len(oversized), rec.Code)
+    }
+
+    rec = performRequest(router, http.MethodPut, "/packs/"+uuid.NewString(), `{"size": 250, "tags": ["`+strings.Repeat("a", 64)+`"]}`)
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("Expected status 413 for an oversized update, got %d", rec.Code)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    if rec.Code != http.StatusOK {
+        t.Errorf("Expected status 200 for a body within the limit, got %d", rec.Code)
+    }
+}
+
+func TestTrustedProxies(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    t.Setenv("TRUSTED_PROXIES", " 10.0.0.0/8, 192.168.1.1 ")
+    proxies, err := loadTrustedProxies()
+    if err != nil || !reflect.DeepEqual(proxies, []string{"10.0.0.0/8", "192.168.1.1"}) {
+        t.Fatalf("Expected both proxies, got %v %v", proxies, err)
+    }
+
+    t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,load-balancer")
+    if _, err := loadTrustedProxies(); err == nil {
+        t.Error("Expected an error for a proxy that is neither an IP nor a CIDR range")
+    }
+
+    tests := []struct {
+        proxies    []string
+        remoteAddr string
+        expected   string
+    }{
+        {nil, "10.1.2.3:1234", "10.1.2.3"},                          // Nothing trusted by default
+        {[]string{"10.0.0.0/8"}, "10.1.2.3:1234", "203.0.113.7"},    // Forwarded by a trusted proxy
+        {[]string{"10.0.0.0/8"}, "172.16.0.1:1234", "172.16.0.1"},   // Forwarded by an untrusted hop
+    }
+
+    previous := trustedProxies
+    defer func() { trustedProxies = previous }()
+
+    for _, test := range tests {
+        trustedProxies = test.proxies
+        router := InitRouter()
+        router.GET("/ip", func(ctx *gin.Context) { ctx.String(http.StatusOK, ctx.ClientIP()) })
+
+        req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+        req.RemoteAddr = test.remoteAddr
+        req.Header.Set("X-Forwarded-For", "203.0.113.7")
+        rec := httptest.NewRecorder()
+        router.ServeHTTP(rec, req)
+
+        if rec.Body.String() != test.expected {
+            t.Errorf("Proxies %v from %s: expected client IP %s, got %s", test.proxies, test.remoteAddr, test.expected, rec.Body.String())
+        }
+    }
+}
+
+func TestSearchPacks(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []int{250, 480, 500, 530, 1000} {
+        database.CreatePack(Pack{Size: size})
+    }
+
+    tests := []struct {
+        query    string
+        expected []int
+    }{
+        {"near=500", []int{500}},                        // Exact match only
+        {"near=500&tolerance=50", []int{500, 480, 530}}, // Closest first
+        {"near=505&tolerance=25", []int{500, 480, 530}}, // Ties listed smaller first
+        {"near=100&tolerance=150", []int{250}},          // Range clamped at the smallest size
+        {"near=700&tolerance=100", []int{}},             // No match
+    }
+
+    for _, test := range tests {
+        rec := performRequest(router, http.MethodGet, "/packs/search?"+test.query, "")
+
+        var packs []Pack
+        json.Unmarshal(rec.Body.Bytes(), &packs)
+
+        sizes := []int{}
+        for _, pack := range packs {
+            sizes = append(sizes, pack.Size)
+        }
+
+        if rec.Code != http.StatusOK || !reflect.DeepEqual(sizes, test.expected) {
+            t.Errorf("%s: expected %v, got %d %v", test.query, test.expected, rec.Code, sizes)
+        }
+    }
+
+    for _, query := range []string{"", "near=0", "near=abc", "near=500&tolerance=-1"} {
+        if rec := performRequest(router, http.MethodGet, "/packs/search?"+query, ""); rec.Code != http.StatusBadRequest {
+            t.Errorf("%q: expected status 400, got %d", query, rec.Code)
+        }
+    }
+}
+
+func TestDefaultAlgorithmFromEnv(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    t.Setenv("ALGO", "greedy")
+    algorithm, err := loadDefaultAlgorithm()
+    if err != nil {
+        t.Fatalf("Failed to load default algorithm: %v", err)
+    }
+
+    previous := defaultAlgorithm
+    defaultAlgorithm = algorithm
+    defer func() { defaultAlgorithm = previous }()
+
+    for _, size := range []string{"3", "4"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    // Without an algorithm in the body the env default applies
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 6}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if result.TotalItems != 7 {
+        t.Errorf("Expected the greedy default to ship 7 items, got %+v", result)
+    }
+
+    // An explicit algorithm still overrides the default
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": 6, "algorithm": "bfs"}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if result.TotalItems != 6 {
+        t.Errorf("Expected the bfs algorithm to ship 6 items, got %+v", result)
+    }
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 6, "algorithm": "simplex"}`); rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for an unknown algorithm, got %d", rec.Code)
+    }
+
+    t.Setenv("ALGO", "simplex")
+    if _, err := loadDefaultAlgorithm(); err == nil {
+        t.Error("Expected an error for an invalid ALGO")
+    }
+}
+
+func TestCalculateInlinePacks(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    tests := []struct {
+        body     string
+        expected []PackQuantity
+    }{
+        {`{"items": 501}`, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}},                // Stored catalog
+        {`{"items": 501, "packs": [300, 700]}`, []PackQuantity{{Pack: 300, Quantity: 2}}},                     // Inline set takes precedence
+        {`{"items": 501, "packs": null}`, []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}}, // Null falls back to the catalog
+    }
+
+    for _, test := range tests {
+        var result Result
+        rec := performRequest(router, http.MethodPost, "/calculate", test.body)
+        json.Unmarshal(rec.Body.Bytes(), &result)
+
+        if rec.Code != http.StatusOK || !reflect.DeepEqual(result.Packs, test.expected) {
+            t.Errorf("%s: expected %+v, got %d %+v", test.body, test.expected, rec.Code, result.Packs)
+        }
+    }
+
+    for _, body := range []string{
+        `{"items": 501, "packs": []}`,
+        `{"items": 501, "packs": [250, 0]}`,
+        `{"items": 501, "packs": [250, 250]}`,
+        `{"items": 501, "packs": [250, 2000000]}`,
+        `{"items": 501, "packs": [250], "tag": "fragile"}`,
+    } {
+        if rec := performRequest(router, http.MethodPost, "/calculate", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+}
+
+func TestCalculateResponseOrdering(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "1000", "500"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    expected := []PackQuantity{{Pack: 1000, Quantity: 1}, {Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}
+
+    for _, algorithm := range AlgorithmNames {
+        var result Result
+        rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 1750, "algorithm": "`+algorithm+`"}`)
+        json.Unmarshal(rec.Body.Bytes(), &result)
+
+        if !reflect.DeepEqual(result.Packs, expected) {
+            t.Errorf("%s: expected packs largest first %+v, got %+v", algorithm, expected, result.Packs)
+        }
+    }
+
+    var result Result
+    rec := performRequest(router, http.MethodGet, "/calculate?items=1750", "")
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    if !reflect.DeepEqual(result.Packs, expected) {
+        t.Errorf("GET: expected packs largest first %+v, got %+v", expected, result.Packs)
+    }
+}
+
+func TestCalculateUtilization(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    tests := []struct {
+        method, path, body string
+        expected           float64
+    }{
+        {http.MethodPost, "/calculate", `{"items": 750}`, 1},
+        {http.MethodPost, "/calculate", `{"items": 501}`, 501.0 / 750},
+        {http.MethodPost, "/calculate", `{"items": 1}`, 1.0 / 250},
+        {http.MethodPost, "/calculate", `{"items": 251, "mode": "partial"}`, 1},
+        {http.MethodGet, "/calculate?items=12001", "", 12001.0 / 12250},
+    }
+
+    for _, test := range tests {
+        var result Result
+        rec := performRequest(router, test.method, test.path, test.body)
+        json.Unmarshal(rec.Body.Bytes(), &result)
+
+        if rec.Code != http.StatusOK || !approxEqual(result.Utilization, test.expected) {
+            t.Errorf("%s %s %s: expected utilization %v, got %d %v", test.method, test.path, test.body, test.expected, rec.Code, result.Utilization)
+        }
+    }
+
+    var batch []BatchEntry
+    rec := performRequest(router, http.MethodPost, "/calculate/batch", `{"orders": [500, 501]}`)
+    json.Unmarshal(rec.Body.Bytes(), &batch)
+
+    if len(batch) != 2 || batch[0].Result.Utilization != 1 || !approxEqual(batch[1].Result.Utilization, 501.0/750) {
+        t.Errorf("Expected batch results to carry their utilization, got %s", rec.Body.String())
+    }
+}
+
+func TestCalculateSubtotals(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250, "cost": 1.25, "weight": 0.4}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 500, "cost": 2.1, "weight": 0.7}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 1000, "cost": 3.9, "weight": 1.2}`)
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 1750, "subtotals": true}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    expected := []PackQuantity{
+        {Pack: 1000, Quantity: 1, Items: 1000, Cost: 3.9, Weight: 1.2},
+        {Pack: 500, Quantity: 1, Items: 500, Cost: 2.1, Weight: 0.7},
+        {Pack: 250, Quantity: 1, Items: 250, Cost: 1.25, Weight: 0.4},
+    }
+    if rec.Code != http.StatusOK || !reflect.DeepEqual(result.Packs, expected) {
+        t.Errorf("Expected subtotals %+v, got %d %+v", expected, rec.Code, result.Packs)
+    }
+
+    rec = performRequest(router, http.MethodPost, "/calculate", `{"items": 750}`)
+    if strings.Contains(rec.Body.String(), `"items":`) {
+        t.Errorf("Expected no subtotals unless requested, got %s", rec.Body.String())
+    }
+}
+
+func TestCalculatePackPriority(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    performRequest(router, http.MethodPost, "/packs", `{"size": 2}`)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 4}`)
+
+    var pack Pack
+    json.Unmarshal(performRequest(router, http.MethodPost, "/packs", `{"size": 3}`).Body.Bytes(), &pack)
+
+    var result Result
+    json.Unmarshal(performRequest(router, http.MethodPost, "/calculate", `{"items": 6}`).Body.Bytes(), &result)
+    if expected := []PackQuantity{{Pack: 4, Quantity: 1}, {Pack: 2, Quantity: 1}}; !reflect.DeepEqual(result.Packs, expected) {
+        t.Errorf("Expected the larger packs without priorities %+v, got %+v", expected, result.Packs)
+    }
+
+    rec := performRequest(router, http.MethodPut, "/packs/"+pack.ID, `{"size": 3, "priority": 1}`)
+    if !strings.Contains(rec.Body.String(), `"priority":1`) {
+        t.Fatalf("Expected the priority to be stored, got %s", rec.Body.String())
+    }
+
+    json.Unmarshal(performRequest(router, http.MethodPost, "/calculate", `{"items": 6}`).Body.Bytes(), &result)
+    if expected := []PackQuantity{{Pack: 3, Quantity: 2}}; !reflect.DeepEqual(result.Packs, expected) {
+        t.Errorf("Expected the prioritized packs %+v, got %+v", expected, result.Packs)
+    }
+}
+
+func TestDeletePacksBySize(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"250", "500", "1000"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`}`)
+    }
+
+    // 750 has no pack, so only 250 is deleted
+    rec := performRequest(router, http.MethodPost, "/packs/delete", `{"sizes": [250, 750]}`)
+    if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"deleted":1}` {
+        t.Errorf("Expected one pack deleted, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    packs, _ := database.GetAllPacks(ListOptions{})
+    if len(packs) != 2 || packs[0].Size != 1000 || packs[1].Size != 500 {
+        t.Errorf("Expected packs 1000 and 500 to remain, got %+v", packs)
+    }
+
+    for _, body := range []string{`{}`, `{"sizes": []}`, `{"sizes": [250, 0]}`, `{"sizes": "250"}`} {
+        if rec := performRequest(router, http.MethodPost, "/packs/delete", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+}
+
+func TestReplacePacks(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    var kept Pack
+    performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    json.Unmarshal(performRequest(router, http.MethodPost, "/packs", `{"size": 500}`).Body.Bytes(), &kept)
+    performRequest(router, http.MethodPost, "/packs", `{"size": 1000, "cost": 9}`)
+
+    // 250 is removed, 500 is kept as is, 1000 changes its cost and 2000 is added
+    rec := performRequest(router, http.MethodPut, "/packs", `{"packs": [{"size": 2000}, {"size": 1000, "cost": 8}, {"size": 500}]}`)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+    }
+
+    var summary ReplaceSummary
+    json.Unmarshal(rec.Body.Bytes(), &summary)
+
+    expected := ReplaceSummary{Added: []int{2000}, Removed: []int{250}, Updated: []int{1000}}
+    if !reflect.DeepEqual(summary, expected) {
+        t.Errorf("Expected %+v, got %+v", expected, summary)
+    }
+
+    packs, _ := database.GetAllPacks(ListOptions{})
+    sizes := map[int]Pack{}
+    for _, pack := range packs {
+        sizes[pack.Size] = pack
+    }
+    if len(packs) != 3 || sizes[1000].Cost != 8 || sizes[2000].ID == "" || sizes[500].ID != kept.ID {
+        t.Errorf("Expected packs 500, 1000 at cost 8 and 2000 with 500 keeping its ID, got %+v", packs)
+    }
+
+    // Changing a size removes the old one and adds the new one
+    rec = performRequest(router, http.MethodPut, "/packs", `{"packs": [{"size": 750}, {"size": 1000, "cost": 8}, {"size": 2000}]}`)
+    json.Unmarshal(rec.Body.Bytes(), &summary)
+
+    expected = ReplaceSummary{Added: []int{750}, Removed: []int{500}, Updated: []int{}}
+    if rec.Code != http.StatusOK || !reflect.DeepEqual(summary, expected) {
+        t.Errorf("Expected %+v, got %d %+v", expected, rec.Code, summary)
+    }
+
+    for _, body := range []string{`{}`, `{"packs": []}`, `{"packs": [{"size": 0}]}`, `{"packs": [{"size": 250, "cost": -1}]}`} {
+        if rec := performRequest(router, http.MethodPut, "/packs", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+
+    if packs, _ := database.GetAllPacks(ListOptions{}); len(packs) != 3 {
+        t.Errorf("Expected rejected replacements to leave the catalog alone, got %+v", packs)
+    }
+}
+
+func TestReplacePacksSortsSummary(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []string{"30", "10", "50", "20", "40"} {
+        performRequest(router, http.MethodPost, "/packs", `{"size": `+size+`, "cost": 1}`)
+    }
+
+    // Sizes are listed out of order in the request and were created out of order in the store
+    rec := performRequest(router, http.MethodPut, "/packs", `{"packs": [{"size": 70}, {"size": 20}, {"size": 90}, {"size": 40}, {"size": 80}]}`)
+
+    var summary ReplaceSummary
+    json.Unmarshal(rec.Body.Bytes(), &summary)
+
+    expected := ReplaceSummary{Added: []int{90, 80, 70}, Removed: []int{50, 30, 10}, Updated: []int{40, 20}}
+    if rec.Code != http.StatusOK || !reflect.DeepEqual(summary, expected) {
+        t.Errorf("Expected every list largest first, %+v, got %d %+v", expected, rec.Code, summary)
+    }
+}
+
+func TestLogCatalog(t *testing.T) {
+    var logs bytes.Buffer
+    log.SetOutput(&logs)
+    defer log.SetOutput(os.Stderr)
+
+    store := NewMemoryStore()
+    logCatalog(store)
+    if !strings.Contains(logs.String(), "Warning: the pack catalog is empty") {
+        t.Errorf("Expected a warning for an empty catalog, got %q", logs.String())
+    }
+
+    for _, size := range []int{500, 250, 1000} {
+        store.CreatePack(Pack{Size: size})
+    }
+
+    logs.Reset()
+    logCatalog(store)
+    if !strings.Contains(logs.String(), "Pack catalog: 3 packs, sizes [1000 500 250]") {
+        t.Errorf("Expected the seeded catalog to be logged, got %q", logs.String())
+    }
+}
+
+func TestMaxPackSize(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    t.Setenv("MAX_PACK_SIZE", "1000")
+
+    // A pack at the bound is accepted when created, updated and replaced
+    var pack Pack
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": 1000}`)
+    json.Unmarshal(rec.Body.Bytes(), &pack)
+    if rec.Code != http.StatusOK {
+        t.Fatalf("Expected a pack at the bound to be created, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    if rec := performRequest(router, http.MethodPut, "/packs/"+pack.ID, `{"size": 1000, "cost": 2}`); rec.Code != http.StatusOK {
+        t.Errorf("Expected a pack at the bound to be updated, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    if rec := performRequest(router, http.MethodPut, "/packs", `{"packs": [{"size": 500}, {"size": 1000}]}`); rec.Code != http.StatusOK {
+        t.Errorf("Expected a catalog at the bound to replace the old one, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    // Sizes given with a calculation are held to the same bound
+    for _, request := range []struct{ method, path, body string }{
+        {http.MethodPost, "/calculate", `{"items": 1000, "packs": [500, 1000]}`},
+        {http.MethodPost, "/calculate/multi", `{"skus": {"cans": {"packs": [500, 1000], "items": 1000}}}`},
+        {http.MethodPost, "/calculate/combined", `{"depots": {"north": [500, 1000]}, "items": 1000}`},
+        {http.MethodPost, "/packs/" + pack.ID + "/calculate-impact", `{"size": 1000, "items": 1000}`},
+    } {
+        if rec := performRequest(router, request.method, request.path, request.body); rec.Code != http.StatusOK {
+            t.Errorf("%s %s: expected a pack at the bound to be calculated with, got %d %s", request.method, request.path, rec.Code, rec.Body.String())
+        }
+    }
+
+    // A pack above it is rejected everywhere
+    for _, request := range []struct{ method, path, body string }{
+        {http.MethodPost, "/packs", `{"size": 1001}`},
+        {http.MethodPut, "/packs/" + pack.ID, `{"size": 1001}`},
+        {http.MethodPut, "/packs", `{"packs": [{"size": 500}, {"size": 1001}]}`},
+        {http.MethodPost, "/calculate", `{"items": 1000, "packs": [500, 1001]}`},
+        {http.MethodPost, "/calculate/multi", `{"skus": {"cans": {"packs": [500, 1001], "items": 1000}}}`},
+        {http.MethodPost, "/calculate/combined", `{"depots": {"north": [500, 1001]}, "items": 1000}`},
+        {http.MethodPost, "/packs/" + pack.ID + "/calculate-impact", `{"size": 1001, "items": 1000}`},
+    } {
+        rec := performRequest(router, request.method, request.path, request.body)
+        if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "exceeds the largest pack size of 1000") {
+            t.Errorf("%s %s: expected status 400 naming the bound, got %d %s", request.method, request.path, rec.Code, rec.Body.String())
+        }
+    }
+
+    packs, _ := database.GetAllPacks(ListOptions{})
+    if len(packs) != 2 || packs[0].Size != 1000 || packs[1].Size != 500 {
+        t.Errorf("Expected rejected packs to leave the catalog alone, got %+v", packs)
+    }
+
+    if errs, _ := ValidatePackSizes([]int{500, 1001}); len(errs) != 1 {
+        t.Errorf("Expected validation to flag the oversized pack, got %v", errs)
+    }
+}
+
+func TestPackHistory(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    var pack Pack
+    rec := performRequest(router, http.MethodPost, "/packs", `{"size": 250}`)
+    json.Unmarshal(rec.Body.Bytes(), &pack)
+
+    performRequest(router, http.MethodPut, "/packs/"+pack.ID, `{"size": 300}`)
+    performRequest(router, http.MethodPut, "/packs/"+pack.ID, `{"size": 300, "tags": ["fragile"]}`) // Leaves the size as it was
+    performRequest(router, http.MethodPut, "/packs/"+pack.ID, `{"size": 350}`)
+
+    var history []SizeChange
+    rec = performRequest(router, http.MethodGet, "/packs/"+pack.ID+"/history", "")
+    json.Unmarshal(rec.Body.Bytes(), &history)
+
+    sizes := []int{}
+    for i, change := range history {
+        sizes = append(sizes, change.Size)
+        if i > 0 && change.ChangedAt.Before(history[i-1].ChangedAt) {
+            t.Errorf("Expected history in chronological order, got %+v", history)
+        }
+    }
+
+    if rec.Code != http.StatusOK || !reflect.DeepEqual(sizes, []int{250, 300, 350}) {
+        t.Errorf("Expected the sizes 250, 300 and 350, got %d %v", rec.Code, sizes)
+    }
+
+    // The history outlives the pack
+    performRequest(router, http.MethodDelete, "/packs/"+pack.ID, "")
+    if rec := performRequest(router, http.MethodGet, "/packs/"+pack.ID+"/history", ""); rec.Code != http.StatusOK {
+        t.Errorf("Expected the history of a deleted pack, got %d", rec.Code)
+    }
+
+    if rec := performRequest(router, http.MethodGet, "/packs/"+uuid.NewString()+"/history", ""); rec.Code != http.StatusNotFound {
+        t.Errorf("Expected status 404 for a pack that never existed, got %d", rec.Code)
+    }
+}
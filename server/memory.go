@@ -0,0 +1,252 @@
+package main
+
+import (
+    "context"
+    "slices"
+    "sort"
+    "sync"
+    "time"
+)
+
+// MemoryStore is an in-memory PackStore, used for tests and running without MongoDB.
+// It is safe for concurrent use: reads share a read lock and writes take the lock
+// exclusively. Packs are copied in and out, so callers never share its state.
+type MemoryStore struct {
+    mu    sync.RWMutex
+    packs []Pack        // Packs in insertion order
+    audit []SizeChange  // Every size given to a pack, oldest first
+    newID     func() string   // ID generator for new packs from ID_SCHEME, defaults to uuid.NewString
+    observeID func(id string) // Tells the generator of IDs stored without it
+}
+
+// NewMemoryStore returns an empty MemoryStore giving packs IDs of the ID_SCHEME.
+func NewMemoryStore() *MemoryStore {
+    newID, observeID, _ := idSchemeFor(idScheme).Generator(func() ([]string, error) { return nil, nil }) // Nothing is stored yet
+    return &MemoryStore{newID: newID, observeID: observeID}
+}
+
+// CreatePack stores a new pack and returns it with its generated ID.
+// It returns ErrDuplicateSize if a pack of the same size already exists.
+func (m *MemoryStore) CreatePack(pack Pack) (Pack, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for _, existing := range m.packs {
+        if existing.Size == pack.Size {
+            return Pack{}, ErrDuplicateSize
+        }
+    }
+
+    pack.ID = m.newID()
+    pack.CreatedAt = time.Now().UTC()
+    pack.UpdatedAt = pack.CreatedAt
+
+    m.packs = append(m.packs, clonePack(pack))
+    m.audit = append(m.audit, SizeChange{PackID: pack.ID, Size: pack.Size, ChangedAt: pack.CreatedAt})
+
+    return pack, nil
+}
+
+// GetAllPacks returns all packs in the requested order.
+func (m *MemoryStore) GetAllPacks(opts ListOptions) ([]Pack, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    packs := make([]Pack, 0, len(m.packs))
+    for _, pack := range m.packs {
+        if len(opts.Tags) > 0 && !hasAnyTag(pack, opts.Tags) {
+            continue
+        }
+        if (opts.MinSize > 0 && pack.Size < opts.MinSize) || (opts.MaxSize > 0 && pack.Size > opts.MaxSize) {
+            continue
+        }
+        packs = append(packs, clonePack(pack))
+    }
+
+    sort.Slice(packs, func(i, j int) bool {
+        a, b := packs[i], packs[j]
+        switch {
+        case opts.Sort == "created_asc" && !a.CreatedAt.Equal(b.CreatedAt):
+            return a.CreatedAt.Before(b.CreatedAt)
+        case opts.Sort == "created_desc" && !a.CreatedAt.Equal(b.CreatedAt):
+            return a.CreatedAt.After(b.CreatedAt)
+        }
+        return packBefore(a, b) // Break ties as the database does
+    })
+
+    return packs, nil
+}
+
+// GetPack returns the pack with the given ID.
+func (m *MemoryStore) GetPack(id string) (Pack, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    i := m.indexOf(id)
+    if i < 0 {
+        return Pack{}, ErrPackNotFound
+    }
+
+    return clonePack(m.packs[i]), nil
+}
+
+// UpdatePack updates the size of an existing pack, preserving its creation time.
+// It returns ErrDuplicateSize if another pack already has the new size.
+func (m *MemoryStore) UpdatePack(pack Pack) (Pack, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    i := m.indexOf(pack.ID)
+    if i < 0 {
+        return Pack{}, ErrPackNotFound
+    }
+
+    for j, existing := range m.packs {
+        if j != i && existing.Size == pack.Size {
+            return Pack{}, ErrDuplicateSize
+        }
+    }
+
+    m.packs[i].Size = pack.Size
+    m.packs[i].Tags = slices.Clone(pack.Tags)
+    m.packs[i].Weight = pack.Weight
+    m.packs[i].Cost = pack.Cost
+    m.packs[i].Priority = pack.Priority
+    m.packs[i].Stock = pack.Stock
+    m.packs[i].UpdatedAt = time.Now().UTC()
+    m.audit = append(m.audit, SizeChange{PackID: pack.ID, Size: pack.Size, ChangedAt: m.packs[i].UpdatedAt})
+
+    return clonePack(m.packs[i]), nil
+}
+
+// DeletePack removes the pack with the given ID. Deleting a missing pack is not an error.
+func (m *MemoryStore) DeletePack(id string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if i := m.indexOf(id); i >= 0 {
+        m.packs = append(m.packs[:i], m.packs[i+1:]...)
+    }
+
+    return nil
+}
+
+// DeletePacksBySize removes every pack whose size is in sizes and returns how many were removed.
+func (m *MemoryStore) DeletePacksBySize(sizes []int) (int, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    kept := m.packs[:0]
+    for _, pack := range m.packs {
+        if !slices.Contains(sizes, pack.Size) {
+            kept = append(kept, pack)
+        }
+    }
+
+    deleted := len(m.packs) - len(kept)
+    m.packs = kept
+
+    return deleted, nil
+}
+
+// ReplacePacks replaces the catalog with packs under a single lock, so readers see
+// either the old catalog or the new one. Kept sizes keep their IDs and creation times,
+// and added packs keep any they carry, as restored backups do.
+func (m *MemoryStore) ReplacePacks(packs []Pack) (ReplaceSummary, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    summary, proposed, err := planReplace(m.packs, packs)
+    if err != nil {
+        return ReplaceSummary{}, err
+    }
+
+    now := time.Now().UTC()
+    kept := m.packs[:0]
+    for _, pack := range m.packs {
+        if slices.Contains(summary.Removed, pack.Size) {
+            continue
+        }
+
+        if slices.Contains(summary.Updated, pack.Size) {
+            after := proposed[pack.Size]
+            pack.Tags = slices.Clone(after.Tags)
+            pack.Weight = after.Weight
+            pack.Cost = after.Cost
+            pack.Priority = after.Priority
+            pack.Stock = after.Stock
+            pack.UpdatedAt = now
+        }
+        kept = append(kept, pack)
+    }
+
+    for _, size := range summary.Added {
+        pack := clonePack(proposed[size])
+        if pack.ID == "" {
+            pack.ID = m.newID()
+        } else {
+            m.observeID(pack.ID) // Keep later packs from reusing a carried ID
+        }
+        if pack.CreatedAt.IsZero() {
+            pack.CreatedAt = now
+        }
+        pack.UpdatedAt = now
+
+        kept = append(kept, pack)
+        m.audit = append(m.audit, SizeChange{PackID: pack.ID, Size: pack.Size, ChangedAt: now})
+    }
+
+    m.packs = kept
+
+    return summary, nil
+}
+
+// PackHistory returns the size changes of the pack with the given ID, oldest first.
+func (m *MemoryStore) PackHistory(id string) ([]SizeChange, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    var entries []SizeChange
+    for _, entry := range m.audit {
+        if entry.PackID == id {
+            entries = append(entries, entry)
+        }
+    }
+
+    return sizeChanges(entries), nil
+}
+
+// Ping always succeeds, as there is nothing to connect to.
+func (m *MemoryStore) Ping(ctx context.Context) error {
+    return nil
+}
+
+// clonePack returns a copy of the pack that shares no memory with it.
+func clonePack(pack Pack) Pack {
+    pack.Tags = slices.Clone(pack.Tags)
+    return pack
+}
+
+// indexOf returns the position of the pack with the given ID, or -1. Callers must hold mu.
+func (m *MemoryStore) indexOf(id string) int {
+    for i, pack := range m.packs {
+        if pack.ID == id {
+            return i
+        }
+    }
+
+    return -1
+}
+
+// hasAnyTag reports whether the pack carries at least one of the tags.
+func hasAnyTag(pack Pack, tags []string) bool {
+    for _, tag := range tags {
+        for _, packTag := range pack.Tags {
+            if packTag == tag {
+                return true
+            }
+        }
+    }
+
+    return false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+)
+
+// TestMemoryStoreConcurrent mixes concurrent reads and writes on one store.
+// Run with -race to detect unsynchronized access.
+func TestMemoryStoreConcurrent(t *testing.T) {
+    store := NewMemoryStore()
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(2)
+
+        go func(size int) {
+            defer wg.Done()
+
+            pack, err := store.CreatePack(Pack{Size: size, Tags: []string{"bulk"}})
+            if err != nil {
+                t.Errorf("CreatePack(%d) failed: %v", size, err)
+                return
+            }
+
+            pack.Size += 1000
+            if _, err := store.UpdatePack(pack); err != nil {
+                t.Errorf("UpdatePack(%s) failed: %v", pack.ID, err)
+            }
+
+            if size%3 == 0 {
+                store.DeletePack(pack.ID)
+            }
+        }(i + 1)
+
+        go func() {
+            defer wg.Done()
+
+            packs, err := store.GetAllPacks(ListOptions{Sort: "created_desc", Tags: []string{"bulk"}})
+            if err != nil {
+                t.Errorf("GetAllPacks failed: %v", err)
+                return
+            }
+
+            for _, pack := range packs {
+                store.GetPack(pack.ID)
+            }
+        }()
+    }
+    wg.Wait()
+
+    packs, _ := store.GetAllPacks(ListOptions{})
+    if len(packs) != 14 {
+        t.Errorf("Expected 14 packs to remain after deleting every third, got %d", len(packs))
+    }
+}
+
+func TestMemoryStoreReturnsCopies(t *testing.T) {
+    store := NewMemoryStore()
+
+    tags := []string{"fragile"}
+    created, _ := store.CreatePack(Pack{Size: 250, Tags: tags})
+    tags[0] = "changed by caller"
+
+    packs, _ := store.GetAllPacks(ListOptions{})
+    packs[0].Size = 1
+    packs[0].Tags[0] = "changed by reader"
+
+    pack, _ := store.GetPack(created.ID)
+    if pack.Size != 250 || fmt.Sprint(pack.Tags) != "[fragile]" {
+        t.Errorf("Expected the stored pack to be unaffected by callers, got %+v", pack)
+    }
+}
+
+func TestMemoryStoreSorted(t *testing.T) {
+    store := NewMemoryStore()
+
+    // Stored out of order, with a size shared by two packs as older databases may hold
+    earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    later := earlier.Add(time.Hour)
+    store.packs = []Pack{
+        {ID: "c", Size: 250, CreatedAt: later},
+        {ID: "b", Size: 1000, CreatedAt: earlier},
+        {ID: "e", Size: 500, CreatedAt: earlier},
+        {ID: "a", Size: 1000, CreatedAt: later},
+        {ID: "d", Size: 500, CreatedAt: later},
+    }
+
+    tests := []struct {
+        sort     string
+        expected []string
+    }{
+        {"", []string{"a", "b", "d", "e", "c"}},
+        {"created_asc", []string{"b", "e", "a", "d", "c"}},
+        {"created_desc", []string{"a", "d", "c", "b", "e"}},
+    }
+
+    for _, test := range tests {
+        packs, err := store.GetAllPacks(ListOptions{Sort: test.sort})
+        if err != nil {
+            t.Fatalf("GetAllPacks failed: %v", err)
+        }
+
+        ids := make([]string, len(packs))
+        for i, pack := range packs {
+            ids[i] = pack.ID
+        }
+
+        if !reflect.DeepEqual(ids, test.expected) {
+            t.Errorf("%q: expected %v, got %v", test.sort, test.expected, ids)
+        }
+    }
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "sync"
+)
+
+// maxCachedRemainders bounds the catalogs whose remainders are kept at once. The cache
+// starts over when it fills up, which only happens when the catalog keeps changing.
+const maxCachedRemainders = 64
+
+// remainderCache holds the feasible remainders of recently used catalogs, so requests
+// against an unchanged catalog reuse them. Entries are keyed by the pack sizes, so a
+// catalog change never reads the remainders of the old one.
+var remainderCache = newRemaindersCache()
+
+// Remainders records, for every remainder modulo the largest pack size, the smallest
+// total with that remainder whole packs can fill. Any larger total with the same
+// remainder is that one plus some largest packs, so it can be filled too.
+type Remainders struct {
+    modulus  int
+    smallest []int // Smallest fillable total of each remainder, math.MaxInt when none is
+}
+
+// newFeasibleRemainders computes the remainders of sizes, in descending order, with
+// the round robin algorithm: each smaller size in turn extends the totals found so far
+// around the cycles it forms modulo the largest size.
+func newFeasibleRemainders(sizes []int) *Remainders {
+    modulus := sizes[0]
+    smallest := make([]int, modulus)
+    for r := 1; r < modulus; r++ {
+        smallest[r] = math.MaxInt
+    }
+
+    for _, size := range sizes[1:] {
+        cycles := gcd(size, modulus)
+        for start := 0; start < cycles; start++ {
+            // Begin each cycle at its smallest fillable total so one lap settles it
+            total := math.MaxInt
+            for r := start; r < modulus; r += cycles {
+                total = min(total, smallest[r])
+            }
+            if total == math.MaxInt {
+                continue
+            }
+
+            for i := 0; i < modulus/cycles; i++ {
+                total += size
+                r := total % modulus
+                total = min(total, smallest[r])
+                smallest[r] = total
+            }
+        }
+    }
+
+    return &Remainders{modulus: modulus, smallest: smallest}
+}
+
+// Fillable reports whether whole packs fill total exactly.
+func (r *Remainders) Fillable(total int) bool {
+    return total >= r.smallest[total%r.modulus]
+}
+
+// remaindersCache is a bounded cache of Remainders by catalog.
+type remaindersCache struct {
+    mu      sync.Mutex
+    entries map[string]*Remainders
+}
+
+// newRemaindersCache returns an empty remaindersCache.
+func newRemaindersCache() *remaindersCache {
+    return &remaindersCache{entries: make(map[string]*Remainders)}
+}
+
+// For returns the remainders of sizes, in descending order, computing them on first use.
+func (c *remaindersCache) For(sizes []int) *Remainders {
+    key := fmt.Sprint(sizes)
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if cached, ok := c.entries[key]; ok {
+        return cached
+    }
+
+    if len(c.entries) >= maxCachedRemainders {
+        c.entries = make(map[string]*Remainders)
+    }
+
+    computed := newFeasibleRemainders(sizes)
+    c.entries[key] = computed
+
+    return computed
+}
+
+// gcd returns the greatest common divisor of two positive integers.
+func gcd(a, b int) int {
+    for b != 0 {
+        a, b = b, a%b
+    }
+
+    return a
+}
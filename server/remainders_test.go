@@ -0,0 +1,88 @@
+package main
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestFeasibleRemainders(t *testing.T) {
+    catalogs := [][]int{
+        {250, 500, 1000, 2000, 5000}, // Sizes sharing a common divisor
+        {23, 31, 53},                 // Coprime sizes
+        {12, 9, 6},                   // Sizes whose cycles modulo the largest split
+        {7},
+    }
+
+    for _, sizes := range catalogs {
+        limit := 10 * sizes[0]
+        counts, _ := fewestPacks(sizes, limit)
+        remainders := newFeasibleRemainders(sizes)
+
+        for total := 0; total <= limit; total++ {
+            if got := remainders.Fillable(total); got != (counts[total] >= 0) {
+                t.Errorf("%v: expected %d fillable to be %t, got %t", sizes, total, counts[total] >= 0, got)
+            }
+        }
+    }
+}
+
+func TestRemainderCacheReuse(t *testing.T) {
+    cache := newRemaindersCache()
+    sizes := []int{53, 31, 23}
+
+    first := cache.For(sizes)
+    if cache.For([]int{53, 31, 23}) != first {
+        t.Error("Expected the remainders of an unchanged catalog to be reused")
+    }
+    if cache.For([]int{53, 31}) == first {
+        t.Error("Expected a changed catalog to get its own remainders")
+    }
+
+    packs := []Pack{{Size: 23}, {Size: 31}, {Size: 53}}
+    opts := CalculateOptions{Mode: ModeExact, Strategy: StrategyBalanced}
+
+    // Calculate with the shared cache cold and then warm, checking both against the tables
+    previous := remainderCache
+    defer func() { remainderCache = previous }()
+
+    remainderCache = newRemaindersCache()
+    for round := 0; round < 2; round++ {
+        for items := 1; items <= 300; items++ {
+            counts, last := fewestPacks(sizes, items)
+
+            result, err := Calculate(packs, items, opts)
+            if counts[items] < 0 {
+                if !errors.Is(err, ErrUnfillable) {
+                    t.Errorf("Round %d: expected %d to be unfillable, got %+v %v", round, items, result, err)
+                }
+                continue
+            }
+
+            if expected := breakdown(items, last, sizes); err != nil || !reflect.DeepEqual(result, expected) {
+                t.Errorf("Round %d: expected %+v for %d, got %+v %v", round, expected, items, result, err)
+            }
+        }
+    }
+}
+
+func BenchmarkExactUnfillable(b *testing.B) {
+    sizes := []int{5000, 2000, 1000, 500}
+    items := 1000001 // Not a multiple of 500, so no breakdown fills it
+
+    b.Run("tables", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            if counts, _ := fewestPacks(sizes, items); counts[items] >= 0 {
+                b.Fatal("Expected the order to be unfillable")
+            }
+        }
+    })
+
+    b.Run("remainders", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            if remainderCache.For(sizes).Fillable(items) {
+                b.Fatal("Expected the order to be unfillable")
+            }
+        }
+    })
+}
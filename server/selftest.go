@@ -0,0 +1,63 @@
+package main
+
+import (
+    "reflect"
+)
+
+// SelfTestCase is a calculation with a known breakdown, used to smoke test a deployment.
+type SelfTestCase struct {
+    Name     string
+    Sizes    []int
+    Items    int
+    Options  CalculateOptions
+    Expected []PackQuantity
+}
+
+// SelfTestResult reports whether Calculate reproduced the breakdown of a SelfTestCase.
+type SelfTestResult struct {
+    Name     string         `json:"name"`            // Name of the case
+    Passed   bool           `json:"passed"`          // Whether the breakdown matched
+    Expected []PackQuantity `json:"expected"`        // Breakdown the case expects
+    Got      []PackQuantity `json:"got"`             // Breakdown Calculate returned
+    Error    string         `json:"error,omitempty"` // Calculation error, if any
+}
+
+// selfTestCases are the fixtures GET /selftest runs, covering each mode and strategy.
+var selfTestCases = []SelfTestCase{
+    {"smallest pack covers a tiny order", []int{250, 500, 1000, 2000, 5000}, 1, CalculateOptions{}, []PackQuantity{{Pack: 250, Quantity: 1}}},
+    {"one larger pack beats two smaller", []int{250, 500, 1000, 2000, 5000}, 251, CalculateOptions{}, []PackQuantity{{Pack: 500, Quantity: 1}}},
+    {"fewest items, then fewest packs", []int{250, 500, 1000, 2000, 5000}, 12001, CalculateOptions{}, []PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}}},
+    {"greedy fill is not optimal", []int{23, 31, 53}, 500000, CalculateOptions{}, []PackQuantity{{Pack: 53, Quantity: 9429}, {Pack: 31, Quantity: 7}, {Pack: 23, Quantity: 2}}},
+    {"exact mode", []int{3, 5}, 7, CalculateOptions{Mode: ModeExact}, nil},
+    {"partial mode", []int{3, 5}, 7, CalculateOptions{Mode: ModePartial}, []PackQuantity{{Pack: 3, Quantity: 2}}},
+    {"fewest packs strategy", []int{250, 500, 1000}, 501, CalculateOptions{Strategy: StrategyFewestPacks}, []PackQuantity{{Pack: 1000, Quantity: 1}}},
+}
+
+// RunSelfTest runs Calculate against every fixture in cases. A case expecting no
+// breakdown passes when Calculate reports an error.
+func RunSelfTest(cases []SelfTestCase) (results []SelfTestResult, passed bool) {
+    passed = true
+
+    for _, c := range cases {
+        packs := make([]Pack, len(c.Sizes))
+        for i, size := range c.Sizes {
+            packs[i] = Pack{Size: size}
+        }
+
+        result := SelfTestResult{Name: c.Name, Expected: c.Expected}
+
+        breakdown, err := Calculate(packs, c.Items, c.Options)
+        if err != nil {
+            result.Error = err.Error()
+            result.Passed = c.Expected == nil
+        } else {
+            result.Got = breakdown.Packs
+            result.Passed = c.Expected != nil && reflect.DeepEqual(breakdown.Packs, c.Expected)
+        }
+
+        passed = passed && result.Passed
+        results = append(results, result)
+    }
+
+    return results, passed
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+    "errors"
+    "slices"
+)
+
+var (
+    // ErrStockExceeded is returned when the packs in stock can't make up a breakdown the mode accepts.
+    ErrStockExceeded = errors.New("not enough packs in stock for the order")
+    // ErrStockConstraints is returned when a stock limit is combined with a constraint it doesn't support.
+    ErrStockConstraints = errors.New("limitStock can't be combined with maxWeight or minDistinctSizes")
+)
+
+// unlimitedStock marks a size whose stock isn't tracked, so any number of its packs can be used.
+const unlimitedStock = -1
+
+// packStock returns the packs on hand of each size, summed over packs sharing a size,
+// or nil when no pack tracks its stock. A size with any untracked pack is unlimited.
+func packStock(packs []Pack) map[int]int {
+    var stock map[int]int
+
+    for _, pack := range packs {
+        if pack.Stock > 0 {
+            stock = make(map[int]int, len(packs))
+            break
+        }
+    }
+
+    if stock == nil {
+        return nil
+    }
+
+    for _, pack := range packs {
+        switch current, ok := stock[pack.Size]; {
+        case pack.Stock == 0 || current == unlimitedStock:
+            stock[pack.Size] = unlimitedStock
+        case ok:
+            stock[pack.Size] = current + pack.Stock
+        default:
+            stock[pack.Size] = pack.Stock
+        }
+    }
+
+    return stock
+}
+
+// stockTables are the tables of a bounded DP: layers[i][t] is the fewest packs summing
+// exactly to t using only sizes[i:] and no more of a size than is in stock, or -1 when
+// no such breakdown exists. sizes are distinct and in descending order, so the first
+// layer covers every size and is the one breakdowns are picked from.
+type stockTables struct {
+    sizes  []int
+    stock  []int // Packs on hand of each size, unlimitedStock when untracked
+    layers [][]int32
+}
+
+// newStockTables fills the tables up to limit. Each layer adds one size to the layer
+// after it: the fewest packs for t are the fewest over every quantity q of the size in
+// stock of q plus the fewest packs for t-q*size without it. The minimum over q is kept
+// in a sliding window along each residue modulo the size, so a layer takes O(limit)
+// whatever the stock.
+func newStockTables(sizes []int, stock map[int]int, limit int) *stockTables {
+    tables := &stockTables{sizes: sizes, stock: make([]int, len(sizes)), layers: make([][]int32, len(sizes))}
+
+    next := make([]int32, limit+1) // The empty layer after the last size only reaches 0
+    for total := 1; total <= limit; total++ {
+        next[total] = -1
+    }
+
+    for i := len(sizes) - 1; i >= 0; i-- {
+        size, available := sizes[i], unlimitedStock
+        if n, ok := stock[size]; ok {
+            available = n
+        }
+        tables.stock[i] = available
+
+        layer := make([]int32, limit+1)
+        window := make([]int, 0, limit/size+1) // Quantities q in the window, their values increasing
+
+        for r := 0; r < size && r <= limit; r++ {
+            window = window[:0]
+
+            for q := 0; r+q*size <= limit; q++ {
+                // Values are the fewest packs for r+q*size without the size, less q, so
+                // adding the current q back gives the packs of a breakdown using the size.
+                if next[r+q*size] >= 0 {
+                    value := int(next[r+q*size]) - q
+                    for len(window) > 0 && int(next[r+window[len(window)-1]*size])-window[len(window)-1] >= value {
+                        window = window[:len(window)-1]
+                    }
+                    window = append(window, q)
+                }
+
+                for available != unlimitedStock && len(window) > 0 && window[0] < q-available {
+                    window = window[1:] // Using more than available packs of the size
+                }
+
+                if len(window) == 0 {
+                    layer[r+q*size] = -1
+                    continue
+                }
+
+                from := window[0]
+                layer[r+q*size] = next[r+from*size] - int32(from) + int32(q)
+            }
+        }
+
+        tables.layers[i] = layer
+        next = layer
+    }
+
+    return tables
+}
+
+// packs returns the fewest packs in stock summing to total, or -1 when none do.
+func (s *stockTables) packs(total int) int {
+    return int(s.layers[0][total])
+}
+
+// breakdown returns the breakdown of total with the fewest packs in stock. Among those
+// it takes as many of the largest size as it can, then of the next largest, and so on,
+// the same tie-break as Calculate. total must be reachable.
+func (s *stockTables) breakdown(total int) Result {
+    result := Result{Packs: []PackQuantity{}, TotalItems: total, TotalPacks: s.packs(total)}
+
+    t := total
+    for i, size := range s.sizes {
+        quantity := 0
+        if i == len(s.sizes)-1 {
+            quantity = t / size // The last size has to make up the rest on its own
+        } else {
+            for q := t / size; q >= 0; q-- {
+                if s.stock[i] != unlimitedStock && q > s.stock[i] {
+                    continue
+                }
+
+                if rest := s.layers[i+1][t-q*size]; rest >= 0 && int(rest)+q == int(s.layers[i][t]) {
+                    quantity = q
+                    break
+                }
+            }
+        }
+
+        if quantity > 0 {
+            result.Packs = append(result.Packs, PackQuantity{Pack: size, Quantity: quantity})
+        }
+        t -= quantity * size
+    }
+
+    return result
+}
+
+// calculateStock picks the breakdown of items from the stock tables by the mode and
+// strategy as Calculate does, considering totals up to limit. It fails with
+// ErrStockExceeded when the stock can't make up a breakdown the mode accepts.
+func calculateStock(sizes []int, stock map[int]int, items, limit int, opts CalculateOptions) (Result, error) {
+    tables := newStockTables(sizes, stock, limit)
+
+    switch opts.Mode {
+    case ModeExact:
+        if tables.packs(items) < 0 {
+            return Result{}, ErrStockExceeded // Exact mode checked the order can be filled without the stock limit
+        }
+
+        return tables.breakdown(items), nil
+    case ModePartial:
+        total := items
+        for tables.packs(total) < 0 {
+            total-- // The empty breakdown is always in stock, so this stops at 0
+        }
+
+        result := tables.breakdown(total)
+        result.Shortfall = items - total
+
+        return result, nil
+    }
+
+    best := -1
+    for total := items; total <= limit; total++ {
+        n := tables.packs(total)
+        if n < 0 {
+            continue
+        }
+
+        if opts.Strategy != StrategyFewestPacks {
+            return tables.breakdown(total), nil // The first reachable total ships the fewest items
+        }
+
+        if best < 0 || n < tables.packs(best) {
+            best = total // Keep the smallest total among those with the fewest packs
+        }
+    }
+
+    if best >= 0 {
+        return tables.breakdown(best), nil
+    }
+
+    // The tolerance alone rules out every total when none is reachable even without the stock limit.
+    if opts.MaxOvershipPercent != nil {
+        counts, _ := fewestPacks(sizes, limit)
+        if !slices.ContainsFunc(counts[items:], func(n int) bool { return n >= 0 }) {
+            return Result{}, ErrOvershipExceeded
+        }
+    }
+
+    return Result{}, ErrStockExceeded
+}
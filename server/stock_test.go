@@ -0,0 +1,178 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "reflect"
+    "testing"
+)
+
+func TestStockTablesMatchBruteForce(t *testing.T) {
+    sizes := []int{7, 5, 3}
+    stocks := []map[int]int{
+        {7: 2, 5: unlimitedStock, 3: 1},
+        {7: 1, 5: 1, 3: 1},
+        {7: unlimitedStock, 5: 3, 3: unlimitedStock},
+    }
+    limit := 60
+
+    for _, stock := range stocks {
+        tables := newStockTables(sizes, stock, limit)
+
+        // The fewest packs of every total by trying every quantity of each size
+        fewest := make([]int, limit+1)
+        for total := range fewest {
+            fewest[total] = -1
+        }
+        bound := func(size int) int {
+            if stock[size] == unlimitedStock {
+                return limit / size
+            }
+            return stock[size]
+        }
+        for a := 0; a <= bound(7); a++ {
+            for b := 0; b <= bound(5); b++ {
+                for c := 0; c <= bound(3); c++ {
+                    total := 7*a + 5*b + 3*c
+                    if total <= limit && (fewest[total] < 0 || a+b+c < fewest[total]) {
+                        fewest[total] = a + b + c
+                    }
+                }
+            }
+        }
+
+        for total := 0; total <= limit; total++ {
+            if got := tables.packs(total); got != fewest[total] {
+                t.Errorf("%v: expected %d packs for %d, got %d", stock, fewest[total], total, got)
+                continue
+            }
+            if fewest[total] < 0 {
+                continue
+            }
+
+            result := tables.breakdown(total)
+            items, packs := 0, 0
+            for _, line := range result.Packs {
+                if stock[line.Pack] != unlimitedStock && line.Quantity > stock[line.Pack] {
+                    t.Errorf("%v: breakdown of %d uses %d packs of %d", stock, total, line.Quantity, line.Pack)
+                }
+                items += line.Pack * line.Quantity
+                packs += line.Quantity
+            }
+            if items != total || packs != fewest[total] || result.TotalPacks != packs {
+                t.Errorf("%v: expected a breakdown of %d in %d packs, got %+v", stock, total, fewest[total], result)
+            }
+        }
+    }
+}
+
+func TestStockTablesUnlimitedMatchCalculate(t *testing.T) {
+    sizes := []int{5000, 2000, 1000, 500, 250}
+    limit := 20000
+
+    tables := newStockTables(sizes, map[int]int{}, limit)
+    counts, last := fewestPacks(sizes, limit)
+
+    for total := 0; total <= limit; total += 50 {
+        if tables.packs(total) != counts[total] {
+            t.Fatalf("Expected %d packs for %d, got %d", counts[total], total, tables.packs(total))
+        }
+        if counts[total] >= 0 && !reflect.DeepEqual(tables.breakdown(total), breakdown(total, last, sizes)) {
+            t.Errorf("Expected the tie-break of Calculate for %d, got %+v", total, tables.breakdown(total))
+        }
+    }
+}
+
+func TestCalculateLimitStock(t *testing.T) {
+    catalog := func(stock map[int]int) []Pack {
+        var packs []Pack
+        for _, size := range []int{250, 500, 1000, 2000, 5000} {
+            packs = append(packs, Pack{Size: size, Stock: stock[size]})
+        }
+        return packs
+    }
+
+    tests := []struct {
+        name      string
+        stock     map[int]int
+        items     int
+        opts      CalculateOptions
+        expected  []PackQuantity
+        shortfall int
+        err       error
+    }{
+        {"no stock tracked", nil, 12001, CalculateOptions{LimitStock: true},
+            []PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}}, 0, nil},
+        {"stock ignored without the constraint", map[int]int{5000: 1}, 12001, CalculateOptions{},
+            []PackQuantity{{Pack: 5000, Quantity: 2}, {Pack: 2000, Quantity: 1}, {Pack: 250, Quantity: 1}}, 0, nil},
+        {"short of the largest size", map[int]int{5000: 1}, 12001, CalculateOptions{LimitStock: true},
+            []PackQuantity{{Pack: 5000, Quantity: 1}, {Pack: 2000, Quantity: 3}, {Pack: 1000, Quantity: 1}, {Pack: 250, Quantity: 1}}, 0, nil},
+        {"short of the smallest size", map[int]int{250: 1, 500: 1, 1000: 1, 2000: 1, 5000: 1}, 750, CalculateOptions{LimitStock: true},
+            []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, 0, nil},
+        {"overshipping further to stay in stock", map[int]int{250: 1, 500: 1, 1000: 1, 2000: 1, 5000: 1}, 501, CalculateOptions{LimitStock: true},
+            []PackQuantity{{Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, 0, nil},
+        {"not enough in stock", map[int]int{250: 1, 500: 1, 1000: 1, 2000: 1, 5000: 1}, 9000, CalculateOptions{LimitStock: true},
+            nil, 0, ErrStockExceeded},
+        {"exact order out of stock", map[int]int{250: 1, 500: 1, 1000: 1, 2000: 1, 5000: 1}, 9000, CalculateOptions{Mode: ModeExact, LimitStock: true},
+            nil, 0, ErrStockExceeded},
+        {"partial fill from stock", map[int]int{250: 1, 500: 1, 1000: 1, 2000: 1, 5000: 1}, 9000, CalculateOptions{Mode: ModePartial, LimitStock: true},
+            []PackQuantity{{Pack: 5000, Quantity: 1}, {Pack: 2000, Quantity: 1}, {Pack: 1000, Quantity: 1}, {Pack: 500, Quantity: 1}, {Pack: 250, Quantity: 1}}, 250, nil},
+        {"fewest packs within stock", map[int]int{5000: 1}, 12001, CalculateOptions{Strategy: StrategyFewestPacks, LimitStock: true},
+            []PackQuantity{{Pack: 5000, Quantity: 1}, {Pack: 2000, Quantity: 4}}, 0, nil},
+        {"with a weight limit", map[int]int{5000: 1}, 1, CalculateOptions{MaxWeight: new(float64), LimitStock: true},
+            nil, 0, ErrStockConstraints},
+    }
+
+    for _, test := range tests {
+        result, err := Calculate(catalog(test.stock), test.items, test.opts)
+        if !errors.Is(err, test.err) {
+            t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+            continue
+        }
+        if err != nil {
+            continue
+        }
+
+        if !reflect.DeepEqual(result.Packs, test.expected) || result.Shortfall != test.shortfall {
+            t.Errorf("%s: expected %+v short %d, got %+v", test.name, test.expected, test.shortfall, result)
+        }
+    }
+}
+
+func TestCalculateLimitStockPreferExact(t *testing.T) {
+    packs := []Pack{{Size: 3, Stock: 1}, {Size: 5}}
+
+    // 6 is two packs of 3, but only one is in stock, so the order is overshipped
+    result, err := Calculate(packs, 6, CalculateOptions{Mode: ModePreferExact, LimitStock: true})
+    if err != nil || !result.Approximate || result.TotalItems != 8 {
+        t.Errorf("Expected an approximate 8, got %+v %v", result, err)
+    }
+}
+
+func TestCalculateLimitStockHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    for _, size := range []int{250, 500, 1000} {
+        performRequest(router, http.MethodPost, "/packs", fmt.Sprintf(`{"size": %d, "stock": 2}`, size))
+    }
+
+    var result Result
+    rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 3000, "limitStock": true}`)
+    json.Unmarshal(rec.Body.Bytes(), &result)
+
+    expected := []PackQuantity{{Pack: 1000, Quantity: 2}, {Pack: 500, Quantity: 2}}
+    if rec.Code != http.StatusOK || !reflect.DeepEqual(result.Packs, expected) {
+        t.Errorf("Expected %+v, got %d %s", expected, rec.Code, rec.Body.String())
+    }
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 4000, "limitStock": true}`); rec.Code != http.StatusUnprocessableEntity {
+        t.Errorf("Expected status 422 beyond the stock, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    if rec := performRequest(router, http.MethodPost, "/packs", `{"size": 750, "stock": -1}`); rec.Code != http.StatusBadRequest {
+        t.Errorf("Expected status 400 for negative stock, got %d", rec.Code)
+    }
+}
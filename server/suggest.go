@@ -0,0 +1,137 @@
+package main
+
+import (
+    "slices"
+    "sort"
+    "time"
+)
+
+// defaultSuggestBudget is how long a pack size suggestion searches when no budget is given.
+const defaultSuggestBudget = 2 * time.Second
+
+// maxSuggestCandidates bounds the sizes a suggestion chooses from, since every move
+// tried recalculates each sample order.
+const maxSuggestCandidates = 100
+
+// Suggestion is a set of pack sizes proposed for a sample of orders.
+type Suggestion struct {
+    Sizes        []int `json:"sizes"`        // Proposed pack sizes, largest first
+    Overshipment int   `json:"overshipment"` // Items shipped beyond the orders, summed over every order
+    Packs        int   `json:"packs"`        // Packs shipped, summed over every order
+    Converged    bool  `json:"converged"`    // Whether the search finished before its time budget ran out
+}
+
+// better reports whether s ships fewer extra items than other, or as many in fewer packs.
+func (s Suggestion) better(other Suggestion) bool {
+    if s.Overshipment != other.Overshipment {
+        return s.Overshipment < other.Overshipment
+    }
+
+    return s.Packs < other.Packs
+}
+
+// SuggestPackSizes proposes count pack sizes that ship the sample orders with as little
+// overshipment, then as few packs, as it can find. It is an anytime search: it starts
+// from sizes spread across the orders and keeps swapping one size for another candidate
+// while that improves the result, stopping when no swap does or once budget is spent.
+// The best sizes found so far are returned either way, with Converged telling which.
+// The starting sizes are always evaluated, so the search may overrun a tiny budget.
+func SuggestPackSizes(orders []int, count int, budget time.Duration) Suggestion {
+    deadline := time.Now().Add(budget)
+    candidates := suggestCandidates(orders)
+
+    if count > len(candidates) {
+        count = len(candidates)
+    }
+
+    sizes := make([]int, count)
+    for i := range sizes {
+        sizes[i] = candidates[i*(len(candidates)-1)/max(count-1, 1)] // Spread across the candidates
+    }
+
+    best, _ := evaluateSizes(orders, sizes, time.Time{})
+
+    for {
+        improved := false
+
+        for i := range best.Sizes {
+            for _, candidate := range candidates {
+                if slices.Contains(best.Sizes, candidate) {
+                    continue
+                }
+
+                trial := append([]int(nil), best.Sizes...)
+                trial[i] = candidate
+
+                suggestion, complete := evaluateSizes(orders, trial, deadline)
+                if !complete {
+                    return best // The budget ran out part way through the swap
+                }
+
+                if suggestion.better(best) {
+                    best, improved = suggestion, true
+                }
+            }
+        }
+
+        if !improved {
+            best.Converged = true
+            return best
+        }
+    }
+}
+
+// suggestCandidates returns the sizes a suggestion chooses from: each distinct order and
+// its half and quarter, smallest first, thinned out evenly to maxSuggestCandidates.
+func suggestCandidates(orders []int) []int {
+    seen := make(map[int]bool)
+    var candidates []int
+    for _, order := range orders {
+        for _, size := range []int{order, order / 2, order / 4} {
+            if size > 0 && !seen[size] {
+                seen[size] = true
+                candidates = append(candidates, size)
+            }
+        }
+    }
+    sort.Ints(candidates)
+
+    if len(candidates) <= maxSuggestCandidates {
+        return candidates
+    }
+
+    thinned := make([]int, maxSuggestCandidates)
+    for i := range thinned {
+        thinned[i] = candidates[i*(len(candidates)-1)/(maxSuggestCandidates-1)]
+    }
+
+    return thinned
+}
+
+// evaluateSizes calculates every order with the sizes and totals the outcome. It gives
+// up, reporting false, if deadline passes first; a zero deadline never passes.
+func evaluateSizes(orders []int, sizes []int, deadline time.Time) (Suggestion, bool) {
+    packs := make([]Pack, len(sizes))
+    for i, size := range sizes {
+        packs[i] = Pack{Size: size}
+    }
+
+    suggestion := Suggestion{Sizes: append([]int(nil), sizes...)}
+    sort.Sort(sort.Reverse(sort.IntSlice(suggestion.Sizes)))
+
+    for _, items := range orders {
+        if !deadline.IsZero() && time.Now().After(deadline) {
+            return Suggestion{}, false
+        }
+
+        result, err := Calculate(packs, items, CalculateOptions{Strategy: StrategyBalanced})
+        if err != nil {
+            continue // Overship mode fills any order from positive sizes
+        }
+
+        suggestion.Overshipment += result.TotalItems - items
+        suggestion.Packs += result.TotalPacks
+    }
+
+    return suggestion, true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestSuggestPackSizes(t *testing.T) {
+    // Every order is a multiple of 250, so 250 ships them all without overshipping
+    suggestion := SuggestPackSizes([]int{250, 500, 750, 1250}, 1, time.Minute)
+    if !suggestion.Converged || !reflect.DeepEqual(suggestion.Sizes, []int{250}) || suggestion.Overshipment != 0 {
+        t.Errorf("Expected a converged suggestion of [250], got %+v", suggestion)
+    }
+
+    // With two sizes the larger one saves packs
+    suggestion = SuggestPackSizes([]int{250, 500, 750, 1250}, 2, time.Minute)
+    if !suggestion.Converged || suggestion.Overshipment != 0 || suggestion.Packs >= 11 {
+        t.Errorf("Expected two sizes shipping with fewer packs than 250 alone, got %+v", suggestion)
+    }
+}
+
+func TestSuggestPackSizesBudget(t *testing.T) {
+    orders := make([]int, 100)
+    for i := range orders {
+        orders[i] = 9001 + 97*i
+    }
+
+    budget := 50 * time.Millisecond
+    start := time.Now()
+    suggestion := SuggestPackSizes(orders, 5, budget)
+    elapsed := time.Since(start)
+
+    if suggestion.Converged {
+        t.Fatalf("Expected the search to run out of budget, took %s", elapsed)
+    }
+
+    // The starting sizes are always evaluated, so allow for one full evaluation on top
+    if elapsed > budget+time.Second {
+        t.Errorf("Expected the search to stop near its %s budget, took %s", budget, elapsed)
+    }
+
+    // The partial answer is valid: its totals match its sizes
+    expected, _ := evaluateSizes(orders, suggestion.Sizes, time.Time{})
+    if len(suggestion.Sizes) != 5 || suggestion.Overshipment != expected.Overshipment || suggestion.Packs != expected.Packs {
+        t.Errorf("Expected 5 sizes with totals %+v, got %+v", expected, suggestion)
+    }
+}
+
+func TestSuggestPacksHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    rec := performRequest(router, http.MethodPost, "/packs/suggest", `{"orders": [250, 500, 750], "count": 1, "timeBudgetMs": 5000}`)
+
+    var suggestion Suggestion
+    json.Unmarshal(rec.Body.Bytes(), &suggestion)
+
+    if rec.Code != http.StatusOK || !suggestion.Converged || !reflect.DeepEqual(suggestion.Sizes, []int{250}) {
+        t.Errorf("Expected a converged suggestion of [250], got %d %s", rec.Code, rec.Body.String())
+    }
+
+    for _, body := range []string{`{}`, `{"orders": [250], "count": 0}`, `{"orders": [0], "count": 1}`, `{"orders": [250], "count": 1, "timeBudgetMs": -1}`, `{"orders": [2000000], "count": 1}`} {
+        if rec := performRequest(router, http.MethodPost, "/packs/suggest", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+        }
+    }
+}
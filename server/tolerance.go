@@ -0,0 +1,58 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "strconv"
+)
+
+// defaultFloatTolerance is the relative tolerance used when FLOAT_TOLERANCE is unset.
+const defaultFloatTolerance = 1e-9
+
+// floatTolerance is how far apart, relative to their size, two weights may be and still
+// compare equal. Sums such as 0.1+0.2 carry binary noise, so comparing them exactly
+// would miss ties and reject breakdowns sitting right at a limit. Set from FLOAT_TOLERANCE.
+var floatTolerance = defaultFloatTolerance
+
+// loadFloatTolerance reads FLOAT_TOLERANCE, falling back to defaultFloatTolerance when unset.
+func loadFloatTolerance() (float64, error) {
+    value := os.Getenv("FLOAT_TOLERANCE")
+    if value == "" {
+        return defaultFloatTolerance, nil
+    }
+
+    tolerance, err := strconv.ParseFloat(value, 64)
+    if err != nil || tolerance < 0 || tolerance >= 1 {
+        return 0, fmt.Errorf("invalid FLOAT_TOLERANCE %q: must be a number from 0 up to 1", value)
+    }
+
+    return tolerance, nil
+}
+
+// approxEqual reports whether a and b differ by no more than floatTolerance, scaled
+// by the larger of their magnitudes and never by less than 1.
+func approxEqual(a, b float64) bool {
+    scale := math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+    return math.Abs(a-b) <= floatTolerance*scale
+}
+
+// approxLess reports whether a is less than b by more than the tolerance.
+func approxLess(a, b float64) bool {
+    return a < b && !approxEqual(a, b)
+}
+
+// approxAtMost reports whether a is less than or approximately equal to b.
+func approxAtMost(a, b float64) bool {
+    return a < b || approxEqual(a, b)
+}
+
+// approxCeil returns the smallest integer not below x, ignoring excess within the
+// tolerance: 2.007*1000 is 2007.0000000000002 but rounds up to 2007, not 2008.
+func approxCeil(x float64) float64 {
+    if rounded := math.Round(x); approxEqual(x, rounded) {
+        return rounded
+    }
+
+    return math.Ceil(x)
+}
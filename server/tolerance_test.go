@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestApproxComparisons(t *testing.T) {
+    tests := []struct {
+        a, b  float64
+        equal bool
+        less  bool
+    }{
+        {0.1 + 0.2, 0.3, true, false},  // Off by one ulp
+        {0.3, 0.1 + 0.2, true, false},
+        {1e6 + 1e-4, 1e6, true, false}, // Within the tolerance relative to the magnitude
+        {0.3, 0.3000001, false, true},
+        {2, 1, false, false},
+        {0, 1e-12, true, false},
+    }
+
+    for _, test := range tests {
+        if got := approxEqual(test.a, test.b); got != test.equal {
+            t.Errorf("approxEqual(%v, %v): expected %t, got %t", test.a, test.b, test.equal, got)
+        }
+        if got := approxLess(test.a, test.b); got != test.less {
+            t.Errorf("approxLess(%v, %v): expected %t, got %t", test.a, test.b, test.less, got)
+        }
+        if got := approxAtMost(test.a, test.b); got != (test.equal || test.less) {
+            t.Errorf("approxAtMost(%v, %v): expected %t, got %t", test.a, test.b, test.equal || test.less, got)
+        }
+    }
+
+    if got := approxCeil(2.007 * 1000); got != 2007 {
+        t.Errorf("Expected 2.007*1000 to round up to 2007, got %v", got)
+    }
+    if got := approxCeil(2007.5); got != 2008 {
+        t.Errorf("Expected 2007.5 to round up to 2008, got %v", got)
+    }
+}
+
+func TestWeightsWithinTolerance(t *testing.T) {
+    packs := []Pack{{Size: 250, Weight: 0.1}, {Size: 500, Weight: 0.2}}
+    max := 0.3
+
+    // 0.1+0.2 weighs 0.30000000000000004, which is right at the limit
+    result, err := Calculate(packs, 750, CalculateOptions{MaxWeight: &max})
+    if err != nil || result.TotalItems != 750 {
+        t.Errorf("Expected 750 items within a 0.3 weight limit, got %+v %v", result, err)
+    }
+
+    result, err = CalculateByWeight([]Pack{{Size: 250, Weight: 2.007}}, 2.007)
+    if err != nil || result.TotalPacks != 1 {
+        t.Errorf("Expected a single pack to reach its own weight, got %+v %v", result, err)
+    }
+}
+
+func TestFloatToleranceFromEnv(t *testing.T) {
+    t.Setenv("FLOAT_TOLERANCE", "")
+    if tolerance, err := loadFloatTolerance(); err != nil || tolerance != defaultFloatTolerance {
+        t.Errorf("Expected the default tolerance, got %v %v", tolerance, err)
+    }
+
+    t.Setenv("FLOAT_TOLERANCE", "1e-6")
+    if tolerance, err := loadFloatTolerance(); err != nil || tolerance != 1e-6 {
+        t.Errorf("Expected a tolerance of 1e-6, got %v %v", tolerance, err)
+    }
+
+    for _, value := range []string{"abc", "-1e-9", "1"} {
+        t.Setenv("FLOAT_TOLERANCE", value)
+        if _, err := loadFloatTolerance(); err == nil {
+            t.Errorf("Expected an error for FLOAT_TOLERANCE %q", value)
+        }
+    }
+}
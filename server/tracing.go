@@ -0,0 +1,153 @@
+package main
+
+import (
+    "context"
+    "os"
+
+    "github.com/gin-gonic/gin"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans this server creates.
+const tracerName = "order-packs-calculator"
+
+// initTracing exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT is set, with
+// the exporter reading the rest of its OTEL_* settings itself. Otherwise the global
+// provider stays a no-op and spans cost next to nothing. The returned function flushes
+// and stops the exporter.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+    if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+        return func(context.Context) error { return nil }, nil
+    }
+
+    exporter, err := otlptracehttp.New(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", tracerName))),
+    )
+    otel.SetTracerProvider(provider)
+
+    return provider.Shutdown, nil
+}
+
+// traceRequests wraps every request in a span named after its method and route, and
+// passes the span on in the request context so store calls nest under it.
+func traceRequests(ctx *gin.Context) {
+    route := ctx.FullPath()
+    if route == "" {
+        route = "unmatched"
+    }
+
+    spanCtx, span := otel.Tracer(tracerName).Start(ctx.Request.Context(), ctx.Request.Method+" "+route,
+        trace.WithSpanKind(trace.SpanKindServer),
+        trace.WithAttributes(attribute.String("http.method", ctx.Request.Method), attribute.String("http.route", route)))
+    defer span.End()
+
+    ctx.Request = ctx.Request.WithContext(spanCtx)
+    ctx.Next()
+
+    status := ctx.Writer.Status()
+    span.SetAttributes(attribute.Int("http.status_code", status))
+    if status >= 500 {
+        span.SetStatus(codes.Error, "")
+    }
+}
+
+// tracedStore returns the pack store wrapped so every call gets a span within the request's trace.
+func tracedStore(ctx *gin.Context) PackStore {
+    return spanStore{store: database, ctx: ctx.Request.Context()}
+}
+
+// spanStore is a PackStore recording a span around each call to the store it wraps.
+type spanStore struct {
+    store PackStore
+    ctx   context.Context // Context the spans are started in
+}
+
+// start begins a span for the named store call.
+func (s spanStore) start(name string) trace.Span {
+    _, span := otel.Tracer(tracerName).Start(s.ctx, "PackStore."+name, trace.WithSpanKind(trace.SpanKindClient))
+    return span
+}
+
+// endSpan records the outcome of a store call and ends its span.
+func endSpan(span trace.Span, err error) {
+    if err != nil {
+        span.RecordError(err)
+        span.SetStatus(codes.Error, err.Error())
+    }
+    span.End()
+}
+
+func (s spanStore) CreatePack(pack Pack) (Pack, error) {
+    span := s.start("CreatePack")
+    created, err := s.store.CreatePack(pack)
+    endSpan(span, err)
+    return created, err
+}
+
+func (s spanStore) GetAllPacks(opts ListOptions) ([]Pack, error) {
+    span := s.start("GetAllPacks")
+    packs, err := s.store.GetAllPacks(opts)
+    endSpan(span, err)
+    return packs, err
+}
+
+func (s spanStore) GetPack(id string) (Pack, error) {
+    span := s.start("GetPack")
+    pack, err := s.store.GetPack(id)
+    endSpan(span, err)
+    return pack, err
+}
+
+func (s spanStore) UpdatePack(pack Pack) (Pack, error) {
+    span := s.start("UpdatePack")
+    updated, err := s.store.UpdatePack(pack)
+    endSpan(span, err)
+    return updated, err
+}
+
+func (s spanStore) DeletePack(id string) error {
+    span := s.start("DeletePack")
+    err := s.store.DeletePack(id)
+    endSpan(span, err)
+    return err
+}
+
+func (s spanStore) DeletePacksBySize(sizes []int) (int, error) {
+    span := s.start("DeletePacksBySize")
+    deleted, err := s.store.DeletePacksBySize(sizes)
+    endSpan(span, err)
+    return deleted, err
+}
+
+func (s spanStore) ReplacePacks(packs []Pack) (ReplaceSummary, error) {
+    span := s.start("ReplacePacks")
+    summary, err := s.store.ReplacePacks(packs)
+    endSpan(span, err)
+    return summary, err
+}
+
+func (s spanStore) PackHistory(id string) ([]SizeChange, error) {
+    span := s.start("PackHistory")
+    history, err := s.store.PackHistory(id)
+    endSpan(span, err)
+    return history, err
+}
+
+func (s spanStore) Ping(ctx context.Context) error {
+    span := s.start("Ping")
+    err := s.store.Ping(ctx)
+    endSpan(span, err)
+    return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "testing"
+
+    "go.opentelemetry.io/otel"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceCalculateRequest(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    exporter := tracetest.NewInMemoryExporter()
+    provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+    defer provider.Shutdown(context.Background())
+
+    previous := otel.GetTracerProvider()
+    otel.SetTracerProvider(provider)
+    defer otel.SetTracerProvider(previous)
+
+    database.CreatePack(Pack{Size: 250})
+
+    if rec := performRequest(router, http.MethodPost, "/calculate", `{"items": 251}`); rec.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", rec.Code)
+    }
+
+    spans := exporter.GetSpans()
+    byName := make(map[string]tracetest.SpanStub, len(spans))
+    for _, span := range spans {
+        byName[span.Name] = span
+    }
+
+    request, ok := byName["POST /calculate"]
+    if !ok {
+        t.Fatalf("Expected a span for the request, got %+v", spans)
+    }
+
+    store, ok := byName["PackStore.GetAllPacks"]
+    if !ok {
+        t.Fatalf("Expected a span for the store call, got %+v", spans)
+    }
+
+    if store.Parent.SpanID() != request.SpanContext.SpanID() || store.SpanContext.TraceID() != request.SpanContext.TraceID() {
+        t.Error("Expected the store span to be a child of the request span")
+    }
+
+    for _, attr := range request.Attributes {
+        if attr.Key == "http.status_code" && attr.Value.AsInt64() != http.StatusOK {
+            t.Errorf("Expected the request span to record status 200, got %d", attr.Value.AsInt64())
+        }
+    }
+}
+
+func TestInitTracingDisabledByDefault(t *testing.T) {
+    t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+
+    shutdown, err := initTracing(context.Background())
+    if err != nil || shutdown(context.Background()) != nil {
+        t.Errorf("Expected tracing to stay a no-op without an endpoint, got %v", err)
+    }
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "reflect"
+    "strings"
+
+    "github.com/gin-gonic/gin/binding"
+    "github.com/go-playground/validator/v10"
+)
+
+// maxCatalogSize caps the number of pack sizes in a catalog.
+const maxCatalogSize = 100
+
+// ValidatePackSizes checks a proposed set of pack sizes. Errors make the set unusable:
+// non-positive or duplicate sizes, or too many of them. Warnings flag sets that work
+// but cover orders poorly.
+func ValidatePackSizes(sizes []int) (errs []string, warnings []string) {
+    if len(sizes) == 0 {
+        errs = append(errs, "at least one pack size is required")
+    }
+
+    if len(sizes) > maxCatalogSize {
+        errs = append(errs, fmt.Sprintf("at most %d pack sizes are allowed, got %d", maxCatalogSize, len(sizes)))
+    }
+
+    seen := make(map[int]bool, len(sizes))
+    for _, size := range sizes {
+        if size <= 0 {
+            errs = append(errs, fmt.Sprintf("pack size %d must be positive", size))
+            continue
+        }
+
+        if err := checkPackSize(size); err != nil {
+            errs = append(errs, err.Error())
+            continue
+        }
+
+        if seen[size] {
+            errs = append(errs, fmt.Sprintf("pack size %d is duplicated", size))
+        }
+        seen[size] = true
+    }
+
+    if len(errs) > 0 {
+        return errs, nil
+    }
+
+    warnings = append(warnings, coverageWarnings(sizes)...)
+
+    return nil, warnings
+}
+
+// coverageWarnings reports when every size shares a common divisor, which leaves
+// every order that isn't a multiple of it impossible to fill exactly.
+func coverageWarnings(sizes []int) []string {
+    divisor := packsGCD(sizes)
+    if divisor <= 1 {
+        return nil
+    }
+
+    return []string{fmt.Sprintf("all pack sizes are multiples of %d, so orders such as %d or %d can't be filled exactly",
+        divisor, divisor+1, 2*divisor-1)}
+}
+
+// CoverageReport describes how well the current catalog covers orders.
+type CoverageReport struct {
+    GCD      int      `json:"gcd"`      // Greatest common divisor of the pack sizes, 0 for an empty catalog
+    Warnings []string `json:"warnings"` // Coverage problems worth reviewing
+}
+
+// CatalogCoverage checks the coverage of the catalog held by store.
+func CatalogCoverage(store PackStore) (CoverageReport, error) {
+    packs, err := store.GetAllPacks(ListOptions{})
+    if err != nil {
+        return CoverageReport{}, err
+    }
+
+    return coverageReport(packs), nil
+}
+
+// coverageReport checks the coverage of packs.
+func coverageReport(packs []Pack) CoverageReport {
+    sizes := make([]int, len(packs))
+    for i, pack := range packs {
+        sizes[i] = pack.Size
+    }
+
+    report := CoverageReport{GCD: packsGCD(sizes), Warnings: coverageWarnings(sizes)}
+    if report.Warnings == nil {
+        report.Warnings = []string{} // Always return a list so clients can iterate it
+    }
+
+    return report
+}
+
+// logCoverageWarnings logs a warning for every coverage problem of the catalog, so a
+// misconfigured catalog is caught when the server starts.
+func logCoverageWarnings(store PackStore) {
+    report, err := CatalogCoverage(store)
+    if err != nil {
+        log.Printf("Unable to check pack coverage: %s", err)
+        return
+    }
+
+    for _, warning := range report.Warnings {
+        log.Printf("Warning: %s", warning)
+    }
+}
+
+// logCatalog logs the sizes of the catalog the server starts with, or warns when it is empty.
+func logCatalog(store PackStore) {
+    packs, err := store.GetAllPacks(ListOptions{})
+    if err != nil {
+        log.Printf("Unable to read the pack catalog: %s", err)
+        return
+    }
+
+    if len(packs) == 0 {
+        log.Printf("Warning: the pack catalog is empty, orders can't be calculated until packs are added")
+        return
+    }
+
+    sizes, err := packSizes(packs)
+    if err != nil {
+        log.Printf("Warning: the pack catalog is invalid: %s", err)
+        return
+    }
+
+    log.Printf("Pack catalog: %d packs, sizes %v", len(packs), sizes)
+}
+
+// packsGCD returns the greatest common divisor of the sizes, or 0 for an empty set.
+func packsGCD(sizes []int) int {
+    divisor := 0
+    for _, size := range sizes {
+        a, b := divisor, size
+        for b != 0 {
+            a, b = b, a%b
+        }
+        divisor = a
+    }
+
+    return divisor
+}
+
+// FieldError is one failed validation rule of a request body.
+type FieldError struct {
+    Field   string `json:"field"`   // JSON name of the offending field, empty when the body itself is malformed
+    Rule    string `json:"rule"`    // Validation rule that failed, e.g. required
+    Message string `json:"message"` // Human readable description of the failure
+}
+
+// useJSONFieldNames makes the binding validator report fields by their JSON names.
+func useJSONFieldNames() {
+    if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+        engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+            name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+            if name == "-" {
+                return ""
+            }
+            return name
+        })
+    }
+}
+
+// registerOptionRules adds the mode, strategy and algorithm binding rules, each accepting
+// the values its list in Modes, Strategies or AlgorithmNames holds, so the lists are the
+// only place the supported options are spelled out.
+func registerOptionRules() {
+    if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+        engine.RegisterAlias("mode", "oneof="+strings.Join(Modes, " "))
+        engine.RegisterAlias("strategy", "oneof="+strings.Join(Strategies, " "))
+        engine.RegisterAlias("algorithm", "oneof="+strings.Join(AlgorithmNames, " "))
+    }
+}
+
+// bindingErrors lists every failure in a binding error. The validator checks every field
+// before failing, so all offending fields are reported at once rather than only the first.
+// Bodies that aren't valid JSON for the request fail as a whole with a single entry.
+func bindingErrors(err error) []FieldError {
+    var invalid validator.ValidationErrors
+    if errors.As(err, &invalid) {
+        fields := make([]FieldError, len(invalid))
+        for i, fe := range invalid {
+            fields[i] = FieldError{Field: fe.Field(), Rule: fe.ActualTag(), Message: ruleMessage(fe)}
+        }
+        return fields
+    }
+
+    var mistyped *json.UnmarshalTypeError
+    if errors.As(err, &mistyped) {
+        return []FieldError{{Field: mistyped.Field, Rule: "type", Message: fmt.Sprintf("%s must be a %s", mistyped.Field, mistyped.Type)}}
+    }
+
+    return []FieldError{{Rule: "json", Message: err.Error()}}
+}
+
+// ruleMessage describes a failed validation rule in plain words.
+func ruleMessage(fe validator.FieldError) string {
+    switch fe.ActualTag() {
+    case "required":
+        return fe.Field() + " is required"
+    case "oneof":
+        return fe.Field() + " must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+    case "gt":
+        return fe.Field() + " must be greater than " + fe.Param()
+    case "gte":
+        return fe.Field() + " must be at least " + fe.Param()
+    case "max":
+        if fe.Kind() == reflect.Slice {
+            return fe.Field() + " must have at most " + fe.Param() + " entries"
+        }
+        return fe.Field() + " must be at most " + fe.Param()
+    }
+
+    return fmt.Sprintf("%s failed the %s rule", fe.Field(), fe.Tag())
+}
@@ -0,0 +1,71 @@
+package main
+
+import "context"
+
+// CatalogWaste is the aggregate outcome of shipping a set of orders with one catalog.
+type CatalogWaste struct {
+    Sizes        []int `json:"sizes"`                 // Pack sizes of the catalog, as given
+    Overshipment int   `json:"overshipment"`          // Items shipped beyond the orders, summed over the packed orders
+    Packs        int   `json:"packs"`                 // Packs shipped, summed over the packed orders
+    Unpacked     int   `json:"unpacked"`              // Orders the catalog could not pack
+    Approximate  bool  `json:"approximate,omitempty"` // Set when the time budget ran out and some orders were packed greedily
+}
+
+// WasteReport compares the waste of candidate catalogs over the same orders.
+type WasteReport struct {
+    Catalogs []CatalogWaste `json:"catalogs"` // Outcome of each catalog, in the order given
+    Best     int            `json:"best"`     // Index of the catalog wasting least
+}
+
+// less reports whether w wastes less than other: it packs more of the orders, or as
+// many with less overshipment, or as much in fewer packs.
+func (w CatalogWaste) less(other CatalogWaste) bool {
+    if w.Unpacked != other.Unpacked {
+        return w.Unpacked < other.Unpacked
+    }
+    if w.Overshipment != other.Overshipment {
+        return w.Overshipment < other.Overshipment
+    }
+
+    return w.Packs < other.Packs
+}
+
+// CompareWaste calculates every order with each catalog as a batch would and totals
+// the waste, reporting the catalog that wastes least. Ties go to the earlier catalog.
+// The whole comparison shares one CALCULATION_TIMEOUT: once it passes, the remaining
+// orders are packed greedily and the catalogs they belong to are flagged approximate.
+func CompareWaste(ctx context.Context, catalogs [][]Pack, orders []int, opts CalculateOptions) WasteReport {
+    if timeout := calculationTimeout(); timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+
+    report := WasteReport{Catalogs: make([]CatalogWaste, len(catalogs))}
+
+    for i, packs := range catalogs {
+        waste := CatalogWaste{Sizes: make([]int, len(packs))}
+        for j, pack := range packs {
+            waste.Sizes[j] = pack.Size
+        }
+
+        for _, items := range orders {
+            entry := calculateOrder(ctx, packs, items, opts)
+            if entry.Result == nil {
+                waste.Unpacked++
+                continue
+            }
+
+            waste.Approximate = waste.Approximate || entry.Result.Approximate
+            waste.Overshipment += entry.Result.TotalItems - items
+            waste.Packs += entry.Result.TotalPacks
+        }
+
+        report.Catalogs[i] = waste
+        if waste.less(report.Catalogs[report.Best]) {
+            report.Best = i
+        }
+    }
+
+    return report
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestCompareWaste(t *testing.T) {
+    orders := []int{250, 500, 750, 1000}
+
+    // Multiples of 250 fit the first catalog exactly, while 300 and 700 overship all but 1000
+    report := CompareWaste(context.Background(), [][]Pack{
+        {{Size: 300}, {Size: 700}},
+        {{Size: 250}, {Size: 500}, {Size: 1000}},
+    }, orders, CalculateOptions{})
+
+    expected := WasteReport{
+        Catalogs: []CatalogWaste{
+            {Sizes: []int{300, 700}, Overshipment: 300, Packs: 8},
+            {Sizes: []int{250, 500, 1000}, Overshipment: 0, Packs: 5},
+        },
+        Best: 1,
+    }
+    if !reflect.DeepEqual(report, expected) {
+        t.Errorf("Expected %+v, got %+v", expected, report)
+    }
+
+    // Equal waste goes to the earlier catalog
+    report = CompareWaste(context.Background(), [][]Pack{{{Size: 250}}, {{Size: 250}}}, orders, CalculateOptions{})
+    if report.Best != 0 {
+        t.Errorf("Expected the tie to go to the first catalog, got %+v", report)
+    }
+
+    // In exact mode a catalog packing more of the orders wins
+    report = CompareWaste(context.Background(), [][]Pack{{{Size: 1000}}, {{Size: 500}}}, []int{250, 500}, CalculateOptions{Mode: ModeExact})
+    if report.Best != 1 || report.Catalogs[0].Unpacked != 2 || report.Catalogs[1].Unpacked != 1 {
+        t.Errorf("Expected the catalog packing more orders to win, got %+v", report)
+    }
+}
+
+func TestCompareWasteHandler(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    var report WasteReport
+    rec := performRequest(router, http.MethodPost, "/packs/compare-waste",
+        `{"catalogs": [[300, 700], [250, 500, 1000]], "orders": [250, 500, 750, 1000]}`)
+    json.Unmarshal(rec.Body.Bytes(), &report)
+
+    if rec.Code != http.StatusOK || report.Best != 1 || report.Catalogs[0].Overshipment != 300 || report.Catalogs[1].Overshipment != 0 {
+        t.Errorf("Expected the second catalog to waste least, got %d %s", rec.Code, rec.Body.String())
+    }
+
+    // The stored catalog is left alone
+    if packs, _ := database.GetAllPacks(ListOptions{}); len(packs) != 0 {
+        t.Errorf("Expected no packs to be stored, got %+v", packs)
+    }
+
+    for _, body := range []string{
+        `{"catalogs": [[250]], "orders": [250]}`,
+        `{"catalogs": [[250], []], "orders": [250]}`,
+        `{"catalogs": [[250], [0]], "orders": [250]}`,
+        `{"catalogs": [[250], [500]], "orders": []}`,
+        `{"catalogs": [[250], [500]], "orders": [0]}`,
+        `{"catalogs": [[250], [500]], "orders": [250], "mode": "sideways"}`,
+    } {
+        if rec := performRequest(router, http.MethodPost, "/packs/compare-waste", body); rec.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d %s", body, rec.Code, rec.Body.String())
+        }
+    }
+}
+
+func TestCompareWasteLimits(t *testing.T) {
+    router, cleanup := newTestServer(t)
+    defer cleanup()
+
+    orders := make([]string, 100)
+    for i := range orders {
+        orders[i] = fmt.Sprint(251 + i)
+    }
+    body := `{"catalogs": [[250, 500], [300, 700]], "orders": [` + strings.Join(orders, ", ") + `]}`
+
+    // Comparisons are held to the concurrency limit like any calculation
+    previousLimiter := calculationLimiter
+    defer func() { calculationLimiter = previousLimiter }()
+    calculationLimiter = NewCalculationLimiter(1, 0)
+    calculationLimiter.acquire(nil)
+
+    if rec := performRequest(router, http.MethodPost, "/packs/compare-waste", body); rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status 503 while saturated, got %d", rec.Code)
+    }
+    calculationLimiter.release()
+
+    // Once the shared time budget runs out, the remaining orders are packed greedily at once
+    release := make(chan struct{})
+    defer close(release)
+
+    previous := exactCalculate
+    defer func() { exactCalculate = previous }()
+    exactCalculate = func(packs []Pack, items int, opts CalculateOptions) (Result, error) {
+        <-release
+        return Result{}, nil
+    }
+
+    t.Setenv("CALCULATION_TIMEOUT", "20ms")
+
+    start := time.Now()
+    var report WasteReport
+    rec := performRequest(router, http.MethodPost, "/packs/compare-waste", body)
+    json.Unmarshal(rec.Body.Bytes(), &report)
+
+    if rec.Code != http.StatusOK || len(report.Catalogs) != 2 || !report.Catalogs[0].Approximate || !report.Catalogs[1].Approximate {
+        t.Errorf("Expected both catalogs flagged approximate, got %d %s", rec.Code, rec.Body.String())
+    }
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Errorf("Expected the comparison to stop near its 20ms budget, took %s", elapsed)
+    }
+}